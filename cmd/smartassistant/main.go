@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/event"
 	"github.com/zhiting-tech/smartassistant/modules/sadiscover"
 	"github.com/zhiting-tech/smartassistant/modules/supervisor"
 	"math/rand"
@@ -17,6 +18,8 @@ import (
 	"github.com/zhiting-tech/smartassistant/modules/api/setting"
 	"github.com/zhiting-tech/smartassistant/modules/cloud"
 	"github.com/zhiting-tech/smartassistant/modules/config"
+	"github.com/zhiting-tech/smartassistant/modules/history"
+	"github.com/zhiting-tech/smartassistant/modules/mqtt"
 	"github.com/zhiting-tech/smartassistant/modules/plugin"
 	"github.com/zhiting-tech/smartassistant/modules/task"
 	"github.com/zhiting-tech/smartassistant/modules/types"
@@ -43,6 +46,8 @@ func main() {
 	// 优先使用单例模式，循环引用通过依赖注入解耦
 	taskManager := task.GetManager()
 	wsServer := websocket.NewWebSocketServer()
+	// 场景的提醒通过 websocket 推送
+	task.SetNotifier(wsServer)
 	httpServer := api.NewHttpServer(wsServer.AcceptWebSocket)
 	saDiscoverServer := sadiscover.NewSaDiscoverServer()
 
@@ -52,8 +57,31 @@ func main() {
 	pluginManager := plugin.NewManager()
 	plugin.SetGlobalManager(pluginManager)
 
+	// 记录设备上报的状态历史
+	historyRecorder := history.NewRecorder()
+	go historyRecorder.Run(ctx)
+
+	// 订阅设备上报的状态，设备影子在发布事件前已更新
+	bus := event.GetBus()
+	bus.Subscribe("websocket", event.DeviceStateHandler(wsServer.OnDeviceStateChange),
+		event.WithTypes(event.TypeDeviceStateChanged))
+	bus.Subscribe("task", taskManager.DeviceStateChange,
+		event.WithTypes(event.TypeDeviceStateChanged))
+	bus.Subscribe("history", event.DeviceStateHandler(historyRecorder.OnDeviceStateChange),
+		event.WithTypes(event.TypeDeviceStateChanged))
+	bus.Subscribe("energy", event.DeviceStateHandler(history.RecordEnergy),
+		event.WithTypes(event.TypeDeviceStateChanged))
+
+	// 启用时将设备状态桥接到 MQTT 服务器
+	if conf.MQTT.Enabled {
+		mqttBridge := mqtt.NewBridge(conf.MQTT, mqtt.NewClient(conf.MQTT))
+		bus.Subscribe("mqtt", event.DeviceStateHandler(mqttBridge.OnDeviceStateChange),
+			event.WithTypes(event.TypeDeviceStateChanged))
+		go mqttBridge.Run(ctx)
+	}
+
 	// 新建插件client并设为全局
-	pluginClient := plugin.NewClient(wsServer.OnDeviceStateChange, taskManager.DeviceStateChange, plugin.UpdateShadowReported)
+	pluginClient := plugin.NewClient()
 	plugin.SetGlobalClient(pluginClient)
 
 	// 新建服务发现
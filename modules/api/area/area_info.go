@@ -17,9 +17,11 @@ import (
 
 // infoResp 家庭详情接口返回数据
 type infoResp struct {
-	Name          string `json:"name"`           // 家庭名称
-	LocationCount int64  `json:"location_count"` // 该家庭的房间数量
-	RoleCount     int    `json:"role_count"`     // 该家庭的角色数量
+	Name          string  `json:"name"`           // 家庭名称
+	LocationCount int64   `json:"location_count"` // 该家庭的房间数量
+	RoleCount     int     `json:"role_count"`     // 该家庭的角色数量
+	Latitude      float64 `json:"latitude"`       // 纬度
+	Longitude     float64 `json:"longitude"`      // 经度
 }
 
 // InfoArea 用于处理家庭详情接口的请求
@@ -45,6 +47,8 @@ func InfoArea(c *gin.Context) {
 		return
 	}
 	resp.Name = area.Name
+	resp.Latitude = area.Latitude
+	resp.Longitude = area.Longitude
 
 	if locationCount, err = entity.GetLocationCount(session.Get(c).AreaID); err != nil {
 		if errors2.Is(err, gorm.ErrRecordNotFound) {
@@ -14,13 +14,20 @@ import (
 
 // UpdateAreaReq 修改家庭接口请求参数
 type UpdateAreaReq struct {
-	Name string `json:"name"`
+	Name      string   `json:"name"`
+	Latitude  *float64 `json:"latitude,omitempty"`  // 纬度，用于日出日落场景
+	Longitude *float64 `json:"longitude,omitempty"` // 经度，用于日出日落场景
 }
 
 func (req *UpdateAreaReq) Validate() (err error) {
 	if err = checkAreaName(req.Name); err != nil {
 		return
 	}
+	if req.Latitude != nil || req.Longitude != nil {
+		if err = checkAreaCoordinate(req.Latitude, req.Longitude); err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -58,6 +65,12 @@ func UpdateArea(c *gin.Context) {
 	if err = entity.UpdateArea(areaID, req.Name); err != nil {
 		return
 	}
+	if req.Latitude != nil && req.Longitude != nil {
+		if err = entity.UpdateAreaCoordinate(areaID, *req.Latitude, *req.Longitude); err != nil {
+			err = errors.Wrap(err, errors.InternalServerErr)
+			return
+		}
+	}
 	cloud.UpdateAreaName(areaID, req.Name)
 	return
 }
@@ -22,3 +22,16 @@ func checkAreaName(name string) (err error) {
 	}
 	return
 }
+
+// checkAreaCoordinate 校验家庭经纬度，经纬度需同时设置
+func checkAreaCoordinate(latitude, longitude *float64) (err error) {
+	if latitude == nil || longitude == nil {
+		err = errors.New(errors.BadRequest)
+		return
+	}
+	if *latitude < -90 || *latitude > 90 || *longitude < -180 || *longitude > 180 {
+		err = errors.New(errors.BadRequest)
+		return
+	}
+	return
+}
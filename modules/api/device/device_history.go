@@ -0,0 +1,128 @@
+package device
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+const (
+	// historyRangeDefault 未设置时间范围时返回最近一天的状态历史
+	historyRangeDefault = 24 * time.Hour
+	// historyPointLimit 最多返回的原始记录数
+	historyPointLimit = 5000
+	// historyBucketLimit 最多返回的降采样时间段数
+	historyBucketLimit = 2000
+)
+
+// deviceHistoryReq 设备状态历史接口请求参数
+type deviceHistoryReq struct {
+	InstanceID int    `form:"instance_id"`
+	Attribute  string `form:"attribute"`
+	StartTime  int64  `form:"start_time"` // 开始时间戳，默认为结束时间前一天
+	EndTime    int64  `form:"end_time"`   // 结束时间戳（不包含），默认为当前时间
+	Interval   int64  `form:"interval"`   // 降采样的时间段秒数，为0时返回原始记录
+}
+
+// deviceHistoryResp 设备状态历史接口返回数据，原始记录返回 points，降采样返回 buckets
+type deviceHistoryResp struct {
+	Points    []historyPoint             `json:"points,omitempty"`
+	Buckets   []entity.DeviceStateBucket `json:"buckets,omitempty"`
+	Truncated bool                       `json:"truncated"` // 原始记录超出数量限制，只返回最早的部分
+}
+
+// historyPoint 一条原始的状态记录
+type historyPoint struct {
+	Time int64           `json:"time"`
+	Val  json.RawMessage `json:"val"`
+}
+
+// DeviceHistory 用于处理设备状态历史接口的请求
+func DeviceHistory(c *gin.Context) {
+	var (
+		err  error
+		req  deviceHistoryReq
+		resp deviceHistoryResp
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	deviceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+	if err = c.BindQuery(&req); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	var q entity.DeviceStateQuery
+	if q, err = req.query(deviceID); err != nil {
+		return
+	}
+
+	if req.Interval == 0 {
+		var logs []entity.DeviceStateLog
+		if logs, err = entity.GetDeviceStateLogs(q, historyPointLimit+1); err != nil {
+			return
+		}
+		if len(logs) > historyPointLimit {
+			logs = logs[:historyPointLimit]
+			resp.Truncated = true
+		}
+		resp.Points = make([]historyPoint, 0, len(logs))
+		for _, l := range logs {
+			resp.Points = append(resp.Points, historyPoint{Time: l.ReportedAt, Val: json.RawMessage(l.Val)})
+		}
+		return
+	}
+	if resp.Buckets, err = entity.GetDeviceStateBuckets(q, req.Interval); err != nil {
+		return
+	}
+}
+
+// query 校验参数并生成查询条件
+func (req deviceHistoryReq) query(deviceID int) (q entity.DeviceStateQuery, err error) {
+	if req.Attribute == "" {
+		err = errors.Newf(status.DeviceHistoryParamIncorrect, "attribute")
+		return
+	}
+	q = entity.DeviceStateQuery{
+		DeviceID:   deviceID,
+		InstanceID: req.InstanceID,
+		Attribute:  req.Attribute,
+		EndTime:    time.Now(),
+	}
+	if req.EndTime != 0 {
+		q.EndTime = time.Unix(req.EndTime, 0)
+	}
+	q.StartTime = q.EndTime.Add(-historyRangeDefault)
+	if req.StartTime != 0 {
+		q.StartTime = time.Unix(req.StartTime, 0)
+	}
+	if !q.StartTime.Before(q.EndTime) {
+		err = errors.Newf(status.DeviceHistoryParamIncorrect, "start_time")
+		return
+	}
+
+	if req.Interval < 0 {
+		err = errors.Newf(status.DeviceHistoryParamIncorrect, "interval")
+		return
+	}
+	if req.Interval > 0 {
+		buckets := (q.EndTime.Unix() - q.StartTime.Unix()) / req.Interval
+		if buckets > historyBucketLimit {
+			err = errors.Newf(status.DeviceHistoryParamIncorrect, "interval")
+			return
+		}
+	}
+	return
+}
@@ -146,7 +146,8 @@ func getDeviceAttributes(userID int, device entity.Device) (as []entity.Attribut
 		return
 	}
 	for _, attr := range attributes {
-		if !up.IsDeviceAttrPermit(device.ID, attr) {
+		// 只读属性只能查看状态，不需要控制权限
+		if !attr.ReadOnly && !up.IsDeviceAttrPermit(device.ID, attr) {
 			continue
 		}
 		as = append(as, attr)
@@ -9,6 +9,7 @@ import (
 	"github.com/zhiting-tech/smartassistant/modules/types/status"
 	"github.com/zhiting-tech/smartassistant/modules/utils/session"
 	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"net/http"
 	"strconv"
 )
 
@@ -118,8 +119,12 @@ func ListLocationDevices(c *gin.Context) {
 }
 
 func WrapDevices(c *gin.Context, devices []entity.Device, listType listType) (result []Device, err error) {
+	return WrapUserDevices(c.Request, session.Get(c), devices, listType)
+}
+
+// WrapUserDevices 根据用户 u 的权限包装设备信息，req 用于生成设备图片及控制页地址
+func WrapUserDevices(req *http.Request, u *session.User, devices []entity.Device, listType listType) (result []Device, err error) {
 
-	u := session.Get(c)
 	up, err := entity.GetUserPermissions(u.UserID)
 	if err != nil {
 		return
@@ -138,7 +143,7 @@ func WrapDevices(c *gin.Context, devices []entity.Device, listType listType) (re
 			Identity:   d.Identity,
 			Name:       d.Name,
 			Logo:       plugin.GetGlobalClient().DeviceConfig(d).Logo,
-			LogoURL:    plugin.LogoURL(c.Request, d),
+			LogoURL:    plugin.LogoURL(req, d),
 			LocationID: d.LocationID,
 			Type:       d.Type,
 		}
@@ -150,7 +155,7 @@ func WrapDevices(c *gin.Context, devices []entity.Device, listType listType) (re
 			device.LocationName = location.Name
 			device.PluginID = d.PluginID
 			device.Control = plugin.RelativeControlPath(d, u.Token)
-			device.PluginURL = plugin.PluginURL(d, c.Request, u.Token)
+			device.PluginURL = plugin.PluginURL(d, req, u.Token)
 		}
 		result = append(result, device)
 
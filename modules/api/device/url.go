@@ -22,6 +22,7 @@ func RegisterDeviceRouter(r gin.IRouter) {
 	deviceAuthGroup.PUT(":id", requireBelongsToUser, UpdateDevice)
 	deviceAuthGroup.GET(":id", requireBelongsToUser, InfoDevice)
 	deviceAuthGroup.DELETE(":id", requireBelongsToUser, DelDevice)
+	deviceAuthGroup.GET(":id/history", requireBelongsToUser, DeviceHistory)
 
 	// 设备型号列表（按分类分组）
 	r.GET("device/types", TypeList)
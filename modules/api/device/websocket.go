@@ -0,0 +1,72 @@
+package device
+
+import (
+	"encoding/json"
+
+	"github.com/zhiting-tech/smartassistant/modules/api/middleware"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/modules/websocket"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// serviceListDevices 获取设备列表
+const serviceListDevices = "list_devices"
+
+// wsDeviceListReq 设备列表命令参数
+type wsDeviceListReq struct {
+	Type       listType `json:"type"`
+	LocationID int      `json:"location_id"` // 不为0时只返回该房间的设备
+}
+
+// RegisterWebsocketCmd 注册设备相关的 websocket 命令
+func RegisterWebsocketCmd() {
+	websocket.RegisterCallFunc(serviceListDevices, listDevicesCmd)
+}
+
+// listDevicesCmd 与设备列表、房间设备列表接口相同，获取家庭或房间的设备
+func listDevicesCmd(cs websocket.CallService) (result websocket.Result, err error) {
+	var (
+		req     wsDeviceListReq
+		devices []entity.Device
+		user    = cs.CallUser
+	)
+	if len(cs.ServiceData) != 0 {
+		if err = json.Unmarshal(cs.ServiceData, &req); err != nil {
+			err = errors.Wrap(err, errors.BadRequest)
+			return
+		}
+	}
+	if !middleware.IsScopePermit(user.Token, "device") {
+		err = errors.New(status.Deny)
+		return
+	}
+
+	if req.LocationID == 0 {
+		devices, err = entity.GetDevices(user.AreaID)
+	} else {
+		var location entity.Location
+		if location, err = entity.GetLocationByID(req.LocationID); err != nil {
+			return
+		}
+		if location.AreaID != user.AreaID {
+			err = errors.New(status.Deny)
+			return
+		}
+		devices, err = entity.GetDevicesByLocationID(req.LocationID)
+	}
+	if err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+
+	ds, err := WrapUserDevices(cs.Request, &user, devices, req.Type)
+	if err != nil {
+		return
+	}
+	if ds == nil {
+		ds = make([]Device, 0)
+	}
+	result = websocket.Result{"devices": ds}
+	return
+}
@@ -0,0 +1,110 @@
+package energy
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/modules/utils/session"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// 未设置日期范围时，按天统计最近 30 天，按月统计最近 12 个月
+	dayRangeDefault   = 30
+	monthRangeDefault = 12
+	// 日期范围最多的天数
+	dateRangeLimit = 3 * 366
+)
+
+// consumptionReq 用电量统计接口请求参数
+type consumptionReq struct {
+	Period     string `form:"period"` // 统计周期 day/month，默认为 day
+	StartDate  string `form:"start_date"`
+	EndDate    string `form:"end_date"`    // 包含结束日期，默认为今天
+	DeviceID   int    `form:"device_id"`   // 统计某个设备
+	LocationID int    `form:"location_id"` // 统计某个房间的所有设备
+}
+
+// consumptionResp 用电量统计接口返回数据
+type consumptionResp struct {
+	Period string                     `json:"period"`
+	Total  float64                    `json:"total"` // 日期范围内的总用电量，单位 kWh
+	Items  []entity.EnergyConsumption `json:"items"`
+}
+
+// ListConsumption 用于处理用电量统计接口的请求，按天或按月统计家庭、房间或设备的用电量
+func ListConsumption(c *gin.Context) {
+	var (
+		err  error
+		req  consumptionReq
+		resp consumptionResp
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	if err = c.BindQuery(&req); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+	var q entity.EnergyQuery
+	if q, err = req.query(session.Get(c).AreaID, time.Now()); err != nil {
+		return
+	}
+
+	resp.Period = req.Period
+	if resp.Items, err = entity.GetEnergyConsumptions(q, req.Period); err != nil {
+		return
+	}
+	for _, item := range resp.Items {
+		resp.Total += item.Consumption
+	}
+	if resp.Items == nil {
+		resp.Items = make([]entity.EnergyConsumption, 0)
+	}
+}
+
+// query 校验参数并生成家庭 areaID 的查询条件
+func (req *consumptionReq) query(areaID uint64, now time.Time) (q entity.EnergyQuery, err error) {
+	if req.Period == "" {
+		req.Period = entity.EnergyPeriodDay
+	}
+	if req.Period != entity.EnergyPeriodDay && req.Period != entity.EnergyPeriodMonth {
+		err = errors.Newf(status.EnergyParamIncorrect, "period")
+		return
+	}
+
+	q = entity.EnergyQuery{
+		AreaID:     areaID,
+		DeviceID:   req.DeviceID,
+		LocationID: req.LocationID,
+		EndDate:    now,
+	}
+	if req.EndDate != "" {
+		if q.EndDate, err = time.ParseInLocation(dateLayout, req.EndDate, time.Local); err != nil {
+			err = errors.Wrapf(err, status.EnergyParamIncorrect, "end_date")
+			return
+		}
+	}
+	if req.StartDate != "" {
+		if q.StartDate, err = time.ParseInLocation(dateLayout, req.StartDate, time.Local); err != nil {
+			err = errors.Wrapf(err, status.EnergyParamIncorrect, "start_date")
+			return
+		}
+	} else if req.Period == entity.EnergyPeriodMonth {
+		// 从 monthRangeDefault-1 个月前的1号开始
+		q.StartDate = time.Date(q.EndDate.Year(), q.EndDate.Month()-monthRangeDefault+1, 1, 0, 0, 0, 0, time.Local)
+	} else {
+		q.StartDate = q.EndDate.AddDate(0, 0, -dayRangeDefault+1)
+	}
+
+	if q.StartDate.After(q.EndDate) || q.EndDate.Sub(q.StartDate) > dateRangeLimit*24*time.Hour {
+		err = errors.Newf(status.EnergyParamIncorrect, "start_date")
+		return
+	}
+	return
+}
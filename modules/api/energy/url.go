@@ -0,0 +1,13 @@
+// Package energy 设备用电量统计
+package energy
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zhiting-tech/smartassistant/modules/api/middleware"
+)
+
+// RegisterEnergyRouter 注册与用电量相关的路由及其处理函数
+func RegisterEnergyRouter(r gin.IRouter) {
+	energyGroup := r.Group("energy", middleware.RequireAccount, middleware.WithScope("device"))
+	energyGroup.GET("consumption", ListConsumption)
+}
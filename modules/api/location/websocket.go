@@ -0,0 +1,30 @@
+package location
+
+import (
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/websocket"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// serviceListLocations 获取房间列表
+const serviceListLocations = "list_locations"
+
+// RegisterWebsocketCmd 注册房间相关的 websocket 命令
+func RegisterWebsocketCmd() {
+	websocket.RegisterCallFunc(serviceListLocations, listLocationsCmd)
+}
+
+// listLocationsCmd 与房间列表接口相同，获取家庭的所有房间
+func listLocationsCmd(cs websocket.CallService) (result websocket.Result, err error) {
+	locations, err := entity.GetLocations(cs.CallUser.AreaID)
+	if err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	ls := WrapLocations(locations)
+	if ls == nil {
+		ls = make([]Location, 0)
+	}
+	result = websocket.Result{"locations": ls}
+	return
+}
@@ -70,9 +70,7 @@ func RequireOwner(c *gin.Context) {
 // WithScope 校验用户权限
 func WithScope(scope string) func(ctx *gin.Context) {
 	return func(ctx *gin.Context) {
-		accessToken := ctx.GetHeader(types.SATokenKey)
-		ti, _ := oauth.GetOauthServer().Manager.LoadAccessToken(accessToken)
-		if !strings.Contains(ti.GetScope(), scope) {
+		if !IsScopePermit(ctx.GetHeader(types.SATokenKey), scope) {
 			err := errors.New(status.Deny)
 			response.HandleResponse(ctx, err, nil)
 			ctx.Abort()
@@ -82,6 +80,15 @@ func WithScope(scope string) func(ctx *gin.Context) {
 
 }
 
+// IsScopePermit 判断 token 是否有 scope 的授权
+func IsScopePermit(accessToken, scope string) bool {
+	ti, err := oauth.GetOauthServer().Manager.LoadAccessToken(accessToken)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(ti.GetScope(), scope)
+}
+
 // RequireToken 使用token验证身份，不依赖cookies.
 func RequireToken(c *gin.Context) {
 
@@ -7,6 +7,7 @@ import (
 	"github.com/zhiting-tech/smartassistant/modules/api/brand"
 	"github.com/zhiting-tech/smartassistant/modules/api/cloud"
 	"github.com/zhiting-tech/smartassistant/modules/api/device"
+	"github.com/zhiting-tech/smartassistant/modules/api/energy"
 	"github.com/zhiting-tech/smartassistant/modules/api/location"
 	"github.com/zhiting-tech/smartassistant/modules/api/middleware"
 	"github.com/zhiting-tech/smartassistant/modules/api/page"
@@ -27,6 +28,7 @@ func loadModules(r gin.IRouter) {
 	location.RegisterLocationRouter(r)
 	brand.RegisterBrandRouter(r)
 	device.RegisterDeviceRouter(r)
+	energy.RegisterEnergyRouter(r)
 	area.RegisterAreaRouter(r)
 	user.RegisterUserRouter(r)
 	scope.RegisterScopeRouter(r)
@@ -0,0 +1,74 @@
+package scene
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/blueprint"
+	"github.com/zhiting-tech/smartassistant/modules/task"
+	"github.com/zhiting-tech/smartassistant/modules/utils/session"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// ImportBlueprintReq 导入场景蓝图接口请求参数
+type ImportBlueprintReq struct {
+	Blueprint string             `json:"blueprint"` // YAML 或 JSON 格式的蓝图
+	Name      string             `json:"name"`      // 场景名称，为空时使用蓝图名称
+	Bindings  blueprint.Bindings `json:"bindings"`  // 蓝图参数名 -> 设备id或场景id
+}
+
+// ImportBlueprintResp 导入场景蓝图接口返回数据
+type ImportBlueprintResp struct {
+	SceneID int `json:"scene_id"`
+}
+
+// ImportBlueprint 用于处理导入场景蓝图接口的请求，将蓝图参数绑定到家庭中的设备后创建场景
+func ImportBlueprint(c *gin.Context) {
+	var (
+		req  ImportBlueprintReq
+		resp ImportBlueprintResp
+		err  error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	if err = c.BindJSON(&req); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	bp, err := blueprint.Parse([]byte(req.Blueprint))
+	if err != nil {
+		return
+	}
+	scene, conditions, err := bp.Bind(session.Get(c).AreaID, req.Bindings, time.Now())
+	if err != nil {
+		return
+	}
+	if req.Name != "" {
+		scene.Name = req.Name
+	}
+
+	// 与创建场景相同的校验，包括用户对设备和场景的控制权限
+	createReq := CreateSceneReq{
+		SceneInfo: SceneInfo{
+			Scene:           scene,
+			SceneConditions: conditions,
+			EffectStartTime: scene.EffectStart.Unix(),
+			EffectEndTime:   scene.EffectEnd.Unix(),
+		},
+	}
+	if err = createReq.check(c); err != nil {
+		return
+	}
+	if err = createReq.createScene(c); err != nil {
+		return
+	}
+	if createReq.AutoRun {
+		task.GetManager().AddSceneTask(createReq.Scene)
+	}
+	resp.SceneID = createReq.Scene.ID
+}
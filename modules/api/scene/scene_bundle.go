@@ -0,0 +1,686 @@
+package scene
+
+import (
+	"encoding/json"
+	errors2 "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"gorm.io/gorm"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+)
+
+// bundleVersion 场景导出文件的格式版本
+const bundleVersion = 1
+
+const (
+	refTypeDevice = "device"
+	refTypeScene  = "scene"
+)
+
+// authHeaderKeywords 名称包含这些词的 webhook 请求头视为认证信息，导出时不包含其值
+var authHeaderKeywords = []string{"auth", "cookie", "token", "secret", "key", "signature"}
+
+// SceneBundle 导出的场景文件，设备通过 Identity 和 PluginID 引用，可导入到其他家庭或SA
+type SceneBundle struct {
+	Version    int            `json:"version" yaml:"version"`
+	ExportedAt int64          `json:"exported_at" yaml:"exported_at"`
+	Devices    []BundleDevice `json:"devices" yaml:"devices"`
+	Scenes     []BundleScene  `json:"scenes" yaml:"scenes"`
+}
+
+// BundleDevice 场景引用的设备
+type BundleDevice struct {
+	Ref      string `json:"ref" yaml:"ref"` // 文件内引用设备的标识
+	Identity string `json:"identity" yaml:"identity"`
+	PluginID string `json:"plugin_id" yaml:"plugin_id"`
+	Name     string `json:"name" yaml:"name"`
+	Model    string `json:"model" yaml:"model"`
+	Type     string `json:"type" yaml:"type"`
+}
+
+// BundleScene 导出的场景
+type BundleScene struct {
+	Ref            string                 `json:"ref" yaml:"ref"` // 文件内引用场景的标识
+	Name           string                 `json:"name" yaml:"name"`
+	AutoRun        bool                   `json:"auto_run" yaml:"auto_run"`
+	ConditionLogic int                    `json:"condition_logic" yaml:"condition_logic"`
+	ConditionTree  *entity.ConditionGroup `json:"condition_tree,omitempty" yaml:"condition_tree,omitempty"`
+	Mode           entity.SceneMode       `json:"mode" yaml:"mode"`
+	MaxRuns        int                    `json:"max_runs" yaml:"max_runs"`
+
+	TimePeriodType  entity.TimePeriodType `json:"time_period" yaml:"time_period"`
+	EffectStartTime int64                 `json:"effect_start_time" yaml:"effect_start_time"`
+	EffectEndTime   int64                 `json:"effect_end_time" yaml:"effect_end_time"`
+	RepeatType      entity.RepeatType     `json:"repeat_type" yaml:"repeat_type"`
+	RepeatDate      string                `json:"repeat_date" yaml:"repeat_date"`
+
+	Conditions []BundleCondition `json:"scene_conditions" yaml:"scene_conditions"`
+	Tasks      []BundleTask      `json:"scene_tasks" yaml:"scene_tasks"`
+}
+
+// BundleAttr 设备属性
+type BundleAttr struct {
+	InstanceID int         `json:"instance_id" yaml:"instance_id"`
+	Attribute  string      `json:"attribute" yaml:"attribute"`
+	Val        interface{} `json:"val" yaml:"val"`
+}
+
+// BundleCondition 导出的触发条件
+type BundleCondition struct {
+	ConditionType entity.ConditionType  `json:"condition_type" yaml:"condition_type"`
+	Key           string                `json:"key,omitempty" yaml:"key,omitempty"`
+	Timing        int64                 `json:"timing,omitempty" yaml:"timing,omitempty"`
+	SolarEvent    entity.SolarEventType `json:"solar_event,omitempty" yaml:"solar_event,omitempty"`
+	SolarOffset   int                   `json:"solar_offset,omitempty" yaml:"solar_offset,omitempty"`
+	CronExpr      string                `json:"cron_expr,omitempty" yaml:"cron_expr,omitempty"`
+	Device        string                `json:"device,omitempty" yaml:"device,omitempty"` // 引用的设备
+	Operator      entity.OperatorType   `json:"operator,omitempty" yaml:"operator,omitempty"`
+	Attribute     *BundleAttr           `json:"condition_attr,omitempty" yaml:"condition_attr,omitempty"`
+	Duration      int                   `json:"duration,omitempty" yaml:"duration,omitempty"`
+}
+
+// BundleTask 导出的执行任务
+type BundleTask struct {
+	Type         entity.TaskType `json:"type" yaml:"type"`
+	DelaySeconds int             `json:"delay_seconds" yaml:"delay_seconds"`
+	Device       string          `json:"device,omitempty" yaml:"device,omitempty"` // 引用的设备
+	Attributes   []BundleAttr    `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	// 控制的场景在文件中时通过 ControlScene 引用，否则导入时按名称在家庭中查找
+	ControlScene     string `json:"control_scene,omitempty" yaml:"control_scene,omitempty"`
+	ControlSceneName string `json:"control_scene_name,omitempty" yaml:"control_scene_name,omitempty"`
+
+	// 流程控制步骤
+	Condition       *BundleCondition `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Then            []BundleTask     `json:"then,omitempty" yaml:"then,omitempty"`
+	Else            []BundleTask     `json:"else,omitempty" yaml:"else,omitempty"`
+	TimeoutSeconds  int              `json:"timeout_seconds,omitempty" yaml:"timeout_seconds,omitempty"` // 等待的最长秒数或设备任务的超时秒数
+	RepeatTimes     int              `json:"repeat_times,omitempty" yaml:"repeat_times,omitempty"`
+	IntervalSeconds int              `json:"interval_seconds,omitempty" yaml:"interval_seconds,omitempty"`
+
+	Notification *BundleNotification `json:"notification,omitempty" yaml:"notification,omitempty"`
+}
+
+// BundleNotification 导出的通知任务，webhook 的签名密钥和认证请求头的值不导出，导入前需要重新填写
+type BundleNotification struct {
+	entity.Notification `yaml:",inline"`
+	// SecretRequired 导出的通知设置了签名密钥，导入时需要填写 secret
+	SecretRequired bool `json:"secret_required,omitempty" yaml:"secret_required,omitempty"`
+}
+
+// UnresolvedRef 导入时无法在家庭中找到的设备或场景
+type UnresolvedRef struct {
+	Scene string `json:"scene"` // 引用所在的场景名称
+	Type  string `json:"type"`  // device, scene
+	Ref   string `json:"ref"`
+	Name  string `json:"name"`
+}
+
+func deviceRef(deviceID int) string {
+	return fmt.Sprintf("device_%d", deviceID)
+}
+
+func sceneRef(sceneID int) string {
+	return fmt.Sprintf("scene_%d", sceneID)
+}
+
+// newSceneBundle 导出场景，scenes 需要包含触发条件和执行任务
+func newSceneBundle(scenes []entity.Scene) (bundle SceneBundle, err error) {
+	bundle = SceneBundle{
+		Version:    bundleVersion,
+		ExportedAt: time.Now().Unix(),
+		Devices:    make([]BundleDevice, 0),
+		Scenes:     make([]BundleScene, 0, len(scenes)),
+	}
+	devices := make(map[int]bool)
+	addDevice := func(deviceID int) (ref string, err error) {
+		ref = deviceRef(deviceID)
+		if devices[deviceID] {
+			return
+		}
+		device, err := entity.GetDeviceByIDWithUnscoped(deviceID)
+		if err != nil {
+			return
+		}
+		devices[deviceID] = true
+		bundle.Devices = append(bundle.Devices, BundleDevice{
+			Ref:      ref,
+			Identity: device.Identity,
+			PluginID: device.PluginID,
+			Name:     device.Name,
+			Model:    device.Model,
+			Type:     device.Type,
+		})
+		return
+	}
+
+	for _, scene := range scenes {
+		bs := BundleScene{
+			Ref:             sceneRef(scene.ID),
+			Name:            scene.Name,
+			AutoRun:         scene.AutoRun,
+			ConditionLogic:  scene.ConditionLogic,
+			Mode:            scene.Mode,
+			MaxRuns:         scene.MaxRuns,
+			TimePeriodType:  scene.TimePeriodType,
+			EffectStartTime: scene.EffectStart.Unix(),
+			EffectEndTime:   scene.EffectEnd.Unix(),
+			RepeatType:      scene.RepeatType,
+			RepeatDate:      scene.RepeatDate,
+			Conditions:      make([]BundleCondition, 0),
+			Tasks:           make([]BundleTask, 0),
+		}
+		tree, ok, e := scene.GetConditionTree()
+		if e != nil {
+			return bundle, e
+		}
+		if ok {
+			bs.ConditionTree = &tree
+		}
+
+		for _, c := range scene.SceneConditions {
+			var bc BundleCondition
+			if bc, err = newBundleCondition(c, addDevice); err != nil {
+				return
+			}
+			bs.Conditions = append(bs.Conditions, bc)
+		}
+
+		for _, t := range scene.SceneTasks {
+			var bt BundleTask
+			if bt, err = newBundleTask(t, addDevice); err != nil {
+				return
+			}
+			bs.Tasks = append(bs.Tasks, bt)
+		}
+		bundle.Scenes = append(bundle.Scenes, bs)
+	}
+	return
+}
+
+// newBundleCondition 导出触发条件，addDevice 添加引用的设备并返回设备引用
+func newBundleCondition(c entity.SceneCondition, addDevice func(int) (string, error)) (bc BundleCondition, err error) {
+	bc = BundleCondition{
+		ConditionType: c.ConditionType,
+		Key:           c.Key,
+		SolarEvent:    c.SolarEvent,
+		SolarOffset:   c.SolarOffset,
+		CronExpr:      c.CronExpr,
+		Operator:      c.Operator,
+		Duration:      c.Duration,
+	}
+	if c.ConditionType == entity.ConditionTypeTiming {
+		bc.Timing = c.TimingAt.Unix()
+	}
+	if c.ConditionType == entity.ConditionTypeDeviceStatus {
+		if bc.Device, err = addDevice(c.DeviceID); err != nil {
+			return
+		}
+		var attr entity.Attribute
+		if err = json.Unmarshal(c.ConditionAttr, &attr); err != nil {
+			return
+		}
+		bc.Attribute = &BundleAttr{InstanceID: attr.InstanceID, Attribute: attr.Attribute.Attribute, Val: attr.Val}
+	}
+	if c.ConditionType == entity.ConditionTypeWebhook {
+		// webhook 地址的密钥属于场景，不导出
+		var (
+			filter entity.Attribute
+			ok     bool
+		)
+		if filter, ok, err = c.WebhookFilter(); err != nil || !ok {
+			return
+		}
+		bc.Attribute = &BundleAttr{Attribute: filter.Attribute.Attribute, Val: filter.Val}
+	}
+	return
+}
+
+// newBundleTask 导出执行任务，流程控制步骤同时导出嵌套的步骤
+func newBundleTask(t entity.SceneTask, addDevice func(int) (string, error)) (bt BundleTask, err error) {
+	bt = BundleTask{Type: t.Type, DelaySeconds: t.DelaySeconds}
+	switch {
+	case t.Type == entity.TaskTypeSmartDevice:
+		if bt.Device, err = addDevice(t.DeviceID); err != nil {
+			return
+		}
+		bt.TimeoutSeconds = t.TimeoutSeconds
+		var attrs []entity.Attribute
+		if err = json.Unmarshal(t.Attributes, &attrs); err != nil {
+			return
+		}
+		for _, attr := range attrs {
+			bt.Attributes = append(bt.Attributes,
+				BundleAttr{InstanceID: attr.InstanceID, Attribute: attr.Attribute.Attribute, Val: attr.Val})
+		}
+	case t.IsControlStep():
+		bt.TimeoutSeconds = t.TimeoutSeconds
+		bt.RepeatTimes = t.RepeatTimes
+		bt.IntervalSeconds = t.IntervalSeconds
+		if t.Type != entity.TaskTypeRepeat {
+			var c entity.SceneCondition
+			if c, err = t.GetCondition(); err != nil {
+				return
+			}
+			var bc BundleCondition
+			if bc, err = newBundleCondition(c, addDevice); err != nil {
+				return
+			}
+			bt.Condition = &bc
+		}
+		var thenSteps, elseSteps []entity.SceneTask
+		if thenSteps, err = t.GetThen(); err != nil {
+			return
+		}
+		if elseSteps, err = t.GetElse(); err != nil {
+			return
+		}
+		if bt.Then, err = newBundleTasks(thenSteps, addDevice); err != nil {
+			return
+		}
+		bt.Else, err = newBundleTasks(elseSteps, addDevice)
+	case t.IsNotification():
+		var n entity.Notification
+		if n, err = t.GetNotification(); err != nil {
+			return
+		}
+		bn := newBundleNotification(n)
+		bt.Notification = &bn
+	default:
+		var controlScene entity.Scene
+		if controlScene, err = entity.GetSceneByIDWithUnscoped(t.ControlSceneID); err != nil {
+			return
+		}
+		bt.ControlScene = sceneRef(t.ControlSceneID)
+		bt.ControlSceneName = controlScene.Name
+	}
+	return
+}
+
+// newBundleNotification 导出通知任务，去掉签名密钥和认证请求头的值
+func newBundleNotification(n entity.Notification) (bn BundleNotification) {
+	bn.Notification = n
+	if n.Secret != "" {
+		bn.Secret = ""
+		bn.SecretRequired = true
+	}
+	if len(n.Headers) != 0 {
+		bn.Headers = make(map[string]string, len(n.Headers))
+		for k, v := range n.Headers {
+			if isAuthHeader(k) {
+				v = ""
+			}
+			bn.Headers[k] = v
+		}
+	}
+	return
+}
+
+// isAuthHeader 请求头是否为认证信息
+func isAuthHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, keyword := range authHeaderKeywords {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// check 校验导入的通知任务已重新填写签名密钥和认证请求头
+func (bn BundleNotification) check() (err error) {
+	if bn.SecretRequired && bn.Secret == "" {
+		return errors.Newf(status.SceneParamIncorrectErr, "webhook 签名密钥")
+	}
+	for k, v := range bn.Headers {
+		if v == "" && isAuthHeader(k) {
+			return errors.Newf(status.SceneParamIncorrectErr, "webhook 请求头 "+k)
+		}
+	}
+	return
+}
+
+func newBundleTasks(tasks []entity.SceneTask, addDevice func(int) (string, error)) (bts []BundleTask, err error) {
+	for _, t := range tasks {
+		var bt BundleTask
+		if bt, err = newBundleTask(t, addDevice); err != nil {
+			return
+		}
+		bts = append(bts, bt)
+	}
+	return
+}
+
+// leafTasks 获取控制设备或场景的任务，流程控制步骤返回其嵌套的所有任务
+func (t BundleTask) leafTasks() (tasks []BundleTask) {
+	st := entity.SceneTask{Type: t.Type}
+	if st.IsNotification() {
+		return
+	}
+	if !st.IsControlStep() {
+		return []BundleTask{t}
+	}
+	for _, step := range append(append([]BundleTask{}, t.Then...), t.Else...) {
+		tasks = append(tasks, step.leafTasks()...)
+	}
+	return
+}
+
+// stepConditions 获取流程控制步骤及其嵌套的所有步骤的条件
+func (t BundleTask) stepConditions() (conditions []BundleCondition) {
+	if t.Condition != nil {
+		conditions = append(conditions, *t.Condition)
+	}
+	for _, step := range append(append([]BundleTask{}, t.Then...), t.Else...) {
+		conditions = append(conditions, step.stepConditions()...)
+	}
+	return
+}
+
+// parseSceneBundle 解析 JSON 或 YAML 格式的场景文件
+func parseSceneBundle(data []byte) (bundle SceneBundle, err error) {
+	if err = yaml.Unmarshal(data, &bundle); err != nil {
+		err = errors.Wrapf(err, status.SceneParamIncorrectErr, "场景文件")
+		return
+	}
+	if bundle.Version != bundleVersion || len(bundle.Scenes) == 0 {
+		err = errors.Newf(status.SceneParamIncorrectErr, "场景文件")
+		return
+	}
+	return
+}
+
+// bundleResolver 将场景文件中引用的设备和场景对应到家庭中
+type bundleResolver struct {
+	areaID     uint64
+	devices    map[string]int // 设备引用 -> 家庭中的设备id
+	scenes     map[string]int // 不在文件中的场景引用 -> 家庭中的场景id
+	bundled    map[string]bool
+	unresolved []UnresolvedRef
+}
+
+// resolve 查找文件中引用的设备和场景，deviceMap 可以手动指定设备引用对应的设备id
+func (bundle SceneBundle) resolve(areaID uint64, deviceMap map[string]int) (r *bundleResolver, err error) {
+	r = &bundleResolver{
+		areaID:     areaID,
+		devices:    make(map[string]int),
+		scenes:     make(map[string]int),
+		bundled:    make(map[string]bool),
+		unresolved: make([]UnresolvedRef, 0),
+	}
+	bundleDevices := make(map[string]BundleDevice)
+	for _, d := range bundle.Devices {
+		bundleDevices[d.Ref] = d
+	}
+	for _, s := range bundle.Scenes {
+		r.bundled[s.Ref] = true
+	}
+
+	for _, s := range bundle.Scenes {
+		for _, c := range s.Conditions {
+			if c.ConditionType != entity.ConditionTypeDeviceStatus {
+				continue
+			}
+			if err = r.resolveDevice(s.Name, bundleDevices[c.Device], c.Device, deviceMap); err != nil {
+				return
+			}
+		}
+		for _, st := range s.Tasks {
+			// 流程控制步骤（包括嵌套的步骤）的条件引用的设备
+			for _, c := range st.stepConditions() {
+				if err = r.resolveDevice(s.Name, bundleDevices[c.Device], c.Device, deviceMap); err != nil {
+					return
+				}
+			}
+			for _, t := range st.leafTasks() {
+				if t.Type == entity.TaskTypeSmartDevice {
+					err = r.resolveDevice(s.Name, bundleDevices[t.Device], t.Device, deviceMap)
+				} else {
+					err = r.resolveScene(s.Name, t)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+func (r *bundleResolver) resolveDevice(sceneName string, d BundleDevice, ref string, deviceMap map[string]int) (err error) {
+	if _, ok := r.devices[ref]; ok {
+		return
+	}
+	if id, ok := deviceMap[ref]; ok {
+		var device entity.Device
+		if device, err = entity.GetDeviceByID(id); err != nil || device.AreaID != r.areaID {
+			return errors.New(status.DeviceNotExist)
+		}
+		r.devices[ref] = id
+		return
+	}
+	device, err := entity.GetPluginDevice(r.areaID, d.PluginID, d.Identity)
+	if err != nil {
+		if !errors2.Is(err, gorm.ErrRecordNotFound) {
+			return errors.Wrap(err, errors.InternalServerErr)
+		}
+		r.unresolved = append(r.unresolved, UnresolvedRef{Scene: sceneName, Type: refTypeDevice, Ref: ref, Name: d.Name})
+		return nil
+	}
+	r.devices[ref] = device.ID
+	return
+}
+
+func (r *bundleResolver) resolveScene(sceneName string, t BundleTask) (err error) {
+	if r.bundled[t.ControlScene] {
+		return
+	}
+	if _, ok := r.scenes[t.ControlScene]; ok {
+		return
+	}
+	var scene entity.Scene
+	err = entity.GetDBWithAreaScope(r.areaID).Where("name=?", t.ControlSceneName).First(&scene).Error
+	if err != nil {
+		if !errors2.Is(err, gorm.ErrRecordNotFound) {
+			return errors.Wrap(err, errors.InternalServerErr)
+		}
+		r.unresolved = append(r.unresolved, UnresolvedRef{Scene: sceneName, Type: refTypeScene, Ref: t.ControlScene, Name: t.ControlSceneName})
+		return nil
+	}
+	r.scenes[t.ControlScene] = scene.ID
+	return
+}
+
+// importOrder 场景的导入顺序，控制文件中其他场景的场景在其后导入
+func (bundle SceneBundle) importOrder() (order []BundleScene, err error) {
+	scenes := make(map[string]BundleScene)
+	for _, s := range bundle.Scenes {
+		if _, ok := scenes[s.Ref]; ok {
+			return nil, errors.Newf(status.SceneParamIncorrectErr, "场景文件")
+		}
+		scenes[s.Ref] = s
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(s BundleScene) error
+	visit = func(s BundleScene) error {
+		switch state[s.Ref] {
+		case visiting:
+			// 场景之间互相控制时无法确定导入顺序
+			return errors.Newf(status.SceneParamIncorrectErr, "场景之间的控制关系")
+		case visited:
+			return nil
+		}
+		state[s.Ref] = visiting
+		for _, st := range s.Tasks {
+			for _, t := range st.leafTasks() {
+				if dep, ok := scenes[t.ControlScene]; ok && t.Type != entity.TaskTypeSmartDevice {
+					if err := visit(dep); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		state[s.Ref] = visited
+		order = append(order, s)
+		return nil
+	}
+	for _, s := range bundle.Scenes {
+		if err = visit(s); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// createSceneReq 生成导入场景的创建请求，sceneIDs 为已导入的文件中的场景
+func (r *bundleResolver) createSceneReq(s BundleScene, sceneIDs map[string]int) (req CreateSceneReq, err error) {
+	req.Scene = entity.Scene{
+		Name:           s.Name,
+		AutoRun:        s.AutoRun,
+		ConditionLogic: s.ConditionLogic,
+		Mode:           s.Mode,
+		MaxRuns:        s.MaxRuns,
+		TimePeriodType: s.TimePeriodType,
+		RepeatType:     s.RepeatType,
+		RepeatDate:     s.RepeatDate,
+	}
+	req.EffectStartTime = s.EffectStartTime
+	req.EffectEndTime = s.EffectEndTime
+	if s.ConditionTree != nil {
+		if req.Scene.ConditionTree, err = json.Marshal(s.ConditionTree); err != nil {
+			return
+		}
+	}
+
+	for _, c := range s.Conditions {
+		var ci entity.ConditionInfo
+		if ci, err = r.conditionInfo(c); err != nil {
+			return
+		}
+		req.SceneConditions = append(req.SceneConditions, ci)
+	}
+
+	for _, t := range s.Tasks {
+		var st entity.SceneTask
+		if st, err = r.sceneTask(t, sceneIDs); err != nil {
+			return
+		}
+		req.SceneTasks = append(req.SceneTasks, st)
+	}
+	return
+}
+
+// conditionInfo 生成导入场景的触发条件
+func (r *bundleResolver) conditionInfo(c BundleCondition) (ci entity.ConditionInfo, err error) {
+	ci = entity.ConditionInfo{
+		SceneCondition: entity.SceneCondition{
+			ConditionType: c.ConditionType,
+			Key:           c.Key,
+			SolarEvent:    c.SolarEvent,
+			SolarOffset:   c.SolarOffset,
+			CronExpr:      c.CronExpr,
+			Operator:      c.Operator,
+			Duration:      c.Duration,
+		},
+		Timing: c.Timing,
+	}
+	if c.ConditionType == entity.ConditionTypeDeviceStatus {
+		if c.Attribute == nil {
+			err = errors.Newf(status.SceneParamIncorrectErr, "场景文件")
+			return
+		}
+		ci.DeviceID = r.devices[c.Device]
+		if ci.ConditionAttr, err = json.Marshal(c.Attribute.toAttribute()); err != nil {
+			return
+		}
+	}
+	if c.ConditionType == entity.ConditionTypeWebhook && c.Attribute != nil {
+		if ci.ConditionAttr, err = json.Marshal(c.Attribute.toAttribute()); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// sceneTask 生成导入场景的执行任务
+func (r *bundleResolver) sceneTask(t BundleTask, sceneIDs map[string]int) (st entity.SceneTask, err error) {
+	st = entity.SceneTask{Type: t.Type, DelaySeconds: t.DelaySeconds}
+	switch {
+	case t.Type == entity.TaskTypeSmartDevice:
+		st.DeviceID = r.devices[t.Device]
+		st.TimeoutSeconds = t.TimeoutSeconds
+		attrs := make([]entity.Attribute, 0, len(t.Attributes))
+		for _, a := range t.Attributes {
+			attrs = append(attrs, a.toAttribute())
+		}
+		if st.Attributes, err = json.Marshal(attrs); err != nil {
+			return
+		}
+	case st.IsControlStep():
+		st.TimeoutSeconds = t.TimeoutSeconds
+		st.RepeatTimes = t.RepeatTimes
+		st.IntervalSeconds = t.IntervalSeconds
+		if t.Condition != nil {
+			var ci entity.ConditionInfo
+			if ci, err = r.conditionInfo(*t.Condition); err != nil {
+				return
+			}
+			if st.Condition, err = json.Marshal(ci.SceneCondition); err != nil {
+				return
+			}
+		}
+		if st.Then, err = r.sceneSteps(t.Then, sceneIDs); err != nil {
+			return
+		}
+		st.Else, err = r.sceneSteps(t.Else, sceneIDs)
+	case st.IsNotification():
+		if t.Notification == nil {
+			err = errors.Newf(status.SceneParamIncorrectErr, "场景文件")
+			return
+		}
+		if err = t.Notification.check(); err != nil {
+			return
+		}
+		st.Notification, err = json.Marshal(t.Notification.Notification)
+	default:
+		if id, ok := sceneIDs[t.ControlScene]; ok {
+			st.ControlSceneID = id
+		} else {
+			st.ControlSceneID = r.scenes[t.ControlScene]
+		}
+	}
+	return
+}
+
+// sceneSteps 生成流程控制步骤嵌套的步骤
+func (r *bundleResolver) sceneSteps(tasks []BundleTask, sceneIDs map[string]int) (data []byte, err error) {
+	if len(tasks) == 0 {
+		return
+	}
+	steps := make([]entity.SceneTask, 0, len(tasks))
+	for _, t := range tasks {
+		var st entity.SceneTask
+		if st, err = r.sceneTask(t, sceneIDs); err != nil {
+			return
+		}
+		steps = append(steps, st)
+	}
+	return json.Marshal(steps)
+}
+
+func (a BundleAttr) toAttribute() entity.Attribute {
+	return entity.Attribute{
+		Attribute:  server.Attribute{Attribute: a.Attribute, Val: a.Val},
+		InstanceID: a.InstanceID,
+	}
+}
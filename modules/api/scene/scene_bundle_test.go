@@ -0,0 +1,126 @@
+package scene
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"gopkg.in/yaml.v2"
+)
+
+const testBundle = `
+version: 1
+devices:
+  - ref: device_1
+    identity: "0x0001"
+    plugin_id: demo
+    name: 客厅灯
+scenes:
+  - ref: scene_2
+    name: 晚安
+    scene_tasks:
+      - type: 4
+        control_scene: scene_1
+        control_scene_name: 回家
+  - ref: scene_1
+    name: 回家
+    scene_tasks:
+      - type: 1
+        device: device_1
+        attributes:
+          - instance_id: 1
+            attribute: power
+            val: "on"
+`
+
+func TestSceneBundleImportOrder(t *testing.T) {
+	bundle, err := parseSceneBundle([]byte(testBundle))
+	assert.Nil(t, err)
+	assert.Equal(t, "0x0001", bundle.Devices[0].Identity)
+
+	// 被控制的场景先导入
+	order, err := bundle.importOrder()
+	assert.Nil(t, err)
+	assert.Equal(t, "scene_1", order[0].Ref)
+	assert.Equal(t, "scene_2", order[1].Ref)
+
+	// 场景互相控制
+	bundle.Scenes[1].Tasks = append(bundle.Scenes[1].Tasks,
+		BundleTask{Type: entity.TaskTypeEnableAutoRun, ControlScene: "scene_2"})
+	_, err = bundle.importOrder()
+	assert.NotNil(t, err)
+
+	_, err = parseSceneBundle([]byte(`{"version":2,"scenes":[]}`))
+	assert.NotNil(t, err)
+}
+
+func TestSceneBundleCreateReq(t *testing.T) {
+	bundle, err := parseSceneBundle([]byte(testBundle))
+	assert.Nil(t, err)
+	r := &bundleResolver{
+		devices: map[string]int{"device_1": 10},
+		scenes:  make(map[string]int),
+	}
+	req, err := r.createSceneReq(bundle.Scenes[1], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, req.SceneTasks[0].DeviceID)
+	assert.JSONEq(t, `[{"instance_id":1,"attribute":"power","val":"on","id":0,"val_type":""}]`,
+		string(req.SceneTasks[0].Attributes))
+
+	req, err = r.createSceneReq(bundle.Scenes[0], map[string]int{"scene_1": 20})
+	assert.Nil(t, err)
+	assert.Equal(t, 20, req.SceneTasks[0].ControlSceneID)
+}
+
+func TestSceneBundleNotification(t *testing.T) {
+	n := entity.Notification{Message: "离家", URL: "https://example.com/hook", Secret: "xxx",
+		Headers: map[string]string{"Authorization": "Bearer xxx", "X-Api-Key": "xxx", "Content-Language": "zh"}}
+	data, err := json.Marshal(n)
+	assert.Nil(t, err)
+	bt, err := newBundleTask(entity.SceneTask{Type: entity.TaskTypeWebhook, Notification: data}, nil)
+	assert.Nil(t, err)
+
+	// 签名密钥和认证请求头的值不导出
+	exported, err := json.Marshal(bt)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(exported), "xxx")
+	assert.True(t, bt.Notification.SecretRequired)
+	assert.Equal(t, map[string]string{"Authorization": "", "X-Api-Key": "", "Content-Language": "zh"},
+		bt.Notification.Headers)
+
+	// 导入前需要重新填写
+	out, err := yaml.Marshal(bt)
+	assert.Nil(t, err)
+	var imported BundleTask
+	assert.Nil(t, yaml.Unmarshal(out, &imported))
+	assert.Equal(t, bt, imported)
+	r := &bundleResolver{}
+	_, err = r.sceneTask(imported, nil)
+	assert.NotNil(t, err)
+	imported.Notification.Secret = "yyy"
+	_, err = r.sceneTask(imported, nil)
+	assert.NotNil(t, err)
+	imported.Notification.Headers["Authorization"] = "Bearer yyy"
+	imported.Notification.Headers["X-Api-Key"] = "yyy"
+	st, err := r.sceneTask(imported, nil)
+	assert.Nil(t, err)
+	got, err := st.GetNotification()
+	assert.Nil(t, err)
+	assert.Equal(t, "yyy", got.Secret)
+	assert.Equal(t, "Bearer yyy", got.Headers["Authorization"])
+	assert.NotContains(t, string(st.Notification), "secret_required")
+}
+
+func TestSceneBundleStepConditions(t *testing.T) {
+	door := &BundleCondition{ConditionType: entity.ConditionTypeDeviceStatus, Device: "device_1"}
+	light := &BundleCondition{ConditionType: entity.ConditionTypeDeviceStatus, Device: "device_2"}
+	step := BundleTask{Type: entity.TaskTypeRepeat, RepeatTimes: 2, Then: []BundleTask{
+		{Type: entity.TaskTypeIf, Condition: door, Else: []BundleTask{
+			{Type: entity.TaskTypeWait, Condition: light, TimeoutSeconds: 10},
+		}},
+	}}
+	// 嵌套步骤的条件同样需要查找设备
+	assert.Equal(t, []BundleCondition{*door, *light}, step.stepConditions())
+	assert.Empty(t, BundleTask{Type: entity.TaskTypeManualRun}.stepConditions())
+}
@@ -0,0 +1,42 @@
+package scene
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/task"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/modules/utils/session"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// CancelScene 用于处理取消场景执行接口的请求，正在执行的场景中未执行的延时任务将不再执行
+func CancelScene(c *gin.Context) {
+	var err error
+	defer func() {
+		response.HandleResponse(c, err, nil)
+	}()
+
+	sceneID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err = errors.New(errors.BadRequest)
+		return
+	}
+
+	if err = entity.CheckSceneExitById(sceneID); err != nil {
+		return
+	}
+
+	controlPermission, err := CheckControlPermission(c.Request, sceneID, session.Get(c).UserID)
+	if err != nil {
+		return
+	}
+	if !controlPermission {
+		err = errors.New(status.DeviceOrSceneControlDeny)
+		return
+	}
+
+	task.GetManager().CancelSceneTask(sceneID)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/zhiting-tech/smartassistant/modules/utils/session"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"github.com/zhiting-tech/smartassistant/pkg/errors"
 )
@@ -59,6 +60,14 @@ func CreateScene(c *gin.Context) {
 }
 
 func (req *CreateSceneReq) check(c *gin.Context) (err error) {
+	if err = entity.IsSceneNameExist(req.Name, req.ID); err != nil {
+		return
+	}
+	return req.checkConfig(c)
+}
+
+// checkConfig 校验创建场景的权限及场景的配置，包括设备和场景的控制权限，不校验名称是否重复
+func (req *CreateSceneReq) checkConfig(c *gin.Context) (err error) {
 	if !entity.JudgePermit(session.Get(c).UserID, types.SceneAdd) {
 		err = errors.New(status.SceneCreateDeny)
 		return
@@ -67,6 +76,11 @@ func (req *CreateSceneReq) check(c *gin.Context) (err error) {
 	if err = req.validate(c); err != nil {
 		return
 	}
+	if req.AutoRun {
+		if err = req.CheckConditionTree(getConditionReq(req.SceneConditions)); err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -77,7 +91,7 @@ func (req *CreateSceneReq) validate(c *gin.Context) (err error) {
 		return
 	}
 
-	if err = entity.IsSceneNameExist(req.Name, req.ID); err != nil {
+	if err = req.CheckMode(); err != nil {
 		return
 	}
 
@@ -100,6 +114,16 @@ func (req *CreateSceneReq) validate(c *gin.Context) (err error) {
 			return
 		}
 
+		// 设置条件组时，满足条件类型与条件组最外层保持一致
+		tree, hasTree, e := req.GetConditionTree()
+		if e != nil {
+			err = e
+			return
+		}
+		if hasTree {
+			req.ConditionLogic = tree.Logic
+		}
+
 		// ConditionLogic 校验
 		if req.CheckConditionLogic() {
 			err = errors.Newf(status.SceneParamIncorrectErr, "满足条件类型")
@@ -113,8 +137,9 @@ func (req *CreateSceneReq) validate(c *gin.Context) (err error) {
 		// SceneCondition 触发条件检验
 		var count int
 		for _, sc := range req.SceneConditions {
-			// 触发条件为满足全部时，定时触发条件只允许一个
-			if sc.ConditionType == entity.ConditionTypeTiming && req.IsMatchAllCondition() {
+			// 触发条件为满足全部时，定时或 webhook 触发条件只允许一个
+			// 设置条件组时由条件组校验
+			if sc.IsEventCondition() && req.IsMatchAllCondition() && !hasTree {
 				count++
 				if count > 1 {
 					err = errors.New(status.ConditionTimingCountErr)
@@ -125,6 +150,12 @@ func (req *CreateSceneReq) validate(c *gin.Context) (err error) {
 			if err = sc.CheckCondition(session.Get(c).UserID); err != nil {
 				return
 			}
+			// 日出日落条件需要家庭设置经纬度
+			if sc.ConditionType == entity.ConditionTypeSolar {
+				if err = checkAreaCoordinate(session.Get(c).AreaID); err != nil {
+					return
+				}
+			}
 		}
 	}
 	// 执行任务的校验
@@ -148,6 +179,21 @@ func CheckSceneTasks(c *gin.Context, task entity.SceneTask) (err error) {
 		if err = task.CheckTaskDevice(userId); err != nil {
 			return
 		}
+	} else if task.IsNotification() {
+		if err = task.CheckNotification(session.Get(c).AreaID); err != nil {
+			return
+		}
+	} else if task.IsControlStep() {
+		// 流程控制步骤，嵌套的步骤同样需要校验
+		var steps []entity.SceneTask
+		if steps, err = task.CheckControlStep(userId); err != nil {
+			return
+		}
+		for _, step := range steps {
+			if err = CheckSceneTasks(c, step); err != nil {
+				return
+			}
+		}
 	} else {
 		if err = checkTaskScene(c, task.ControlSceneID); err != nil {
 			return
@@ -164,7 +210,7 @@ func checkTaskScene(c *gin.Context, controlSceneId int) (err error) {
 	}
 
 	var controlPermission bool
-	if controlPermission, err = CheckControlPermission(c, controlSceneId, session.Get(c).UserID); err != nil {
+	if controlPermission, err = CheckControlPermission(c.Request, controlSceneId, session.Get(c).UserID); err != nil {
 		return
 	}
 	if !controlPermission {
@@ -175,6 +221,19 @@ func checkTaskScene(c *gin.Context, controlSceneId int) (err error) {
 	return
 }
 
+// checkAreaCoordinate 校验家庭是否已设置经纬度
+func checkAreaCoordinate(areaID uint64) (err error) {
+	area, err := entity.GetAreaByID(areaID)
+	if err != nil {
+		return
+	}
+	if !area.HasCoordinate() {
+		err = errors.Newf(status.SceneParamIncorrectErr, "家庭经纬度")
+		return
+	}
+	return
+}
+
 func (req *CreateSceneReq) createScene(c *gin.Context) (err error) {
 	u := session.Get(c)
 	req.Scene.CreatorID = u.UserID
@@ -189,9 +248,21 @@ func (req *CreateSceneReq) createScene(c *gin.Context) (err error) {
 	req.Scene.SceneTasks = req.SceneTasks
 	// 添加场景所属家庭
 	req.Scene.AreaID = u.AreaID
+	req.Scene.Revision = 0
 	if err = entity.CreateScene(&req.Scene); err != nil {
 		return
 	}
+	// 保存场景的第一个版本，场景的版本号同步更新，执行任务的日志记录该版本
+	var revision entity.SceneRevision
+	err = entity.GetDB().Transaction(func(tx *gorm.DB) (err error) {
+		revision, err = entity.SaveSceneRevision(req.Scene.ID, u.UserID, tx)
+		return
+	})
+	if err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	req.Scene.Revision = revision.Revision
 	return
 }
 
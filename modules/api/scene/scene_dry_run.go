@@ -0,0 +1,226 @@
+package scene
+
+import (
+	errors2 "errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/plugin"
+	"github.com/zhiting-tech/smartassistant/modules/task"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/modules/utils/session"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// DryRunSceneReq 模拟执行场景接口请求参数
+type DryRunSceneReq struct {
+	SceneID           int           `json:"scene_id"`           // 已保存的场景id，为0时模拟 scene 中的配置
+	Scene             SceneInfo     `json:"scene"`              // 未保存的场景配置
+	Now               int64         `json:"now"`                // 模拟的当前时间，为0时使用当前时间
+	DeviceStates      []DeviceState `json:"device_states"`      // 模拟的设备状态，未设置的使用设备当前状态
+	TriggerConditions []int         `json:"trigger_conditions"` // 触发场景的条件id，未保存的场景为条件的序号（从1开始）
+
+	Payload map[string]interface{} `json:"payload"` // 模拟的 webhook 请求内容
+}
+
+// DeviceState 模拟的设备属性状态
+type DeviceState struct {
+	DeviceID int `json:"device_id"`
+	entity.Attribute
+	Previous    interface{} `json:"previous"`     // 属性变化前的值，用于变化类条件
+	HeldSeconds int         `json:"held_seconds"` // 状态已持续的秒数，用于有持续时间的条件
+}
+
+// DryRunSceneResp 模拟执行场景接口返回数据
+type DryRunSceneResp struct {
+	task.DryRunResult
+}
+
+// DryRunScene 用于处理模拟执行场景接口的请求，返回场景是否会执行及执行的动作，不会实际控制设备
+func DryRunScene(c *gin.Context) {
+	var (
+		req   DryRunSceneReq
+		resp  DryRunSceneResp
+		scene entity.Scene
+		env   task.ConditionEnv
+		err   error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	if err = c.BindJSON(&req); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	if scene, err = req.getScene(c); err != nil {
+		return
+	}
+	if env, err = req.getEnv(c); err != nil {
+		return
+	}
+
+	if resp.DryRunResult, err = task.DryRunScene(env, scene, req.TriggerConditions...); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+}
+
+// getScene 获取模拟执行的场景
+func (req *DryRunSceneReq) getScene(c *gin.Context) (scene entity.Scene, err error) {
+	if req.SceneID != 0 {
+		if scene, err = entity.GetSceneInfoById(req.SceneID); err != nil {
+			if errors2.Is(err, gorm.ErrRecordNotFound) {
+				err = errors.Wrap(err, status.SceneNotExist)
+				return
+			}
+			err = errors.Wrap(err, errors.InternalServerErr)
+			return
+		}
+		if scene.AreaID != session.Get(c).AreaID {
+			err = errors.New(status.Deny)
+			return
+		}
+		return
+	}
+
+	// 未保存的场景与创建场景相同的校验（不校验名称是否重复），引用的设备和场景需要属于当前家庭
+	createReq := CreateSceneReq{SceneInfo: req.Scene}
+	if err = createReq.checkConfig(c); err != nil {
+		return
+	}
+	scene = req.Scene.Scene
+	scene.AreaID = session.Get(c).AreaID
+	scene.EffectStart = time.Unix(req.Scene.EffectStartTime, 0)
+	scene.EffectEnd = time.Unix(req.Scene.EffectEndTime, 0)
+	if scene.AutoRun {
+		scene.IsOn = true
+		scene.SceneConditions = getConditionReq(req.Scene.SceneConditions)
+		// 未保存的条件没有id，使用序号代替
+		for i := range scene.SceneConditions {
+			scene.SceneConditions[i].ID = i + 1
+		}
+		if err = scene.CheckConditionTree(scene.SceneConditions); err != nil {
+			return
+		}
+	}
+	for _, sc := range scene.SceneConditions {
+		if sc.ConditionType != entity.ConditionTypeDeviceStatus {
+			continue
+		}
+		if err = checkDeviceArea(sc.DeviceID, scene.AreaID); err != nil {
+			return
+		}
+	}
+	err = checkTasksArea(scene.SceneTasks, scene.AreaID)
+	return
+}
+
+// checkTasksArea 校验执行任务引用的设备和场景属于 areaID 家庭，包括流程控制步骤嵌套的条件和任务
+func checkTasksArea(tasks []entity.SceneTask, areaID uint64) (err error) {
+	for _, t := range tasks {
+		switch {
+		case t.Type == entity.TaskTypeSmartDevice:
+			err = checkDeviceArea(t.DeviceID, areaID)
+		case t.IsNotification():
+		case t.IsControlStep():
+			err = checkStepArea(t, areaID)
+		default:
+			var scene entity.Scene
+			if scene, err = entity.GetSceneById(t.ControlSceneID); err != nil {
+				if errors2.Is(err, gorm.ErrRecordNotFound) {
+					return errors.Wrap(err, status.SceneNotExist)
+				}
+				return errors.Wrap(err, errors.InternalServerErr)
+			}
+			if scene.AreaID != areaID {
+				return errors.New(status.Deny)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// checkStepArea 校验流程控制步骤的条件及嵌套的任务引用的设备和场景属于 areaID 家庭
+func checkStepArea(step entity.SceneTask, areaID uint64) (err error) {
+	if step.Type != entity.TaskTypeRepeat {
+		var c entity.SceneCondition
+		if c, err = step.GetCondition(); err != nil {
+			return
+		}
+		if err = checkDeviceArea(c.DeviceID, areaID); err != nil {
+			return
+		}
+	}
+	thenSteps, err := step.GetThen()
+	if err != nil {
+		return
+	}
+	elseSteps, err := step.GetElse()
+	if err != nil {
+		return
+	}
+	return checkTasksArea(append(thenSteps, elseSteps...), areaID)
+}
+
+// checkDeviceArea 校验设备存在（未删除）且属于 areaID 家庭
+func checkDeviceArea(deviceID int, areaID uint64) (err error) {
+	device, err := entity.GetDeviceByID(deviceID)
+	if err != nil {
+		if errors2.Is(err, gorm.ErrRecordNotFound) {
+			return errors.Wrap(err, status.DeviceNotExist)
+		}
+		return errors.Wrap(err, errors.InternalServerErr)
+	}
+	if device.AreaID != areaID {
+		return errors.New(status.Deny)
+	}
+	return
+}
+
+// getEnv 根据模拟的时间和设备状态获取判断条件的环境
+func (req *DryRunSceneReq) getEnv(c *gin.Context) (env task.ConditionEnv, err error) {
+	env = task.ConditionEnv{
+		Now:     time.Now(),
+		Shadows: make(map[int]entity.Shadow),
+		Payload: req.Payload,
+	}
+	if req.Now != 0 {
+		env.Now = time.Unix(req.Now, 0)
+	}
+
+	for _, ds := range req.DeviceStates {
+		shadow, ok := env.Shadows[ds.DeviceID]
+		if !ok {
+			var device entity.Device
+			if device, err = entity.GetDeviceByID(ds.DeviceID); err != nil {
+				if errors2.Is(err, gorm.ErrRecordNotFound) {
+					err = errors.Wrap(err, status.DeviceNotExist)
+					return
+				}
+				err = errors.Wrap(err, errors.InternalServerErr)
+				return
+			}
+			if device.AreaID != session.Get(c).AreaID {
+				err = errors.New(status.Deny)
+				return
+			}
+			// 影子无法解析时仅使用模拟的状态
+			if shadow, err = plugin.GetShadow(device); err != nil {
+				shadow, err = entity.NewShadow(), nil
+			}
+		}
+		changedAt := env.Now.Add(-time.Duration(ds.HeldSeconds) * time.Second)
+		shadow.SetReported(ds.InstanceID, ds.Attribute.Attribute, ds.Previous, changedAt)
+		env.Shadows[ds.DeviceID] = shadow
+	}
+	return
+}
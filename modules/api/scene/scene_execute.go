@@ -1,6 +1,7 @@
 package scene
 
 import (
+	"net/http"
 	"strconv"
 
 	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
@@ -44,14 +45,15 @@ func ExecuteScene(c *gin.Context) {
 		return
 	}
 
-	if err = req.executeScene(c, sceneId); err != nil {
+	if err = req.executeScene(c.Request, session.Get(c).UserID, sceneId); err != nil {
 		return
 	}
 }
 
-func (req ExecuteSceneReq) executeScene(c *gin.Context, sceneId int) (err error) {
+// executeScene 用户 userID 执行或开关场景，r 为用户的请求
+func (req ExecuteSceneReq) executeScene(r *http.Request, userID, sceneId int) (err error) {
 
-	controlPermission, err := CheckControlPermission(c, sceneId, session.Get(c).UserID)
+	controlPermission, err := CheckControlPermission(r, sceneId, userID)
 	if !controlPermission {
 		err = errors.New(status.DeviceOrSceneControlDeny)
 		return
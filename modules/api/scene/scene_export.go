@@ -0,0 +1,82 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/modules/utils/session"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+const (
+	bundleFormatJSON = "json"
+	bundleFormatYAML = "yaml"
+)
+
+// ExportSceneReq 导出场景接口请求参数
+type ExportSceneReq struct {
+	SceneIDs []int  `form:"scene_ids" binding:"required"`
+	Format   string `form:"format"` // json（默认）或 yaml
+}
+
+// ExportScene 用于处理导出场景接口的请求，返回包含场景及其触发条件、执行任务的文件
+func ExportScene(c *gin.Context) {
+	var (
+		req    ExportSceneReq
+		scenes []entity.Scene
+		data   []byte
+		err    error
+	)
+
+	if err = c.BindQuery(&req); err != nil {
+		response.HandleResponse(c, errors.Wrap(err, errors.BadRequest), nil)
+		return
+	}
+	if req.Format == "" {
+		req.Format = bundleFormatJSON
+	}
+	if req.Format != bundleFormatJSON && req.Format != bundleFormatYAML {
+		response.HandleResponse(c, errors.Newf(status.SceneParamIncorrectErr, "导出格式"), nil)
+		return
+	}
+
+	for _, id := range req.SceneIDs {
+		var scene entity.Scene
+		if scene, err = entity.GetSceneInfoById(id); err != nil || scene.AreaID != session.Get(c).AreaID {
+			response.HandleResponse(c, errors.New(status.SceneNotExist), nil)
+			return
+		}
+		scenes = append(scenes, scene)
+	}
+
+	bundle, err := newSceneBundle(scenes)
+	if err != nil {
+		response.HandleResponse(c, errors.Wrap(err, errors.InternalServerErr), nil)
+		return
+	}
+	if req.Format == bundleFormatYAML {
+		data, err = yaml.Marshal(bundle)
+	} else {
+		data, err = json.MarshalIndent(bundle, "", "  ")
+	}
+	if err != nil {
+		response.HandleResponse(c, errors.Wrap(err, errors.InternalServerErr), nil)
+		return
+	}
+
+	filename := fmt.Sprintf("scenes_%s.%s", time.Now().Format("20060102150405"), req.Format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	contentType := "application/json"
+	if req.Format == bundleFormatYAML {
+		contentType = "application/x-yaml"
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
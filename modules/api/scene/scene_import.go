@@ -0,0 +1,94 @@
+package scene
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/task"
+	"github.com/zhiting-tech/smartassistant/modules/utils/session"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+// ImportSceneReq 导入场景接口请求参数
+type ImportSceneReq struct {
+	Bundle string `json:"bundle"` // 导出的 JSON 或 YAML 文件内容
+	// DeviceMap 文件中的设备引用 -> 家庭中的设备id，未指定的设备按 identity 和 plugin_id 在家庭中查找
+	DeviceMap map[string]int `json:"device_map"`
+}
+
+// ImportSceneResp 导入场景接口返回数据
+type ImportSceneResp struct {
+	SceneIDs   []int           `json:"scene_ids"`
+	Unresolved []UnresolvedRef `json:"unresolved"` // 有无法找到的设备或场景时不导入任何场景
+}
+
+// ImportScene 用于处理导入场景接口的请求，将文件中的场景导入到当前家庭
+func ImportScene(c *gin.Context) {
+	var (
+		req  ImportSceneReq
+		resp ImportSceneResp
+		err  error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	if err = c.BindJSON(&req); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	bundle, err := parseSceneBundle([]byte(req.Bundle))
+	if err != nil {
+		return
+	}
+	order, err := bundle.importOrder()
+	if err != nil {
+		return
+	}
+	resolver, err := bundle.resolve(session.Get(c).AreaID, req.DeviceMap)
+	if err != nil {
+		return
+	}
+	resp.SceneIDs = make([]int, 0)
+	resp.Unresolved = resolver.unresolved
+	if len(resp.Unresolved) != 0 {
+		return
+	}
+
+	var created []entity.Scene
+	sceneIDs := make(map[string]int)
+	for _, s := range order {
+		var createReq CreateSceneReq
+		if createReq, err = resolver.createSceneReq(s, sceneIDs); err != nil {
+			break
+		}
+		// 与创建场景相同的校验，包括设备和场景的控制权限
+		if err = createReq.check(c); err != nil {
+			break
+		}
+		if err = createReq.createScene(c); err != nil {
+			break
+		}
+		sceneIDs[s.Ref] = createReq.Scene.ID
+		created = append(created, createReq.Scene)
+	}
+	// 有场景导入失败时删除本次已导入的场景
+	if err != nil {
+		for _, scene := range created {
+			if e := entity.DeleteScene(scene.ID); e != nil {
+				logger.Errorf("delete imported scene %d err: %v", scene.ID, e)
+			}
+		}
+		return
+	}
+
+	for _, scene := range created {
+		resp.SceneIDs = append(resp.SceneIDs, scene.ID)
+		if scene.AutoRun {
+			task.GetManager().AddSceneTask(scene)
+		}
+	}
+}
@@ -149,6 +149,10 @@ func WrapTaskInfo(c *gin.Context, task entity.SceneTask) (taskInfo SceneTaskInfo
 	taskInfo = SceneTaskInfo{
 		SceneTask: task,
 	}
+	// 流程控制步骤和通知直接返回任务的配置
+	if task.IsControlStep() || task.IsNotification() {
+		return
+	}
 
 	if task.Type != entity.TaskTypeSmartDevice {
 		if scene, err = entity.GetSceneByIDWithUnscoped(task.ControlSceneID); err != nil {
@@ -120,14 +120,14 @@ func ListScene(c *gin.Context) {
 		return
 	}
 
-	if resp.Manual, resp.AutoRun, err = WrapScenes(c, scenes, user.UserID, req.Type); err != nil {
+	if resp.Manual, resp.AutoRun, err = WrapScenes(c.Request, scenes, user.UserID, req.Type); err != nil {
 		return
 	}
 
 	return
 }
 
-func WrapScenes(c *gin.Context, scenes []entity.Scene, userID int, listType listType) (manualScenes []manualSceneInfo, autoRunScenes []autoRunSceneInfo, err error) {
+func WrapScenes(req *http.Request, scenes []entity.Scene, userID int, listType listType) (manualScenes []manualSceneInfo, autoRunScenes []autoRunSceneInfo, err error) {
 	var (
 		items             []Item
 		condition         sceneCondition
@@ -139,7 +139,7 @@ func WrapScenes(c *gin.Context, scenes []entity.Scene, userID int, listType list
 
 	for _, scene := range scenes {
 
-		if controlPermission, err = CheckControlPermission(c, scene.ID, userID); err != nil {
+		if controlPermission, err = CheckControlPermission(req, scene.ID, userID); err != nil {
 			return
 		}
 		if listType == permitScene && !controlPermission {
@@ -147,7 +147,7 @@ func WrapScenes(c *gin.Context, scenes []entity.Scene, userID int, listType list
 		}
 
 		// 场景执行任务信息
-		if items, err = WrapItems(c, scene.ID); err != nil {
+		if items, err = WrapItems(req, scene.ID); err != nil {
 			return
 		}
 
@@ -162,7 +162,7 @@ func WrapScenes(c *gin.Context, scenes []entity.Scene, userID int, listType list
 		if scene.AutoRun {
 			// 自动触发条件
 			var canControl bool
-			if condition, canControl, err = WrapCondition(c, scene.ID, userID); err != nil {
+			if condition, canControl, err = WrapCondition(req, scene.ID, userID); err != nil {
 				return
 			}
 			// 没有触发条件中设备的控制权限，ControlPermission为false
@@ -192,7 +192,7 @@ func WrapScenes(c *gin.Context, scenes []entity.Scene, userID int, listType list
 	return
 }
 
-func WrapCondition(ctx *gin.Context, sceneID, userID int) (sceneCondition sceneCondition, canControlDevice bool, err error) {
+func WrapCondition(req *http.Request, sceneID, userID int) (sceneCondition sceneCondition, canControlDevice bool, err error) {
 	var (
 		conditions    []entity.SceneCondition
 		conditionItem entity.Attribute
@@ -220,7 +220,7 @@ func WrapCondition(ctx *gin.Context, sceneID, userID int) (sceneCondition sceneC
 				canControlDevice = false
 				return
 			}
-			if !up.IsDeviceAttrPermit(c.DeviceID, conditionItem) {
+			if !entity.IsReadOnlyAttr(c.DeviceID, conditionItem) && !up.IsDeviceAttrPermit(c.DeviceID, conditionItem) {
 				canControlDevice = false
 				return
 			}
@@ -228,7 +228,7 @@ func WrapCondition(ctx *gin.Context, sceneID, userID int) (sceneCondition sceneC
 			// 第一个触发条件为设备时，包装对应信息
 			if i == 0 {
 				item := Item{ID: c.DeviceID}
-				if err = WrapDeviceItem(&item, ctx.Request); err != nil {
+				if err = WrapDeviceItem(&item, req); err != nil {
 					return
 				}
 				sceneCondition.LogoURL = item.LogoURL
@@ -239,7 +239,7 @@ func WrapCondition(ctx *gin.Context, sceneID, userID int) (sceneCondition sceneC
 	return
 }
 
-func WrapItems(c *gin.Context, sceneID int) (items []Item, err error) {
+func WrapItems(req *http.Request, sceneID int) (items []Item, err error) {
 	var (
 		tasks []entity.SceneTask
 		item  Item
@@ -252,17 +252,23 @@ func WrapItems(c *gin.Context, sceneID int) (items []Item, err error) {
 		return
 	}
 	for _, task := range tasks {
-		if item, err = WrapItem(c, task); err != nil {
+		// 流程控制步骤展示其嵌套的设备和场景
+		var leafTasks []entity.SceneTask
+		if leafTasks, err = task.LeafTasks(); err != nil {
 			return
 		}
-		items = append(items, item)
-
+		for _, t := range leafTasks {
+			if item, err = WrapItem(req, t); err != nil {
+				return
+			}
+			items = append(items, item)
+		}
 	}
 
 	return
 }
 
-func WrapItem(c *gin.Context, task entity.SceneTask) (item Item, err error) {
+func WrapItem(req *http.Request, task entity.SceneTask) (item Item, err error) {
 	var (
 		taskDevices []entity.Attribute
 		scene       entity.Scene
@@ -274,7 +280,7 @@ func WrapItem(c *gin.Context, task entity.SceneTask) (item Item, err error) {
 	if task.Type == entity.TaskTypeSmartDevice {
 		item.ID = task.DeviceID
 		item.devices = taskDevices
-		if err = WrapDeviceItem(&item, c.Request); err != nil {
+		if err = WrapDeviceItem(&item, req); err != nil {
 			return
 		}
 		return
@@ -298,12 +304,12 @@ func WrapItem(c *gin.Context, task entity.SceneTask) (item Item, err error) {
 	return
 }
 
-func CheckControlPermission(c *gin.Context, sceneID int, userID int) (controlPermission bool, err error) {
+func CheckControlPermission(req *http.Request, sceneID int, userID int) (controlPermission bool, err error) {
 	checked := make(map[int]bool)
-	return checkControlPermission(c, sceneID, userID, checked)
+	return checkControlPermission(req, sceneID, userID, checked)
 }
 
-func checkControlPermission(c *gin.Context, sceneID int, userID int, checked map[int]bool) (controlPermission bool, err error) {
+func checkControlPermission(req *http.Request, sceneID int, userID int, checked map[int]bool) (controlPermission bool, err error) {
 	var (
 		items []Item
 	)
@@ -319,7 +325,7 @@ func checkControlPermission(c *gin.Context, sceneID int, userID int, checked map
 	controlPermission = true
 	checked[sceneID] = true
 
-	if items, err = WrapItems(c, sceneID); err != nil {
+	if items, err = WrapItems(req, sceneID); err != nil {
 		return
 	}
 	var up entity.UserPermissions
@@ -346,7 +352,7 @@ func checkControlPermission(c *gin.Context, sceneID int, userID int, checked map
 			continue
 		}
 
-		if controlPermission, err = checkControlPermission(c, item.ID, userID, checked); err != nil {
+		if controlPermission, err = checkControlPermission(req, item.ID, userID, checked); err != nil {
 			return
 		}
 		// 嵌套控制场景不满足权限就直接返回false
@@ -0,0 +1,181 @@
+package scene
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/task"
+	"github.com/zhiting-tech/smartassistant/modules/utils/session"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+// ListSceneRevisionResp 场景版本列表接口返回数据
+type ListSceneRevisionResp struct {
+	Revisions []SceneRevisionInfo `json:"revisions"`
+}
+
+// SceneRevisionInfo 场景版本信息
+type SceneRevisionInfo struct {
+	Revision   int    `json:"revision"`
+	AuthorID   int    `json:"author_id"`
+	AuthorName string `json:"author_name"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// DiffSceneRevisionReq 比较场景版本接口请求参数
+type DiffSceneRevisionReq struct {
+	From int `form:"from" binding:"required"`
+	To   int `form:"to" binding:"required"`
+}
+
+// DiffSceneRevisionResp 比较场景版本接口返回数据
+type DiffSceneRevisionResp struct {
+	Changes []entity.SceneChange `json:"changes"`
+}
+
+// RollbackSceneResp 回滚场景接口返回数据
+type RollbackSceneResp struct {
+	Revision int `json:"revision"` // 回滚后保存的新版本号
+}
+
+// ListSceneRevision 用于处理场景版本列表接口的请求
+func ListSceneRevision(c *gin.Context) {
+	var (
+		resp ListSceneRevisionResp
+		err  error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	sceneID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	revisions, err := entity.GetSceneRevisions(sceneID)
+	if err != nil {
+		return
+	}
+	resp.Revisions = make([]SceneRevisionInfo, 0, len(revisions))
+	for _, r := range revisions {
+		info := SceneRevisionInfo{
+			Revision:   r.Revision,
+			AuthorID:   r.AuthorID,
+			CreateTime: r.CreatedAt.Unix(),
+		}
+		if user, e := entity.GetUserByID(r.AuthorID); e == nil {
+			info.AuthorName = user.Nickname
+		}
+		resp.Revisions = append(resp.Revisions, info)
+	}
+}
+
+// DiffSceneRevision 用于处理比较场景版本接口的请求
+func DiffSceneRevision(c *gin.Context) {
+	var (
+		req  DiffSceneRevisionReq
+		resp DiffSceneRevisionResp
+		err  error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	sceneID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+	if err = c.BindQuery(&req); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	from, err := getRevisionSnapshot(sceneID, req.From)
+	if err != nil {
+		return
+	}
+	to, err := getRevisionSnapshot(sceneID, req.To)
+	if err != nil {
+		return
+	}
+	resp.Changes = entity.DiffSceneSnapshot(from, to)
+}
+
+// RollbackScene 用于处理回滚场景接口的请求，将场景恢复为指定版本的配置
+func RollbackScene(c *gin.Context) {
+	var (
+		resp RollbackSceneResp
+		err  error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	sceneID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	// 恢复的配置与修改场景相同的校验，包括当前用户对设备和场景的控制权限，引用已删除设备的版本不能恢复
+	check := func(snapshot entity.SceneSnapshot) (err error) {
+		req := newSnapshotReq(snapshot)
+		if err = req.validate(c); err != nil {
+			return
+		}
+		if req.AutoRun {
+			err = req.CheckConditionTree(getConditionReq(req.SceneConditions))
+		}
+		return
+	}
+	r, err := entity.RollbackScene(sceneID, revision, session.Get(c).UserID, check)
+	if err != nil {
+		return
+	}
+	resp.Revision = r.Revision
+
+	if e := task.GetManager().RestartSceneTask(sceneID); e != nil {
+		logger.Println("restart scene task err:", e)
+	}
+}
+
+// getRevisionSnapshot 获取场景版本保存的配置
+func getRevisionSnapshot(sceneID, revision int) (snapshot entity.SceneSnapshot, err error) {
+	r, err := entity.GetSceneRevision(sceneID, revision)
+	if err != nil {
+		return
+	}
+	return r.GetSnapshot()
+}
+
+// newSnapshotReq 将版本保存的配置转换为场景请求参数，用于恢复前的校验
+func newSnapshotReq(snapshot entity.SceneSnapshot) (req CreateSceneReq) {
+	req.Scene = entity.Scene{
+		Name:           snapshot.Name,
+		ConditionLogic: snapshot.ConditionLogic,
+		ConditionTree:  snapshot.ConditionTree,
+		TimePeriodType: snapshot.TimePeriodType,
+		RepeatType:     snapshot.RepeatType,
+		RepeatDate:     snapshot.RepeatDate,
+		AutoRun:        snapshot.AutoRun,
+		Mode:           snapshot.Mode,
+		MaxRuns:        snapshot.MaxRuns,
+		SceneTasks:     snapshot.SceneTasks,
+	}
+	req.SceneConditions = snapshot.SceneConditions
+	req.EffectStartTime = snapshot.EffectStart
+	req.EffectEndTime = snapshot.EffectEnd
+	return
+}
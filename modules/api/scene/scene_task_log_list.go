@@ -2,6 +2,7 @@ package scene
 
 import (
 	"sort"
+	"time"
 
 	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
@@ -12,13 +13,39 @@ import (
 	"github.com/zhiting-tech/smartassistant/pkg/errors"
 )
 
-// 场景日志接口返回日志的默认数量
-const logSizeDefault = 40
+const (
+	// 场景日志接口返回日志的默认数量
+	logSizeDefault = 40
+	// 场景日志统计的默认天数
+	logStatDaysDefault = 7
+)
 
 // ListSceneTaskReq 场景日志接口请求参数
 type ListSceneTaskReq struct {
-	Start int `form:"start"`
-	Size  int `form:"size"`
+	Start  int    `form:"start" json:"start"`
+	Size   int    `form:"size" json:"size"`
+	Cursor string `form:"cursor" json:"cursor"` // 上一页最后一条日志的 cursor，设置后忽略 start
+	SceneTaskLogFilterReq
+}
+
+// SceneTaskLogFilterReq 场景日志的筛选条件
+type SceneTaskLogFilterReq struct {
+	SceneID   int                     `form:"scene_id" json:"scene_id"`
+	DeviceID  int                     `form:"device_id" json:"device_id"`
+	Results   []entity.TaskResultType `form:"results" json:"results"`
+	StartTime int64                   `form:"start_time" json:"start_time"` // 完成时间范围的开始时间戳
+	EndTime   int64                   `form:"end_time" json:"end_time"`     // 完成时间范围的结束时间戳（不包含）
+}
+
+// SceneTaskLogStatReq 场景日志统计接口请求参数
+type SceneTaskLogStatReq struct {
+	Days int `form:"days"` // 统计最近的天数，未设置时间范围时有效
+	SceneTaskLogFilterReq
+}
+
+// SceneTaskLogStatResp 场景日志统计接口返回数据
+type SceneTaskLogStatResp struct {
+	Scenes []entity.SceneRunStat `json:"scenes"`
 }
 
 // ListSceneTaskLogResp 场景日志接口返回数据
@@ -32,10 +59,13 @@ type DateLogInfo struct {
 
 // SceneTaskLogInfo 场景日志信息
 type SceneTaskLogInfo struct {
+	Cursor     string                `json:"cursor"` // 获取下一页时使用
+	SceneID    int                   `json:"scene_id"`
 	Name       string                `json:"name"`
 	Type       entity.TaskType       `json:"type"`
 	Result     entity.TaskResultType `json:"result"`
 	FinishedAt int64                 `json:"finished_at"`
+	Revision   int                   `json:"revision"` // 执行的场景版本
 	Items      []TaskLogItem         `json:"items"`
 }
 
@@ -50,11 +80,9 @@ type TaskLogItem struct {
 // ListSceneTaskLog 用于处理场景日志接口的请求
 func ListSceneTaskLog(c *gin.Context) {
 	var (
-		err error
-		req ListSceneTaskReq
-
-		taskLogs []entity.TaskLog
-		resp     ListSceneTaskLogResp
+		err  error
+		req  ListSceneTaskReq
+		resp ListSceneTaskLogResp
 	)
 
 	defer func() {
@@ -66,27 +94,75 @@ func ListSceneTaskLog(c *gin.Context) {
 		return
 	}
 
+	resp, err = req.sceneTaskLogs(session.Get(c).AreaID)
+	return
+}
+
+// sceneTaskLogs 获取家庭 areaID 的场景日志并按月分组
+func (req ListSceneTaskReq) sceneTaskLogs(areaID uint64) (resp ListSceneTaskLogResp, err error) {
 	if req.Size == 0 {
 		req.Size = logSizeDefault
 	}
 
-	if err = entity.GetDB().
-		Preload("ChildTaskLogs").
-		Order("finished_at desc").
-		Where("type !=? and finish=? and result !=? and area_id=?",
-			entity.TaskTypeSmartDevice, true, entity.TaskSceneAlreadyDeleted, session.Get(c).AreaID).
-		Offset(req.Start).
-		Limit(req.Size).
-		Find(&taskLogs).Error; err != nil {
-		err = errors.Wrap(err, errors.InternalServerErr)
+	var cursor *entity.TaskLogCursor
+	if req.Cursor != "" {
+		var cur entity.TaskLogCursor
+		if cur, err = entity.ParseTaskLogCursor(req.Cursor); err != nil {
+			return
+		}
+		cursor = &cur
+	}
+	taskLogs, err := entity.SceneRunLogs(req.filter(areaID), cursor, req.Start, req.Size)
+	if err != nil {
 		return
 	}
+	return LogInfosGroupByDate(taskLogs)
+}
 
-	if resp, err = LogInfosGroupByDate(taskLogs); err != nil {
+// filter 生成家庭 areaID 的日志筛选条件
+func (req SceneTaskLogFilterReq) filter(areaID uint64) entity.TaskLogFilter {
+	filter := entity.TaskLogFilter{
+		AreaID:   areaID,
+		SceneID:  req.SceneID,
+		DeviceID: req.DeviceID,
+		Results:  req.Results,
+	}
+	if req.StartTime != 0 {
+		filter.StartTime = time.Unix(req.StartTime, 0)
+	}
+	if req.EndTime != 0 {
+		filter.EndTime = time.Unix(req.EndTime, 0)
+	}
+	return filter
+}
+
+// SceneTaskLogStat 用于处理场景日志统计接口的请求，按场景统计执行次数及失败率
+func SceneTaskLogStat(c *gin.Context) {
+	var (
+		err  error
+		req  SceneTaskLogStatReq
+		resp SceneTaskLogStatResp
+	)
+
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	if err = c.BindQuery(&req); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
 		return
 	}
 
-	return
+	filter := req.filter(session.Get(c).AreaID)
+	if filter.StartTime.IsZero() && filter.EndTime.IsZero() {
+		if req.Days <= 0 {
+			req.Days = logStatDaysDefault
+		}
+		filter.StartTime = time.Now().AddDate(0, 0, -req.Days)
+	}
+	if resp.Scenes, err = entity.GetSceneRunStats(filter); err != nil {
+		return
+	}
 }
 
 func LogInfosGroupByDate(taskLogs []entity.TaskLog) (logInfos []DateLogInfo, err error) {
@@ -103,10 +179,13 @@ func LogInfosGroupByDate(taskLogs []entity.TaskLog) (logInfos []DateLogInfo, err
 		}
 
 		taskLogInfo := SceneTaskLogInfo{
+			Cursor:     entity.NewTaskLogCursor(taskLog).String(),
+			SceneID:    taskLog.SceneID,
 			Name:       taskLog.Name,
 			Type:       taskLog.Type,
 			Result:     taskLog.Result,
 			FinishedAt: taskLog.FinishedAt.Unix(),
+			Revision:   taskLog.SceneRevision,
 			Items:      WrapLogItems(taskLog),
 		}
 		date := taskLog.FinishedAt.Format("2006-01")
@@ -133,8 +212,9 @@ func WrapLogItems(taskLog entity.TaskLog) (taskItems []TaskLogItem) {
 
 	taskItems = make([]TaskLogItem, 0)
 
-	// 任务部分执行成功/执行失败时展示执行详情
-	if taskLog.Result == entity.TaskPartSuccess || taskLog.Result == entity.TaskFail && len(taskLog.ChildTaskLogs) != 0 {
+	// 任务部分执行成功/执行失败/已取消时展示执行详情
+	if taskLog.Result == entity.TaskPartSuccess ||
+		(taskLog.Result == entity.TaskFail || taskLog.Result == entity.TaskCanceled) && len(taskLog.ChildTaskLogs) != 0 {
 		for _, taskLog := range taskLog.ChildTaskLogs {
 			taskItems = append(taskItems, TaskLogItem{
 				Name:         taskLog.Name,
@@ -8,6 +8,7 @@ import (
 	"github.com/zhiting-tech/smartassistant/modules/entity"
 	"github.com/zhiting-tech/smartassistant/modules/task"
 	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/modules/utils/session"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
 
 	"github.com/gin-gonic/gin"
@@ -50,7 +51,21 @@ func UpdateScene(c *gin.Context) {
 
 	req.wrapReq()
 
-	if err = req.updateScene(sceneId); err != nil {
+	// 修改前后的版本与修改在同一事务中保存，修改失败时不保存版本
+	err = entity.GetDB().Transaction(func(tx *gorm.DB) (err error) {
+		// 保留修改前的配置
+		if err = entity.EnsureSceneRevision(sceneId, tx); err != nil {
+			return errors.Wrap(err, errors.InternalServerErr)
+		}
+		if err = req.updateScene(sceneId, tx); err != nil {
+			return
+		}
+		if _, err = entity.SaveSceneRevision(sceneId, session.Get(c).UserID, tx); err != nil {
+			return errors.Wrap(err, errors.InternalServerErr)
+		}
+		return
+	})
+	if err != nil {
 		return
 	}
 
@@ -71,24 +86,71 @@ func (req *UpdateSceneReq) validateRequest(sceneId int, c *gin.Context) (err err
 		return
 	}
 
+	if err = entity.IsSceneNameExist(req.Name, sceneId); err != nil {
+		return
+	}
 	if err = req.CreateSceneReq.validate(c); err != nil {
 		return
 	}
+	if req.AutoRun {
+		var conditions []entity.SceneCondition
+		if conditions, err = req.conditionsAfterUpdate(sceneId); err != nil {
+			return
+		}
+		if err = req.CheckConditionTree(conditions); err != nil {
+			return
+		}
+	}
 	return
 }
 
-func (req UpdateSceneReq) updateScene(sceneId int) (err error) {
-	// TODO 后续调整为使用事务
-	if err = entity.GetDB().Session(&gorm.Session{FullSaveAssociations: true}).Where("id=?", sceneId).Updates(&req.Scene).Error; err != nil {
+// conditionsAfterUpdate 获取修改后场景的全部触发条件
+func (req *UpdateSceneReq) conditionsAfterUpdate(sceneId int) (conditions []entity.SceneCondition, err error) {
+	scene, err := entity.GetSceneInfoById(sceneId)
+	if err != nil {
 		err = errors.Wrap(err, errors.InternalServerErr)
 		return
 	}
 
-	if err = req.delConditions(sceneId); err != nil {
+	ignore := make(map[int]bool)
+	for _, id := range req.DelConditionIds {
+		ignore[id] = true
+	}
+	reqConditions := getConditionReq(req.SceneConditions)
+	for _, c := range reqConditions {
+		if c.ID != 0 {
+			ignore[c.ID] = true
+		}
+	}
+	for _, c := range scene.SceneConditions {
+		if !ignore[c.ID] {
+			conditions = append(conditions, c)
+		}
+	}
+	conditions = append(conditions, reqConditions...)
+	return
+}
+
+func (req UpdateSceneReq) updateScene(sceneId int, tx *gorm.DB) (err error) {
+	if err = tx.Session(&gorm.Session{FullSaveAssociations: true}).Where("id=?", sceneId).Updates(&req.Scene).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+
+	// 未设置条件组时清除原有的条件组
+	if len(req.Scene.ConditionTree) == 0 {
+		if err = tx.Model(&entity.Scene{}).Where("id=?", sceneId).
+			UpdateColumn("condition_tree", nil).Error; err != nil {
+			err = errors.Wrap(err, errors.InternalServerErr)
+			return
+		}
+	}
+
+	if err = req.delConditions(sceneId, tx); err != nil {
 		return
 	}
 
-	if err = req.delTasks(sceneId); err != nil {
+	if err = req.delTasks(sceneId, tx); err != nil {
 		return
 	}
 
@@ -99,6 +161,8 @@ func (req *UpdateSceneReq) wrapReq() {
 	req.Scene.CreatedAt = time.Unix(req.CreateTime, 0)
 	req.Scene.EffectStart = time.Unix(req.EffectStartTime, 0)
 	req.Scene.EffectEnd = time.Unix(req.EffectEndTime, 0)
+	// 版本号仅在保存版本时更新
+	req.Scene.Revision = 0
 
 	for _, sc := range req.SceneConditions {
 		sceneCondition := sc.SceneCondition
@@ -109,7 +173,7 @@ func (req *UpdateSceneReq) wrapReq() {
 }
 
 // delConditions 删除触发条件
-func (req *UpdateSceneReq) delConditions(sceneId int) (err error) {
+func (req *UpdateSceneReq) delConditions(sceneId int, tx *gorm.DB) (err error) {
 	if len(req.DelConditionIds) == 0 {
 		return
 	}
@@ -119,7 +183,7 @@ func (req *UpdateSceneReq) delConditions(sceneId int) (err error) {
 		condition := entity.SceneCondition{ID: id, SceneID: sceneId}
 		conditions = append(conditions, condition)
 	}
-	if err = entity.GetDB().Delete(conditions).Error; err != nil {
+	if err = tx.Delete(conditions).Error; err != nil {
 		err = errors.Wrap(err, errors.InternalServerErr)
 		return
 	}
@@ -127,7 +191,7 @@ func (req *UpdateSceneReq) delConditions(sceneId int) (err error) {
 }
 
 // delTasks 删除执行任务
-func (req *UpdateSceneReq) delTasks(sceneId int) (err error) {
+func (req *UpdateSceneReq) delTasks(sceneId int, tx *gorm.DB) (err error) {
 	if len(req.DelTaskIds) == 0 {
 		return
 	}
@@ -137,7 +201,7 @@ func (req *UpdateSceneReq) delTasks(sceneId int) (err error) {
 		task := entity.SceneTask{ID: id, SceneID: sceneId}
 		tasks = append(tasks, task)
 	}
-	if err = entity.GetDB().Delete(tasks).Error; err != nil {
+	if err = tx.Delete(tasks).Error; err != nil {
 		err = errors.Wrap(err, errors.InternalServerErr)
 		return
 	}
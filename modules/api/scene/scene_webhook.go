@@ -0,0 +1,126 @@
+package scene
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/task"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+const (
+	// webhookPathPrefix 场景 webhook 地址的路径前缀
+	webhookPathPrefix = "/api/scene_webhooks/"
+	// webhookBodyLimit webhook 请求内容的最大字节数
+	webhookBodyLimit = 64 * 1024
+)
+
+// SceneWebhookResp 场景 webhook 地址接口返回数据
+type SceneWebhookResp struct {
+	URL string `json:"url"` // 触发场景的地址，需要拼接 SA 的访问地址
+}
+
+// TriggerSceneWebhookResp webhook 触发场景接口返回数据
+type TriggerSceneWebhookResp struct {
+	Triggered bool `json:"triggered"` // 是否有条件被触发，场景是否执行仍由其他条件决定
+}
+
+// GetSceneWebhook 用于处理获取场景 webhook 地址接口的请求，地址首次获取时生成
+func GetSceneWebhook(c *gin.Context) {
+	var (
+		resp SceneWebhookResp
+		err  error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	sceneID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	token, err := entity.GetSceneWebhookToken(sceneID)
+	if err != nil {
+		return
+	}
+	resp.URL = webhookPathPrefix + token
+}
+
+// ResetSceneWebhook 用于处理重置场景 webhook 地址接口的请求，旧的地址随即失效
+func ResetSceneWebhook(c *gin.Context) {
+	var (
+		resp SceneWebhookResp
+		err  error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	sceneID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+
+	if err = entity.CheckSceneExitById(sceneID); err != nil {
+		return
+	}
+	token, err := entity.ResetSceneWebhookToken(sceneID)
+	if err != nil {
+		return
+	}
+	resp.URL = webhookPathPrefix + token
+}
+
+// TriggerSceneWebhook 用于处理 webhook 触发场景接口的请求，地址中的密钥即为凭证，
+// 请求内容为空或 JSON 对象
+func TriggerSceneWebhook(c *gin.Context) {
+	var (
+		resp TriggerSceneWebhookResp
+		err  error
+	)
+	defer func() {
+		response.HandleResponse(c, err, &resp)
+	}()
+
+	scene, err := entity.GetSceneByWebhookToken(c.Param("token"))
+	if err != nil {
+		return
+	}
+
+	payload, err := readWebhookPayload(c)
+	if err != nil {
+		return
+	}
+	resp.Triggered, err = task.GetManager().WebhookTrigger(scene.ID, payload)
+}
+
+// readWebhookPayload 读取 webhook 请求内容
+func readWebhookPayload(c *gin.Context) (payload map[string]interface{}, err error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, webhookBodyLimit))
+	if err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+	payload = make(map[string]interface{})
+	if len(bytes.TrimSpace(body)) == 0 {
+		return
+	}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+	if payload == nil { // 请求内容为 null
+		err = errors.New(errors.BadRequest)
+	}
+	return
+}
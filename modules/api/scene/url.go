@@ -18,14 +18,30 @@ func InitSceneRouter(r gin.IRouter) {
 	sceneGroup := r.Group("scenes", middleware.RequireAccount)
 	{
 		sceneGroup.POST("", CreateScene)
+		sceneGroup.POST("dry_run", DryRunScene)
+		sceneGroup.GET("export", ExportScene)
+		sceneGroup.POST("import", ImportScene)
 		sceneGroup.DELETE(":id", requireBelongsToUser, DeleteScene)
 		sceneGroup.PUT(":id", requireBelongsToUser, middleware.RequirePermission(types.SceneUpdate), UpdateScene)
 		sceneGroup.GET("", ListScene)
 		sceneGroup.GET(":id", requireBelongsToUser, InfoScene)
 		sceneGroup.POST(":id/execute", requireBelongsToUser, ExecuteScene)
+		sceneGroup.POST(":id/cancel", requireBelongsToUser, CancelScene)
+		sceneGroup.GET(":id/revisions", requireBelongsToUser, ListSceneRevision)
+		sceneGroup.GET(":id/revision_diff", requireBelongsToUser, DiffSceneRevision)
+		sceneGroup.POST(":id/revisions/:revision/rollback", requireBelongsToUser,
+			middleware.RequirePermission(types.SceneUpdate), RollbackScene)
+		sceneGroup.GET(":id/webhook", requireBelongsToUser,
+			middleware.RequirePermission(types.SceneUpdate), GetSceneWebhook)
+		sceneGroup.POST(":id/webhook/reset", requireBelongsToUser,
+			middleware.RequirePermission(types.SceneUpdate), ResetSceneWebhook)
 	}
 
 	r.GET("scene_logs", middleware.RequireAccount, ListSceneTaskLog)
+	r.GET("scene_logs/stats", middleware.RequireAccount, SceneTaskLogStat)
+	r.POST("scene_blueprints/import", middleware.RequireAccount, ImportBlueprint)
+	// 外部系统通过地址中的密钥触发场景，不需要登录
+	r.POST("scene_webhooks/:token", TriggerSceneWebhook)
 }
 
 // requireBelongsToUser 操作场景需要与用户属于同一个家庭
@@ -38,18 +54,23 @@ func requireBelongsToUser(c *gin.Context) {
 		return
 	}
 
-	scene, err := entity.GetSceneById(sceneID)
-	if err != nil {
-		response.HandleResponse(c, errors.Wrap(err, errors.InternalServerErr), nil)
-		c.Abort()
-		return
-	}
-
-	if u.AreaID != scene.AreaID {
-		response.HandleResponse(c, errors.New(status.Deny), nil)
+	if err = checkSceneArea(sceneID, u.AreaID); err != nil {
+		response.HandleResponse(c, err, nil)
 		c.Abort()
 	} else {
 		c.Next()
 	}
 
 }
+
+// checkSceneArea 场景需要属于家庭 areaID
+func checkSceneArea(sceneID int, areaID uint64) error {
+	scene, err := entity.GetSceneById(sceneID)
+	if err != nil {
+		return errors.Wrap(err, errors.InternalServerErr)
+	}
+	if scene.AreaID != areaID {
+		return errors.New(status.Deny)
+	}
+	return nil
+}
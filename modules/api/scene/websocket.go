@@ -0,0 +1,93 @@
+package scene
+
+import (
+	"encoding/json"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/websocket"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+const (
+	// serviceListScenes 获取场景列表
+	serviceListScenes = "list_scenes"
+	// serviceExecuteScene 执行手动场景，开启或关闭自动场景
+	serviceExecuteScene = "execute_scene"
+	// serviceListSceneLogs 获取场景日志
+	serviceListSceneLogs = "list_scene_logs"
+)
+
+// wsExecuteSceneReq 执行场景命令参数
+type wsExecuteSceneReq struct {
+	SceneID int `json:"scene_id"`
+	ExecuteSceneReq
+}
+
+// RegisterWebsocketCmd 注册场景相关的 websocket 命令
+func RegisterWebsocketCmd() {
+	websocket.RegisterCallFunc(serviceListScenes, listScenesCmd)
+	websocket.RegisterCallFunc(serviceExecuteScene, executeSceneCmd)
+	websocket.RegisterCallFunc(serviceListSceneLogs, listSceneLogsCmd)
+}
+
+// bindServiceData 解析命令参数，没有参数时不解析
+func bindServiceData(cs websocket.CallService, v interface{}) error {
+	if len(cs.ServiceData) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(cs.ServiceData, v); err != nil {
+		return errors.Wrap(err, errors.BadRequest)
+	}
+	return nil
+}
+
+// listScenesCmd 与场景列表接口相同，获取家庭的手动及自动场景
+func listScenesCmd(cs websocket.CallService) (result websocket.Result, err error) {
+	var (
+		req    sceneListReq
+		resp   sceneListResp
+		scenes []entity.Scene
+	)
+	if err = bindServiceData(cs, &req); err != nil {
+		return
+	}
+	if scenes, err = entity.GetScenes(cs.CallUser.AreaID); err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	if resp.Manual, resp.AutoRun, err = WrapScenes(cs.Request, scenes, cs.CallUser.UserID, req.Type); err != nil {
+		return
+	}
+	result = websocket.Result{"manual": resp.Manual, "auto_run": resp.AutoRun}
+	return
+}
+
+// executeSceneCmd 与场景执行接口相同，执行手动场景或开关自动场景
+func executeSceneCmd(cs websocket.CallService) (result websocket.Result, err error) {
+	var req wsExecuteSceneReq
+	if err = bindServiceData(cs, &req); err != nil {
+		return
+	}
+	if err = entity.CheckSceneExitById(req.SceneID); err != nil {
+		return
+	}
+	if err = checkSceneArea(req.SceneID, cs.CallUser.AreaID); err != nil {
+		return
+	}
+	err = req.executeScene(cs.Request, cs.CallUser.UserID, req.SceneID)
+	return
+}
+
+// listSceneLogsCmd 与场景日志接口相同，获取家庭的场景日志
+func listSceneLogsCmd(cs websocket.CallService) (result websocket.Result, err error) {
+	var req ListSceneTaskReq
+	if err = bindServiceData(cs, &req); err != nil {
+		return
+	}
+	logs, err := req.sceneTaskLogs(cs.CallUser.AreaID)
+	if err != nil {
+		return
+	}
+	result = websocket.Result{"logs": logs}
+	return
+}
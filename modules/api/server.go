@@ -9,7 +9,10 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zhiting-tech/smartassistant/modules/api/device"
+	"github.com/zhiting-tech/smartassistant/modules/api/location"
 	"github.com/zhiting-tech/smartassistant/modules/api/middleware"
+	"github.com/zhiting-tech/smartassistant/modules/api/scene"
 	"github.com/zhiting-tech/smartassistant/modules/config"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
 )
@@ -29,6 +32,9 @@ func NewHttpServer(ws gin.HandlerFunc) *HttpServer {
 	apiGroup := r.Group("api")
 	// 注册websocket命令
 	websocket.RegisterCmd()
+	device.RegisterWebsocketCmd()
+	location.RegisterWebsocketCmd()
+	scene.RegisterWebsocketCmd()
 	r.GET("/ws", middleware.RequireToken, ws)
 	loadModules(apiGroup)
 	apiGroup.Static(fmt.Sprintf("static/%s/sa", conf.SmartAssistant.ID), "./static")
@@ -5,6 +5,7 @@ import (
 	"github.com/zhiting-tech/smartassistant/modules/api/utils/oauth"
 	"github.com/zhiting-tech/smartassistant/modules/api/utils/response"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/event"
 	"github.com/zhiting-tech/smartassistant/modules/types"
 	"github.com/zhiting-tech/smartassistant/modules/types/status"
 	jwt2 "github.com/zhiting-tech/smartassistant/modules/utils/jwt"
@@ -138,6 +139,9 @@ func (req *checkQrCodeReq) checkQrCode(c *gin.Context) (resp CheckQrCodeResp, er
 	if err = entity.CreateUserRole(uRoles); err != nil {
 		return
 	}
+	if u == nil {
+		event.Publish(event.UserJoined{AreaID: user.AreaID, UserID: user.ID})
+	}
 
 	resp.UserInfo = entity.UserInfo{
 		UserId:        user.ID,
@@ -0,0 +1,264 @@
+package blueprint
+
+import (
+	"encoding/json"
+	errors2 "errors"
+	"time"
+
+	"github.com/jinzhu/now"
+	"gorm.io/gorm"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/plugin"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+)
+
+const (
+	defaultRepeatDate = "1234567"
+	clockLayout       = "15:04"
+)
+
+// Bindings 蓝图参数名 -> 设备id或场景id
+type Bindings map[string]int
+
+// binder 绑定蓝图参数时缓存设备及其可控制的属性
+type binder struct {
+	areaID   uint64
+	bindings Bindings
+	devices  map[string]entity.Device
+	attrs    map[string][]entity.Attribute
+}
+
+// Bind 将蓝图参数绑定到 areaID 家庭中的设备或场景，生成场景及其触发条件
+// 设备属性按设备的物模型校验，day 为计算定时条件和生效时间使用的日期
+func (bp Blueprint) Bind(areaID uint64, bindings Bindings, day time.Time) (scene entity.Scene, conditions []entity.ConditionInfo, err error) {
+	b := binder{
+		areaID:   areaID,
+		bindings: bindings,
+		devices:  make(map[string]entity.Device),
+		attrs:    make(map[string][]entity.Attribute),
+	}
+	for _, input := range bp.Inputs {
+		if err = b.bind(input); err != nil {
+			return
+		}
+	}
+
+	scene = entity.Scene{
+		Name:           bp.Name,
+		AutoRun:        bp.AutoRun,
+		ConditionLogic: bp.ConditionLogic,
+		Mode:           bp.Mode,
+		MaxRuns:        bp.MaxRuns,
+		TimePeriodType: bp.TimePeriodType,
+		RepeatType:     bp.RepeatType,
+		RepeatDate:     bp.RepeatDate,
+		AreaID:         areaID,
+	}
+	if scene.AutoRun {
+		if err = bp.setEffectTime(&scene, day); err != nil {
+			return
+		}
+		if bp.ConditionTree != nil {
+			if scene.ConditionTree, err = json.Marshal(bp.ConditionTree); err != nil {
+				return
+			}
+		}
+		for _, c := range bp.Conditions {
+			var ci entity.ConditionInfo
+			if ci, err = b.condition(c, day); err != nil {
+				return
+			}
+			conditions = append(conditions, ci)
+		}
+	}
+
+	for _, t := range bp.Tasks {
+		var st entity.SceneTask
+		if st, err = b.task(t); err != nil {
+			return
+		}
+		scene.SceneTasks = append(scene.SceneTasks, st)
+	}
+	return
+}
+
+// setEffectTime 设置场景的生效时间，未设置时全天生效、每天重复
+func (bp Blueprint) setEffectTime(scene *entity.Scene, day time.Time) (err error) {
+	if scene.TimePeriodType == 0 {
+		scene.TimePeriodType = entity.TimePeriodTypeAllDay
+	}
+	if scene.RepeatType == 0 {
+		scene.RepeatType = entity.RepeatTypeAllDay
+		scene.RepeatDate = defaultRepeatDate
+	}
+
+	scene.EffectStart = now.New(day).BeginningOfDay()
+	scene.EffectEnd = now.New(day).EndOfDay()
+	if scene.TimePeriodType == entity.TimePeriodTypeCustom {
+		if scene.EffectStart, err = clockAt(day, bp.EffectStart); err != nil {
+			return errors.Newf(status.BlueprintFormatErr, "生效时间")
+		}
+		if scene.EffectEnd, err = clockAt(day, bp.EffectEnd); err != nil {
+			return errors.Newf(status.BlueprintFormatErr, "生效时间")
+		}
+	}
+	return
+}
+
+// bind 绑定参数，设备参数需要与蓝图中的设备类型一致
+func (b *binder) bind(input Input) (err error) {
+	id, ok := b.bindings[input.Name]
+	if !ok || id == 0 {
+		return errors.Newf(status.BlueprintInputNotBound, input.Name)
+	}
+
+	if input.Type == InputTypeScene {
+		var scene entity.Scene
+		if scene, err = entity.GetSceneById(id); err != nil {
+			return wrapNotFound(err, status.SceneNotExist)
+		}
+		if scene.AreaID != b.areaID {
+			return errors.New(status.SceneNotExist)
+		}
+		return
+	}
+
+	var device entity.Device
+	if device, err = entity.GetDeviceByID(id); err != nil {
+		return wrapNotFound(err, status.DeviceNotExist)
+	}
+	if device.AreaID != b.areaID {
+		return errors.New(status.DeviceNotExist)
+	}
+	if device.Type != input.DeviceType {
+		return errors.Newf(status.BlueprintDeviceTypeMismatch, input.Name)
+	}
+	if b.attrs[input.Name], err = plugin.GetControlAttributes(device); err != nil {
+		return errors.Wrap(err, errors.InternalServerErr)
+	}
+	b.devices[input.Name] = device
+	return
+}
+
+// condition 生成触发条件
+func (b *binder) condition(c Condition, day time.Time) (ci entity.ConditionInfo, err error) {
+	ci.SceneCondition = entity.SceneCondition{
+		ConditionType: c.ConditionType,
+		Key:           c.Key,
+		SolarEvent:    c.SolarEvent,
+		SolarOffset:   c.SolarOffset,
+		CronExpr:      c.CronExpr,
+		Operator:      c.Operator,
+		Duration:      c.Duration,
+	}
+	switch c.ConditionType {
+	case entity.ConditionTypeTiming:
+		var t time.Time
+		if t, err = clockAt(day, c.Timing); err != nil {
+			err = errors.Newf(status.BlueprintFormatErr, "定时时间")
+			return
+		}
+		ci.Timing = t.Unix()
+	case entity.ConditionTypeDeviceStatus:
+		var attr entity.Attribute
+		if attr, err = b.attribute(c.Device, c.AttrRef); err != nil {
+			return
+		}
+		ci.DeviceID = b.devices[c.Device].ID
+		if ci.ConditionAttr, err = json.Marshal(attr); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// task 生成执行任务
+func (b *binder) task(t Task) (st entity.SceneTask, err error) {
+	st = entity.SceneTask{
+		Type:         t.Type,
+		DelaySeconds: t.DelaySeconds,
+	}
+	if t.Type != entity.TaskTypeSmartDevice {
+		st.ControlSceneID = b.bindings[t.Scene]
+		return
+	}
+
+	attrs := make([]entity.Attribute, 0, len(t.Attributes))
+	for _, ref := range t.Attributes {
+		var attr entity.Attribute
+		if attr, err = b.attribute(t.Device, ref); err != nil {
+			return
+		}
+		attrs = append(attrs, attr)
+	}
+	st.DeviceID = b.devices[t.Device].ID
+	st.Attributes, err = json.Marshal(attrs)
+	return
+}
+
+// attribute 在设备物模型的控制属性中查找引用的属性，并校验属性值的范围
+func (b *binder) attribute(input string, ref AttrRef) (attr entity.Attribute, err error) {
+	device := b.devices[input]
+	var index int
+	for _, a := range b.attrs[input] {
+		if a.Attribute.Attribute != ref.Attribute {
+			continue
+		}
+		if index != ref.Instance {
+			index++
+			continue
+		}
+		if !isValInRange(a.Attribute, ref.Val) {
+			err = errors.Newf(status.SceneParamIncorrectErr, "属性 "+ref.Attribute+" 的值")
+			return
+		}
+		attr = entity.Attribute{
+			Attribute: server.Attribute{
+				Attribute: ref.Attribute,
+				Val:       ref.Val,
+			},
+			InstanceID: a.InstanceID,
+		}
+		return
+	}
+	err = errors.Newf(status.BlueprintAttrNotSupport, device.Name, ref.Attribute)
+	return
+}
+
+// isValInRange 数值类型的属性值需要在物模型的最小值和最大值之间，范围和枚举值逐个判断
+func isValInRange(attr server.Attribute, val interface{}) bool {
+	switch v := val.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if !isValInRange(attr, item) {
+				return false
+			}
+		}
+		return true
+	case int:
+		return (attr.Min == nil || v >= *attr.Min) && (attr.Max == nil || v <= *attr.Max)
+	case float64:
+		return (attr.Min == nil || v >= float64(*attr.Min)) && (attr.Max == nil || v <= float64(*attr.Max))
+	}
+	return true
+}
+
+// clockAt 获取 day 当天 时:分 对应的时间
+func clockAt(day time.Time, clock string) (t time.Time, err error) {
+	c, err := time.ParseInLocation(clockLayout, clock, day.Location())
+	if err != nil {
+		return
+	}
+	return now.New(day).BeginningOfDay().Add(time.Duration(c.Hour())*time.Hour +
+		time.Duration(c.Minute())*time.Minute), nil
+}
+
+func wrapNotFound(err error, code int) error {
+	if errors2.Is(err, gorm.ErrRecordNotFound) {
+		return errors.Wrap(err, code)
+	}
+	return errors.Wrap(err, errors.InternalServerErr)
+}
@@ -0,0 +1,161 @@
+// Package blueprint 场景蓝图，以设备类型和属性描述场景的触发条件和执行任务，
+// 绑定到家庭中的具体设备后生成场景
+package blueprint
+
+import (
+	"gopkg.in/yaml.v2"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// InputType 蓝图参数类型
+type InputType string
+
+const (
+	InputTypeDevice InputType = "device" // 设备（默认）
+	InputTypeScene  InputType = "scene"  // 场景，用于控制场景的执行任务
+)
+
+// Blueprint 场景蓝图，使用 YAML 或 JSON 描述
+type Blueprint struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+
+	AutoRun        bool                   `json:"auto_run" yaml:"auto_run"`
+	ConditionLogic int                    `json:"condition_logic" yaml:"condition_logic"` // 1 为 全部满足，2为满足任一
+	ConditionTree  *entity.ConditionGroup `json:"condition_tree" yaml:"condition_tree"`   // 条件组，通过 key 引用条件
+	Mode           entity.SceneMode       `json:"mode" yaml:"mode"`
+	MaxRuns        int                    `json:"max_runs" yaml:"max_runs"`
+
+	// 生效时间，为空时全天生效、每天重复
+	TimePeriodType entity.TimePeriodType `json:"time_period" yaml:"time_period"`
+	EffectStart    string                `json:"effect_start" yaml:"effect_start"` // 时:分，如 08:00
+	EffectEnd      string                `json:"effect_end" yaml:"effect_end"`
+	RepeatType     entity.RepeatType     `json:"repeat_type" yaml:"repeat_type"`
+	RepeatDate     string                `json:"repeat_date" yaml:"repeat_date"`
+
+	Inputs     []Input     `json:"inputs" yaml:"inputs"`
+	Conditions []Condition `json:"conditions" yaml:"conditions"`
+	Tasks      []Task      `json:"tasks" yaml:"tasks"`
+}
+
+// Input 蓝图参数，导入时绑定到家庭中的设备或场景
+type Input struct {
+	Name        string    `json:"name" yaml:"name"`
+	Type        InputType `json:"type" yaml:"type"`
+	DeviceType  string    `json:"device_type" yaml:"device_type"` // 设备类型，如：light,switch...
+	Description string    `json:"description" yaml:"description"`
+}
+
+// AttrRef 引用设备物模型中的属性
+type AttrRef struct {
+	Attribute string `json:"attribute" yaml:"attribute"`
+	// Instance 设备有多个实例包含该属性时（如多键开关），使用第几个实例，从0开始
+	Instance int         `json:"instance" yaml:"instance"`
+	Val      interface{} `json:"val" yaml:"val"`
+}
+
+// Condition 蓝图中的触发条件
+type Condition struct {
+	ConditionType entity.ConditionType `json:"condition_type" yaml:"condition_type"`
+	Key           string               `json:"key" yaml:"key"`
+
+	Timing      string                `json:"timing" yaml:"timing"` // 定时条件的时:分
+	SolarEvent  entity.SolarEventType `json:"solar_event" yaml:"solar_event"`
+	SolarOffset int                   `json:"solar_offset" yaml:"solar_offset"`
+	CronExpr    string                `json:"cron_expr" yaml:"cron_expr"`
+
+	Device   string              `json:"device" yaml:"device"` // 引用的设备参数
+	AttrRef  `yaml:",inline"`    // 条件属性
+	Operator entity.OperatorType `json:"operator" yaml:"operator"`
+	Duration int                 `json:"duration" yaml:"duration"`
+}
+
+// Task 蓝图中的执行任务
+type Task struct {
+	Type         entity.TaskType `json:"type" yaml:"type"`
+	DelaySeconds int             `json:"delay_seconds" yaml:"delay_seconds"`
+	Device       string          `json:"device" yaml:"device"` // 控制设备时引用的设备参数
+	Attributes   []AttrRef       `json:"attributes" yaml:"attributes"`
+	Scene        string          `json:"scene" yaml:"scene"` // 控制场景时引用的场景参数
+}
+
+// Parse 解析 YAML 或 JSON 格式的蓝图
+func Parse(data []byte) (bp Blueprint, err error) {
+	if err = yaml.Unmarshal(data, &bp); err != nil {
+		err = errors.Wrapf(err, status.BlueprintFormatErr, err.Error())
+		return
+	}
+	if err = bp.check(); err != nil {
+		return
+	}
+	return
+}
+
+// check 校验蓝图中引用的参数
+func (bp *Blueprint) check() (err error) {
+	if len(bp.Tasks) == 0 {
+		return errors.Newf(status.BlueprintFormatErr, "缺少执行任务")
+	}
+	if bp.AutoRun && len(bp.Conditions) == 0 {
+		return errors.Newf(status.BlueprintFormatErr, "缺少触发条件")
+	}
+
+	inputs := make(map[string]Input)
+	for i, input := range bp.Inputs {
+		if input.Type == "" {
+			input.Type = InputTypeDevice
+			bp.Inputs[i].Type = InputTypeDevice
+		}
+		if input.Name == "" {
+			return errors.Newf(status.BlueprintFormatErr, "参数名称不能为空")
+		}
+		if _, ok := inputs[input.Name]; ok {
+			return errors.Newf(status.BlueprintFormatErr, "参数 "+input.Name+" 重复")
+		}
+		switch input.Type {
+		case InputTypeDevice:
+			if input.DeviceType == "" {
+				return errors.Newf(status.BlueprintFormatErr, "参数 "+input.Name+" 缺少设备类型")
+			}
+		case InputTypeScene:
+		default:
+			return errors.Newf(status.BlueprintFormatErr, "参数 "+input.Name+" 类型错误")
+		}
+		inputs[input.Name] = input
+	}
+
+	for _, c := range bp.Conditions {
+		if c.ConditionType != entity.ConditionTypeDeviceStatus {
+			continue
+		}
+		if err = checkInputRef(inputs, c.Device, InputTypeDevice); err != nil {
+			return
+		}
+	}
+	for _, t := range bp.Tasks {
+		if st := (entity.SceneTask{Type: t.Type}); st.IsControlStep() || st.IsNotification() {
+			return errors.Newf(status.BlueprintFormatErr, "不支持流程控制步骤和通知")
+		}
+		if t.Type == entity.TaskTypeSmartDevice {
+			err = checkInputRef(inputs, t.Device, InputTypeDevice)
+		} else {
+			err = checkInputRef(inputs, t.Scene, InputTypeScene)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// checkInputRef 校验引用的参数存在且类型一致
+func checkInputRef(inputs map[string]Input, name string, inputType InputType) error {
+	input, ok := inputs[name]
+	if !ok || input.Type != inputType {
+		return errors.Newf(status.BlueprintFormatErr, "引用的参数 "+name+" 不存在")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package blueprint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+)
+
+const leaveHome = `
+name: 离家
+auto_run: true
+condition_logic: 1
+mode: single
+inputs:
+  - name: door
+    device_type: door_sensor
+  - name: light
+    device_type: light
+conditions:
+  - condition_type: 1
+    timing: "08:30"
+  - condition_type: 2
+    device: door
+    attribute: contact
+    operator: changed_to
+    val: "closed"
+tasks:
+  - type: 1
+    device: light
+    attributes:
+      - attribute: power
+        val: "off"
+      - attribute: brightness
+        val: 0
+`
+
+func TestParse(t *testing.T) {
+	bp, err := Parse([]byte(leaveHome))
+	assert.Nil(t, err)
+	assert.Equal(t, "离家", bp.Name)
+	assert.Equal(t, entity.SceneModeSingle, bp.Mode)
+	assert.Equal(t, InputTypeDevice, bp.Inputs[0].Type)
+	assert.Equal(t, "contact", bp.Conditions[1].Attribute)
+	assert.Equal(t, entity.OperatorChangedTo, bp.Conditions[1].Operator)
+	assert.Len(t, bp.Tasks[0].Attributes, 2)
+
+	// JSON 格式
+	bp, err = Parse([]byte(`{"name":"晚安","inputs":[{"name":"light","device_type":"light"}],
+		"tasks":[{"type":1,"device":"light","attributes":[{"attribute":"power","val":"off"}]}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "light", bp.Tasks[0].Device)
+
+	// 引用未声明的参数
+	_, err = Parse([]byte(`{"name":"晚安","tasks":[{"type":2,"scene":"night"}]}`))
+	assert.NotNil(t, err)
+}
+
+func TestIsValInRange(t *testing.T) {
+	min, max := 1, 100
+	attr := server.Attribute{Attribute: "brightness", Min: &min, Max: &max}
+	assert.True(t, isValInRange(attr, 50))
+	assert.False(t, isValInRange(attr, 0))
+	assert.False(t, isValInRange(attr, []interface{}{1.0, 120.0}))
+	assert.True(t, isValInRange(server.Attribute{Attribute: "power"}, "on"))
+}
+
+func TestClockAt(t *testing.T) {
+	day := time.Date(2021, 6, 1, 15, 4, 5, 0, time.Local)
+	at, err := clockAt(day, "08:30")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2021, 6, 1, 8, 30, 0, 0, time.Local), at)
+	_, err = clockAt(day, "8点")
+	assert.NotNil(t, err)
+}
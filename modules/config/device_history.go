@@ -0,0 +1,40 @@
+package config
+
+const (
+	// defaultHistoryRetentionDays 设备状态历史默认保留的天数
+	defaultHistoryRetentionDays = 30
+	// defaultHistoryMaxCount 默认最多保留的设备状态历史记录数
+	defaultHistoryMaxCount = 1000000
+)
+
+// DeviceHistory 设备状态历史的配置
+type DeviceHistory struct {
+	// Disabled 是否不记录设备状态历史
+	Disabled bool `json:"disabled" yaml:"disabled"`
+	// RetentionDays 状态历史保留的天数，默认为 30 天，小于0时不按时间清理
+	RetentionDays int `json:"retention_days" yaml:"retention_days"`
+	// MaxCount 最多保留的状态历史记录数（所有设备），默认为 1000000，小于0时不按数量清理
+	MaxCount int `json:"max_count" yaml:"max_count"`
+}
+
+// GetRetentionDays 获取状态历史保留的天数，返回0表示不按时间清理
+func (h DeviceHistory) GetRetentionDays() int {
+	if h.RetentionDays < 0 {
+		return 0
+	}
+	if h.RetentionDays == 0 {
+		return defaultHistoryRetentionDays
+	}
+	return h.RetentionDays
+}
+
+// GetMaxCount 获取最多保留的状态历史记录数，返回0表示不按数量清理
+func (h DeviceHistory) GetMaxCount() int {
+	if h.MaxCount < 0 {
+		return 0
+	}
+	if h.MaxCount == 0 {
+		return defaultHistoryMaxCount
+	}
+	return h.MaxCount
+}
@@ -0,0 +1,51 @@
+package config
+
+const (
+	// defaultMQTTTopicPrefix MQTT 主题的默认前缀
+	defaultMQTTTopicPrefix = "sa"
+	// defaultMQTTClientID 连接 MQTT 服务器默认的客户端ID
+	defaultMQTTClientID = "smartassistant"
+)
+
+// MQTT 内置 MQTT 客户端的配置，启用后将设备的属性状态发布到 MQTT 服务器，并订阅设置属性的主题
+type MQTT struct {
+	// Enabled 是否启用，默认不启用
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Broker MQTT 服务器地址，如 tcp://127.0.0.1:1883
+	Broker   string `json:"broker" yaml:"broker"`
+	ClientID string `json:"client_id" yaml:"client_id"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	// TopicPrefix 主题前缀，默认为 sa
+	TopicPrefix string `json:"topic_prefix" yaml:"topic_prefix"`
+	// QoS 发布及订阅的服务质量等级，0-2
+	QoS byte `json:"qos" yaml:"qos"`
+	// Retain 发布的属性状态是否保留，保留时新的订阅者能立即收到最新的状态
+	Retain bool `json:"retain" yaml:"retain"`
+	// ServiceUserID 通过 MQTT 设置属性时使用的用户，只能控制该用户所在家庭中有控制权限的设备属性，为0时不订阅设置属性的主题
+	ServiceUserID int `json:"service_user_id" yaml:"service_user_id"`
+}
+
+// GetTopicPrefix 获取主题前缀
+func (m MQTT) GetTopicPrefix() string {
+	if m.TopicPrefix == "" {
+		return defaultMQTTTopicPrefix
+	}
+	return m.TopicPrefix
+}
+
+// GetClientID 获取客户端ID
+func (m MQTT) GetClientID() string {
+	if m.ClientID == "" {
+		return defaultMQTTClientID
+	}
+	return m.ClientID
+}
+
+// GetQoS 获取服务质量等级，超出范围时使用最高等级
+func (m MQTT) GetQoS() byte {
+	if m.QoS > 2 {
+		return 2
+	}
+	return m.QoS
+}
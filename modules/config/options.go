@@ -6,4 +6,7 @@ type Options struct {
 	SmartAssistant SmartAssistant `json:"smartassistant" yaml:"smartassistant"`
 	Docker         Docker         `json:"docker" yaml:"docker"`
 	Datatunnel     Datatunnel     `json:"datatunnel" yaml:"datatunnel"`
+	Task           Task           `json:"task" yaml:"task"`
+	DeviceHistory  DeviceHistory  `json:"device_history" yaml:"device_history"`
+	MQTT           MQTT           `json:"mqtt" yaml:"mqtt"`
 }
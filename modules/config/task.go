@@ -0,0 +1,110 @@
+package config
+
+import "time"
+
+// 服务重启后，已过执行时间的任务的处理方式
+const (
+	MissedTaskRun   = "run"   // 立即执行
+	MissedTaskSkip  = "skip"  // 跳过不执行
+	MissedTaskGrace = "grace" // 在宽限时间内则立即执行，否则跳过
+)
+
+const (
+	// defaultGracePeriod 默认的宽限秒数
+	defaultGracePeriod = 5 * 60
+	// defaultLogRetentionDays 执行日志默认保留的天数
+	defaultLogRetentionDays = 90
+	// defaultLogMaxCount 每个家庭默认最多保留的执行日志数
+	defaultLogMaxCount = 10000
+	// defaultDeviceTimeout 控制设备的任务默认的超时秒数
+	defaultDeviceTimeout = 30
+	// defaultDeviceRetries 设置设备属性遇到临时错误时默认的重试次数
+	defaultDeviceRetries = 2
+	// defaultDeviceRetryInterval 默认的首次重试间隔毫秒数
+	defaultDeviceRetryInterval = 500
+)
+
+type Task struct {
+	// MissedPolicy 已过执行时间的任务的处理方式，默认为 grace
+	MissedPolicy string `json:"missed_policy" yaml:"missed_policy"`
+	// GracePeriod 宽限秒数，默认为 5 分钟
+	GracePeriod int `json:"grace_period" yaml:"grace_period"`
+
+	// LogRetentionDays 执行日志保留的天数，默认为 90 天，小于0时不按时间清理
+	LogRetentionDays int `json:"log_retention_days" yaml:"log_retention_days"`
+	// LogMaxCount 每个家庭最多保留的场景执行日志数，默认为 10000，小于0时不按数量清理
+	LogMaxCount int `json:"log_max_count" yaml:"log_max_count"`
+
+	// DeviceTimeout 控制设备的任务的超时秒数（包括重试），默认为 30 秒，任务可以单独设置
+	DeviceTimeout int `json:"device_timeout" yaml:"device_timeout"`
+	// DeviceRetries 设置设备属性遇到临时错误时的重试次数，默认为 2 次，小于0时不重试
+	DeviceRetries int `json:"device_retries" yaml:"device_retries"`
+	// DeviceRetryInterval 首次重试间隔的毫秒数，之后每次加倍，默认为 500 毫秒
+	DeviceRetryInterval int `json:"device_retry_interval" yaml:"device_retry_interval"`
+}
+
+// GetMissedPolicy 获取已过执行时间的任务的处理方式
+func (t Task) GetMissedPolicy() string {
+	switch t.MissedPolicy {
+	case MissedTaskRun, MissedTaskSkip:
+		return t.MissedPolicy
+	}
+	return MissedTaskGrace
+}
+
+// GetGracePeriod 获取宽限秒数
+func (t Task) GetGracePeriod() int {
+	if t.GracePeriod <= 0 {
+		return defaultGracePeriod
+	}
+	return t.GracePeriod
+}
+
+// GetLogRetentionDays 获取执行日志保留的天数，为0时不按时间清理
+func (t Task) GetLogRetentionDays() int {
+	if t.LogRetentionDays < 0 {
+		return 0
+	}
+	if t.LogRetentionDays == 0 {
+		return defaultLogRetentionDays
+	}
+	return t.LogRetentionDays
+}
+
+// GetLogMaxCount 获取每个家庭最多保留的场景执行日志数，为0时不按数量清理
+func (t Task) GetLogMaxCount() int {
+	if t.LogMaxCount < 0 {
+		return 0
+	}
+	if t.LogMaxCount == 0 {
+		return defaultLogMaxCount
+	}
+	return t.LogMaxCount
+}
+
+// GetDeviceTimeout 获取控制设备的任务的超时时间
+func (t Task) GetDeviceTimeout() time.Duration {
+	if t.DeviceTimeout <= 0 {
+		return defaultDeviceTimeout * time.Second
+	}
+	return time.Duration(t.DeviceTimeout) * time.Second
+}
+
+// GetDeviceRetries 获取设置设备属性遇到临时错误时的重试次数
+func (t Task) GetDeviceRetries() int {
+	if t.DeviceRetries < 0 {
+		return 0
+	}
+	if t.DeviceRetries == 0 {
+		return defaultDeviceRetries
+	}
+	return t.DeviceRetries
+}
+
+// GetDeviceRetryInterval 获取首次重试的间隔
+func (t Task) GetDeviceRetryInterval() time.Duration {
+	if t.DeviceRetryInterval <= 0 {
+		return defaultDeviceRetryInterval * time.Millisecond
+	}
+	return time.Duration(t.DeviceRetryInterval) * time.Millisecond
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/event"
 	"github.com/zhiting-tech/smartassistant/modules/plugin"
 	"github.com/zhiting-tech/smartassistant/modules/types"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
@@ -35,6 +36,7 @@ func Create(areaID uint64, device *entity.Device) (err error) {
 	}); err != nil {
 		return
 	}
+	event.Publish(event.DeviceAdded{Device: *device})
 	return
 }
 
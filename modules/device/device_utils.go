@@ -30,6 +30,10 @@ func ControlPermissions(d entity.Device) ([]types.Permission, error) {
 	target := types.DeviceTarget(d.ID)
 	res := make([]types.Permission, 0)
 	for _, attr := range as {
+		// 只读属性不能控制
+		if attr.ReadOnly {
+			continue
+		}
 		name := attr.Attribute.Attribute
 		attribute := entity.PluginDeviceAttr(attr.InstanceID, attr.Attribute.Attribute)
 		p := types.Permission{Name: name, Action: "control", Target: target, Attribute: attribute}
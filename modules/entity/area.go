@@ -24,6 +24,10 @@ type Area struct {
 	CreatedAt time.Time `json:"created_at"`
 	OwnerID   int       `json:"owner_id"`
 	Deleted   gorm.DeletedAt
+
+	// 家庭所在经纬度，用于计算日出日落等场景触发时间
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
 }
 
 func (d Area) TableName() string {
@@ -57,6 +61,11 @@ func (d *Area) AfterDelete(tx *gorm.DB) (err error) {
 	return
 }
 
+// HasCoordinate 是否已设置家庭经纬度（经纬度均为0视为未设置）
+func (d Area) HasCoordinate() bool {
+	return d.Latitude != 0 || d.Longitude != 0
+}
+
 func (d *Area) BeforeCreate(tx *gorm.DB) (err error) {
 	d.ID = utils.SAAreaID()
 	return nil
@@ -112,6 +121,16 @@ func UpdateArea(id uint64, name string) (err error) {
 	return
 }
 
+// UpdateAreaCoordinate 修改家庭经纬度
+func UpdateAreaCoordinate(id uint64, latitude, longitude float64) (err error) {
+	updates := map[string]interface{}{
+		"latitude":  latitude,
+		"longitude": longitude,
+	}
+	err = GetDB().First(&Area{}, "id = ?", id).Updates(updates).Error
+	return
+}
+
 func SetAreaOwnerID(id uint64, ownerID int, tx *gorm.DB) (err error) {
 	err = tx.First(&Area{}, "id = ?", id).Update("owner_id", ownerID).Error
 	return
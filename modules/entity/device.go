@@ -70,6 +70,12 @@ func GetPluginDevice(areaID uint64, pluginID, identity string) (device Device, e
 	return
 }
 
+// GetAreaDevice 根据 identity 获取家庭的设备
+func GetAreaDevice(areaID uint64, identity string) (device Device, err error) {
+	err = GetDBWithAreaScope(areaID).Where(Device{Identity: identity}).First(&device).Error
+	return
+}
+
 // GetManufacturerDevice 获取厂商的设备
 func GetManufacturerDevice(areaID uint64, manufacturer, identity string) (device Device, err error) {
 	filter := Device{
@@ -0,0 +1,129 @@
+package entity
+
+import (
+	errors2 "errors"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	// energyDateLayout 用电量记录的日期格式
+	energyDateLayout = "2006-01-02"
+
+	// energyResetTolerance 累计用电量比上次上报的值小，但不超过该值（单位 kWh）时认为是读数误差，而不是设备重置了计数
+	energyResetTolerance = 0.01
+
+	EnergyPeriodDay   = "day"   // 按天统计用电量
+	EnergyPeriodMonth = "month" // 按月统计用电量
+)
+
+// legacyEnergyIndex 不区分电量计量实例的旧唯一索引，AutoMigrate 不会修改已存在的索引，需要删除
+const legacyEnergyIndex = "idx_device_energies_date"
+
+// DeviceEnergy 设备每个电量计量实例每天的用电量，由实例上报的累计用电量计算
+type DeviceEnergy struct {
+	ID          int
+	DeviceID    int     `gorm:"uniqueIndex:idx_device_energies_instance_date"`
+	InstanceID  int     `gorm:"uniqueIndex:idx_device_energies_instance_date"`                  // 电量计量实例，如多孔插座的每个插孔
+	Date        string  `gorm:"uniqueIndex:idx_device_energies_instance_date;type:varchar(10)"` // 日期，如 2021-10-01
+	Consumption float64 // 当天的用电量，单位 kWh
+	LastReading float64 // 最后一次上报的累计用电量
+	UpdatedAt   time.Time
+
+	AreaID uint64 `gorm:"type:bigint;index"`
+	Area   Area   `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+func (e DeviceEnergy) TableName() string {
+	return "device_energies"
+}
+
+// dropLegacyEnergyIndex 删除用电量表的旧唯一索引
+func dropLegacyEnergyIndex(db *gorm.DB) error {
+	if !db.Migrator().HasIndex(&DeviceEnergy{}, legacyEnergyIndex) {
+		return nil
+	}
+	return db.Migrator().DropIndex(&DeviceEnergy{}, legacyEnergyIndex)
+}
+
+// AddEnergyReading 记录设备的电量计量实例 instanceID 在 at 时上报的累计用电量 reading，
+// 与该实例上次上报的差值计入当天的用电量；累计用电量小于上次上报的值时认为设备重置了计数，
+// reading 即为重置后的用电量，只小了不超过 energyResetTolerance 时视为读数误差，不计入用电量
+func AddEnergyReading(d Device, instanceID int, reading float64, at time.Time) error {
+	date := at.Format(energyDateLayout)
+	return GetDB().Transaction(func(tx *gorm.DB) error {
+		var last DeviceEnergy
+		err := tx.Where("device_id=? and instance_id=?", d.ID, instanceID).
+			Order("date desc").First(&last).Error
+		if err != nil && !errors2.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		// 第一次上报时没有可以比较的值，不计入用电量
+		var delta float64
+		if err == nil {
+			delta = reading - last.LastReading
+			if delta < -energyResetTolerance {
+				delta = reading
+			} else if delta < 0 {
+				// 读数误差，保留较大的读数作为下次比较的值
+				delta, reading = 0, last.LastReading
+			}
+		}
+
+		if err == nil && last.Date == date {
+			return tx.Model(&last).Updates(map[string]interface{}{
+				"consumption":  gorm.Expr("consumption + ?", delta),
+				"last_reading": reading,
+			}).Error
+		}
+		return tx.Create(&DeviceEnergy{
+			DeviceID:    d.ID,
+			InstanceID:  instanceID,
+			Date:        date,
+			Consumption: delta,
+			LastReading: reading,
+			AreaID:      d.AreaID,
+		}).Error
+	})
+}
+
+// EnergyQuery 用电量的查询条件，日期范围包含开始和结束日期
+type EnergyQuery struct {
+	AreaID     uint64
+	DeviceID   int // 为0时统计所有设备
+	LocationID int // 为0时不按房间筛选
+	StartDate  time.Time
+	EndDate    time.Time
+}
+
+// EnergyConsumption 一个统计周期内的用电量
+type EnergyConsumption struct {
+	Date        string  `json:"date" gorm:"column:period"` // 日期或月份，如 2021-10-01、2021-10
+	Consumption float64 `json:"consumption" gorm:"column:total"`
+}
+
+// GetEnergyConsumptions 按天或按月统计用电量，没有记录的周期不返回
+func GetEnergyConsumptions(q EnergyQuery, period string) (consumptions []EnergyConsumption, err error) {
+	dateExpr := "date"
+	if period == EnergyPeriodMonth {
+		dateExpr = "substr(date, 1, 7)"
+	}
+	query := GetDB().Model(&DeviceEnergy{}).
+		Where("area_id=? and date>=? and date<=?", q.AreaID,
+			q.StartDate.Format(energyDateLayout), q.EndDate.Format(energyDateLayout))
+	if q.DeviceID != 0 {
+		query = query.Where("device_id=?", q.DeviceID)
+	}
+	if q.LocationID != 0 {
+		query = query.Where("device_id in (?)",
+			GetDB().Model(&Device{}).Where("location_id=?", q.LocationID).Select("id"))
+	}
+	if err = query.Select(dateExpr + " as period, sum(consumption) as total").
+		Group("period").Order("period asc").
+		Scan(&consumptions).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddEnergyReading(t *testing.T) {
+	area := Area{Name: "test_device_energy"}
+	assert.NoError(t, GetDB().Create(&area).Error)
+	location := Location{Name: "energy", AreaID: area.ID}
+	assert.NoError(t, GetDB().Create(&location).Error)
+	device := Device{Name: "outlet", Identity: "energy_outlet", AreaID: area.ID, LocationID: location.ID}
+	assert.NoError(t, GetDB().Create(&device).Error)
+
+	day1 := time.Date(2021, 10, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	assert.NoError(t, AddEnergyReading(device, 1, 100, day1)) // 第一次上报不计入
+	assert.NoError(t, AddEnergyReading(device, 1, 101.5, day1))
+	assert.NoError(t, AddEnergyReading(device, 1, 103, day2))
+	assert.NoError(t, AddEnergyReading(device, 1, 0.5, day2)) // 设备重置了计数
+	assert.NoError(t, AddEnergyReading(device, 1, 1, day2))
+
+	q := EnergyQuery{AreaID: area.ID, StartDate: day1, EndDate: day2}
+	consumptions, err := GetEnergyConsumptions(q, EnergyPeriodDay)
+	assert.NoError(t, err)
+	if assert.Len(t, consumptions, 2) {
+		assert.Equal(t, EnergyConsumption{Date: "2021-10-01", Consumption: 1.5}, consumptions[0])
+		assert.Equal(t, EnergyConsumption{Date: "2021-10-02", Consumption: 2.5}, consumptions[1])
+	}
+
+	q.LocationID = location.ID
+	consumptions, err = GetEnergyConsumptions(q, EnergyPeriodMonth)
+	assert.NoError(t, err)
+	assert.Equal(t, []EnergyConsumption{{Date: "2021-10", Consumption: 4}}, consumptions)
+
+	q.LocationID = location.ID + 1
+	consumptions, err = GetEnergyConsumptions(q, EnergyPeriodMonth)
+	assert.NoError(t, err)
+	assert.Len(t, consumptions, 0)
+}
+
+func TestAddEnergyReadingInstances(t *testing.T) {
+	area := Area{Name: "test_device_energy_instances"}
+	assert.NoError(t, GetDB().Create(&area).Error)
+	device := Device{Name: "power strip", Identity: "energy_power_strip", AreaID: area.ID}
+	assert.NoError(t, GetDB().Create(&device).Error)
+
+	// 多个电量计量实例的读数交替上报，分别计算差值
+	day := time.Date(2021, 10, 1, 10, 0, 0, 0, time.Local)
+	assert.NoError(t, AddEnergyReading(device, 1, 100, day))
+	assert.NoError(t, AddEnergyReading(device, 2, 10, day))
+	assert.NoError(t, AddEnergyReading(device, 1, 101, day))
+	assert.NoError(t, AddEnergyReading(device, 2, 10.5, day))
+	// 读数误差不视为重置
+	assert.NoError(t, AddEnergyReading(device, 1, 100.995, day))
+	assert.NoError(t, AddEnergyReading(device, 1, 102, day))
+
+	q := EnergyQuery{AreaID: area.ID, StartDate: day, EndDate: day}
+	consumptions, err := GetEnergyConsumptions(q, EnergyPeriodDay)
+	assert.NoError(t, err)
+	assert.Equal(t, []EnergyConsumption{{Date: "2021-10-01", Consumption: 2.5}}, consumptions)
+}
@@ -0,0 +1,188 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	// deviceStateLogCreateBatch 每次批量插入的状态历史记录数
+	deviceStateLogCreateBatch = 100
+	// deviceStateLogCleanBatch 每次清理的状态历史记录数
+	deviceStateLogCleanBatch = 5000
+)
+
+// DeviceStateLog 设备上报的属性状态历史
+type DeviceStateLog struct {
+	ID         int64
+	DeviceID   int      `gorm:"index:idx_device_state_logs_series,priority:1"`
+	InstanceID int      `gorm:"index:idx_device_state_logs_series,priority:2"`
+	Attribute  string   `gorm:"index:idx_device_state_logs_series,priority:3"`
+	Val        string   // 上报的值（JSON 格式）
+	NumVal     *float64 // 数值（布尔值为0或1），非数值类型为空，用于降采样
+	ReportedAt int64    `gorm:"index:idx_device_state_logs_series,priority:4;index"` // 上报时间戳
+
+	AreaID uint64 `gorm:"type:bigint;index"`
+	Area   Area   `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+func (l DeviceStateLog) TableName() string {
+	return "device_state_logs"
+}
+
+// NewDeviceStateLog 生成设备 d 在 at 时上报的属性状态的历史记录
+func NewDeviceStateLog(d Device, attr Attribute, at time.Time) (log DeviceStateLog, err error) {
+	val, err := json.Marshal(attr.Val)
+	if err != nil {
+		return
+	}
+	log = DeviceStateLog{
+		DeviceID:   d.ID,
+		InstanceID: attr.InstanceID,
+		Attribute:  attr.Attribute.Attribute,
+		Val:        string(val),
+		ReportedAt: at.Unix(),
+		AreaID:     d.AreaID,
+	}
+	if v, ok := numericVal(attr.Val); ok {
+		log.NumVal = &v
+	}
+	return
+}
+
+// numericVal 将数值及布尔类型的值转换为 float64
+func numericVal(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// CreateDeviceStateLogs 批量保存状态历史
+func CreateDeviceStateLogs(logs []DeviceStateLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return GetDB().CreateInBatches(logs, deviceStateLogCreateBatch).Error
+}
+
+// DeviceStateQuery 设备某个属性的状态历史的查询条件，时间范围不包含 EndTime
+type DeviceStateQuery struct {
+	DeviceID   int
+	InstanceID int
+	Attribute  string
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+func (q DeviceStateQuery) query() *gorm.DB {
+	return GetDB().Model(&DeviceStateLog{}).
+		Where("device_id=? and instance_id=? and attribute=?", q.DeviceID, q.InstanceID, q.Attribute).
+		Where("reported_at>=? and reported_at<?", q.StartTime.Unix(), q.EndTime.Unix())
+}
+
+// GetDeviceStateLogs 按上报时间顺序获取状态历史，最多返回 limit 条
+func GetDeviceStateLogs(q DeviceStateQuery, limit int) (logs []DeviceStateLog, err error) {
+	if err = q.query().Order("reported_at asc, id asc").Limit(limit).Find(&logs).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+	}
+	return
+}
+
+// DeviceStateBucket 降采样后一个时间段内数值状态的统计
+type DeviceStateBucket struct {
+	Time  int64   `json:"time" gorm:"column:bucket"` // 时间段的开始时间戳
+	Min   float64 `json:"min" gorm:"column:min_val"`
+	Max   float64 `json:"max" gorm:"column:max_val"`
+	Avg   float64 `json:"avg" gorm:"column:avg_val"`
+	Count int     `json:"count" gorm:"column:val_count"` // 时间段内的记录数
+}
+
+// GetDeviceStateBuckets 按 interval 秒将数值状态历史分段，返回每段的最小值、最大值及平均值，没有记录的时间段不返回
+func GetDeviceStateBuckets(q DeviceStateQuery, interval int64) (buckets []DeviceStateBucket, err error) {
+	if err = q.query().Where("num_val is not null").
+		Select("reported_at - reported_at % ? as bucket, min(num_val) as min_val, max(num_val) as max_val, "+
+			"avg(num_val) as avg_val, count(*) as val_count", interval).
+		Group("bucket").Order("bucket asc").Scan(&buckets).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+	}
+	return
+}
+
+// CleanDeviceStateLogs 清理上报时间早于 before 的状态历史，以及超出 maxCount 条的较早的记录；
+// before 为零值时不按时间清理，maxCount 为0时不按数量清理
+func CleanDeviceStateLogs(before time.Time, maxCount int) (count int64, err error) {
+	if !before.IsZero() {
+		var n int64
+		n, err = cleanDeviceStateLogs("reported_at < ?", before.Unix())
+		if count += n; err != nil {
+			return
+		}
+	}
+	if maxCount <= 0 {
+		return
+	}
+
+	// 保留 id 最大的 maxCount 条
+	var ids []int64
+	if err = GetDB().Model(&DeviceStateLog{}).Order("id desc").
+		Offset(maxCount).Limit(1).Pluck("id", &ids).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+	n, err := cleanDeviceStateLogs("id <= ?", ids[0])
+	count += n
+	return
+}
+
+// cleanDeviceStateLogs 分批删除满足条件的状态历史，避免长时间锁表
+func cleanDeviceStateLogs(query string, args ...interface{}) (count int64, err error) {
+	for {
+		var ids []int64
+		if err = GetDB().Model(&DeviceStateLog{}).Where(query, args...).
+			Limit(deviceStateLogCleanBatch).Pluck("id", &ids).Error; err != nil {
+			err = errors.Wrap(err, errors.InternalServerErr)
+			return
+		}
+		if len(ids) == 0 {
+			return
+		}
+		result := GetDB().Where("id in (?)", ids).Delete(&DeviceStateLog{})
+		if result.Error != nil {
+			err = errors.Wrap(result.Error, errors.InternalServerErr)
+			return
+		}
+		if count += result.RowsAffected; result.RowsAffected == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+)
+
+func TestDeviceStateLogs(t *testing.T) {
+	area := Area{Name: "test_device_state_logs"}
+	assert.NoError(t, GetDB().Create(&area).Error)
+	device := Device{ID: 1000 + int(area.ID%1000), AreaID: area.ID}
+	start := time.Unix(time.Now().Unix()/60*60, 0).Add(-time.Hour)
+
+	var logs []DeviceStateLog
+	for i, val := range []interface{}{10, 20.5, true, "on", 30} {
+		attr := Attribute{Attribute: server.Attribute{Attribute: "brightness", Val: val}, InstanceID: 1}
+		l, err := NewDeviceStateLog(device, attr, start.Add(time.Duration(i)*20*time.Second))
+		assert.NoError(t, err)
+		logs = append(logs, l)
+	}
+	assert.Nil(t, logs[3].NumVal)
+	assert.NoError(t, CreateDeviceStateLogs(logs))
+
+	q := DeviceStateQuery{DeviceID: device.ID, InstanceID: 1, Attribute: "brightness",
+		StartTime: start, EndTime: start.Add(time.Hour)}
+	result, err := GetDeviceStateLogs(q, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, result, 5) {
+		assert.Equal(t, `"on"`, result[3].Val)
+	}
+
+	// 按分钟降采样，字符串值不参与统计
+	buckets, err := GetDeviceStateBuckets(q, 60)
+	assert.NoError(t, err)
+	if assert.Len(t, buckets, 2) {
+		assert.Equal(t, start.Unix(), buckets[0].Time)
+		assert.Equal(t, 1.0, buckets[0].Min)
+		assert.Equal(t, 20.5, buckets[0].Max)
+		assert.Equal(t, 3, buckets[0].Count)
+		assert.Equal(t, 30.0, buckets[1].Avg)
+	}
+
+	_, err = CleanDeviceStateLogs(start.Add(30*time.Second), 0)
+	assert.NoError(t, err)
+	result, err = GetDeviceStateLogs(q, 10)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+}
@@ -25,6 +25,7 @@ var Tables []interface{} = []interface{}{
 	Device{}, Location{}, Area{}, Role{}, RolePermission{},
 	User{}, UserRole{}, Scene{}, SceneCondition{},
 	SceneTask{}, TaskLog{}, GlobalSetting{}, PluginInfo{}, Client{},
+	QueuedTask{}, SceneRevision{}, DeviceStateLog{}, DeviceEnergy{},
 }
 
 func GetDB() *gorm.DB {
@@ -76,6 +77,9 @@ func loadDB() {
 	if err = db.AutoMigrate(Tables...); err != nil {
 		logger1.Panicf("migrate err:%s", err.Error())
 	}
+	if err = dropLegacyEnergyIndex(db); err != nil {
+		logger1.Panicf("migrate err:%s", err.Error())
+	}
 }
 
 func OpenSqlite(path string, enableForeign bool) (*gorm.DB, error) {
@@ -106,6 +110,9 @@ func OpenSqlite(path string, enableForeign bool) (*gorm.DB, error) {
 	if err = sess.AutoMigrate(Tables...); err != nil {
 		return nil, err
 	}
+	if err = dropLegacyEnergyIndex(sess); err != nil {
+		return nil, err
+	}
 
 	return sess, nil
 }
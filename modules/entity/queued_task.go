@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// QueuedTask 队列中等待执行的延时任务，服务重启后从数据库恢复
+type QueuedTask struct {
+	ID           int
+	TaskID       string    `gorm:"unique"` // 任务ID
+	ParentTaskID *string   // 父任务id
+	SceneID      int       `gorm:"index"` // 所属场景
+	SceneTaskID  int       // 执行的场景任务
+	ExecuteAt    time.Time // 计划执行的时间
+	CreatedAt    time.Time
+}
+
+func (qt QueuedTask) TableName() string {
+	return "queued_tasks"
+}
+
+// CreateQueuedTask 保存等待执行的任务
+func CreateQueuedTask(qt *QueuedTask) (err error) {
+	if err = GetDB().Create(qt).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	return
+}
+
+// DeleteQueuedTask 任务执行或取消后删除
+func DeleteQueuedTask(taskID string) (err error) {
+	if err = GetDB().Where("task_id=?", taskID).Delete(&QueuedTask{}).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	return
+}
+
+// GetQueuedTasks 获取所有等待执行的任务
+func GetQueuedTasks() (tasks []QueuedTask, err error) {
+	if err = GetDB().Order("execute_at asc").Find(&tasks).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	return
+}
+
+// GetSceneTaskByID 获取场景任务
+func GetSceneTaskByID(id int) (sceneTask SceneTask, err error) {
+	err = GetDB().First(&sceneTask, id).Error
+	return
+}
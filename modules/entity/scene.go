@@ -9,6 +9,7 @@ import (
 
 	"github.com/zhiting-tech/smartassistant/modules/types/status"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 
 	"github.com/zhiting-tech/smartassistant/pkg/errors"
@@ -34,12 +35,28 @@ const (
 	MatchAnyCondition = 2 // 任一满足
 )
 
+// SceneMode 场景正在执行时再次触发的处理方式
+type SceneMode string
+
+const (
+	SceneModeParallel SceneMode = "parallel" // 同时执行，最多 MaxRuns 个（默认）
+	SceneModeSingle   SceneMode = "single"   // 忽略新的触发
+	SceneModeRestart  SceneMode = "restart"  // 取消正在进行的执行，重新执行
+	SceneModeQueued   SceneMode = "queued"   // 排队依次执行，最多排队 MaxRuns 个
+)
+
+// defaultMaxRuns 默认的最大同时执行数或排队数
+const defaultMaxRuns = 10
+
 // Scene 场景
 type Scene struct {
 	ID             int    `json:"id"`
 	Name           string `json:"name"`
 	ConditionLogic int    `json:"condition_logic"` // 1 为 全部满足，2为满足任一
 
+	// 嵌套的条件组，设置后按条件组判断是否满足，不再使用 ConditionLogic
+	ConditionTree datatypes.JSON `json:"condition_tree"` // refer to ConditionGroup
+
 	// 生效时间的配置
 	TimePeriodType TimePeriodType `json:"time_period"` // 全天1、时间段2
 	EffectStart    time.Time      `json:"-"`
@@ -54,6 +71,14 @@ type Scene struct {
 	// 场景会自动执行: true
 	IsOn bool `json:"is_on"`
 
+	// 执行模式的配置
+	Mode    SceneMode `json:"mode"`     // 为空时为 parallel
+	MaxRuns int       `json:"max_runs"` // parallel 最大同时执行数，queued 最大排队数，为0时使用默认值
+
+	Revision int `json:"revision"` // 当前配置的版本号，refer to SceneRevision
+
+	WebhookToken string `json:"-" gorm:"index"` // webhook 触发地址的密钥，首次获取地址时生成
+
 	CreatorID       int              `json:"creator_id"`
 	CreatedAt       time.Time        `json:"-"`
 	SceneConditions []SceneCondition `json:"-" gorm:"constraint:OnDelete:CASCADE;"`
@@ -183,6 +208,35 @@ func CheckSceneExitById(sceneId int) (err error) {
 	return
 }
 
+// GetMode 获取场景的执行模式
+func (s Scene) GetMode() SceneMode {
+	if s.Mode == "" {
+		return SceneModeParallel
+	}
+	return s.Mode
+}
+
+// GetMaxRuns 获取最大同时执行数或排队数
+func (s Scene) GetMaxRuns() int {
+	if s.MaxRuns <= 0 {
+		return defaultMaxRuns
+	}
+	return s.MaxRuns
+}
+
+// CheckMode 校验执行模式
+func (s Scene) CheckMode() (err error) {
+	switch s.GetMode() {
+	case SceneModeParallel, SceneModeSingle, SceneModeRestart, SceneModeQueued:
+	default:
+		return errors.Newf(status.SceneParamIncorrectErr, "执行模式")
+	}
+	if s.MaxRuns < 0 {
+		return errors.Newf(status.SceneParamIncorrectErr, "最大执行数")
+	}
+	return
+}
+
 // CheckConditionLogic 校验满足条件
 func (s Scene) CheckConditionLogic() bool {
 	return !s.IsMatchAllCondition() && s.ConditionLogic != MatchAnyCondition
@@ -236,6 +290,19 @@ func SwitchAutoSceneByID(sceneID int, isExecute bool) error {
 	return SwitchAutoScene(&s, isExecute)
 }
 
+// GetCronScenes 获取已开启且有 cron 触发条件的自动场景
+func GetCronScenes() (scenes []Scene, err error) {
+	sceneIDs := GetDB().Model(&SceneCondition{}).Select("scene_id").
+		Where("condition_type=?", ConditionTypeCron)
+	if err = GetDB().Where("auto_run=? and is_on=? and id in (?)", true, true, sceneIDs).
+		Preload("SceneConditions").
+		Find(&scenes).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	return
+}
+
 // GetPendingScenesByTime 根据时间获取待执行的场景
 func GetPendingScenesByTime(t time.Time) (scenes []Scene, err error) {
 	weekDay := strconv.Itoa(int(t.Weekday()))
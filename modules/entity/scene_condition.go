@@ -5,8 +5,10 @@ import (
 	"time"
 
 	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/cron"
 	"github.com/zhiting-tech/smartassistant/pkg/errors"
 	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+	"github.com/zhiting-tech/smartassistant/pkg/solar"
 	"gorm.io/datatypes"
 )
 
@@ -15,33 +17,124 @@ type ConditionType int
 const (
 	ConditionTypeTiming ConditionType = iota + 1
 	ConditionTypeDeviceStatus
+	ConditionTypeSolar
+	ConditionTypeCron
+	ConditionTypeWebhook
+)
+
+// SolarEventType 太阳事件类型
+type SolarEventType string
+
+const (
+	SolarEventSunrise SolarEventType = "sunrise" // 日出
+	SolarEventSunset  SolarEventType = "sunset"  // 日落
+	SolarEventDawn    SolarEventType = "dawn"    // 民用晨光始
+	SolarEventDusk    SolarEventType = "dusk"    // 民用昏影终
+)
+
+const (
+	// solarOffsetLimit 太阳事件偏移的最大秒数
+	solarOffsetLimit = 4 * 60 * 60
+	// durationLimit 设备状态持续的最大秒数
+	durationLimit = 24 * 60 * 60
 )
 
 type OperatorType string
 
 const (
-	OperatorGT OperatorType = ">"
-	OperatorLT OperatorType = "<"
-	OperatorEQ OperatorType = "="
+	OperatorGT          OperatorType = ">"
+	OperatorLT          OperatorType = "<"
+	OperatorEQ          OperatorType = "="
+	OperatorNE          OperatorType = "!="
+	OperatorBetween     OperatorType = "between"      // 在 [最小值, 最大值] 范围内
+	OperatorIn          OperatorType = "in"           // 在枚举的值中
+	OperatorChangedTo   OperatorType = "changed_to"   // 由其他值变为该值
+	OperatorChangedFrom OperatorType = "changed_from" // 由该值变为其他值
 )
 
+// IsEdgeTriggered 是否为仅在属性变化时满足的操作符
+func (o OperatorType) IsEdgeTriggered() bool {
+	return o == OperatorChangedTo || o == OperatorChangedFrom
+}
+
 // SceneCondition 场景条件
 type SceneCondition struct {
 	ID            int           `json:"id"`
 	SceneID       int           `json:"scene_id"`
 	ConditionType ConditionType `json:"condition_type"`
-	TimingAt      time.Time     `json:"-"` // 定时在某个时间
+	Key           string        `json:"key"` // 场景内唯一，供条件组引用
+	TimingAt      time.Time     `json:"-"`   // 定时在某个时间
+
+	// 日出日落有关配置
+	SolarEvent  SolarEventType `json:"solar_event"`  // 太阳事件
+	SolarOffset int            `json:"solar_offset"` // 相对太阳事件偏移的秒数，负数为提前
+
+	CronExpr string `json:"cron_expr"` // cron 表达式（分 时 日 月 周）
 
 	// 设备有关配置
 	DeviceID      int            `json:"device_id"`      // 或某个设备状态变化时
-	Operator      OperatorType   `json:"operator"`       // 操作符，大于、小于、等于
+	Operator      OperatorType   `json:"operator"`       // 操作符，大于、小于、等于、范围、变化等
 	ConditionAttr datatypes.JSON `json:"condition_attr"` // refer to Attribute
+	Duration      int            `json:"duration"`       // 状态持续的秒数，为0时状态变化立即触发
 }
 
 func (d SceneCondition) TableName() string {
 	return "scene_conditions"
 }
 
+// IsTimeCondition 是否为按时间触发的条件（定时、日出日落、cron）
+func (d SceneCondition) IsTimeCondition() bool {
+	switch d.ConditionType {
+	case ConditionTypeTiming, ConditionTypeSolar, ConditionTypeCron:
+		return true
+	}
+	return false
+}
+
+// IsEventCondition 是否为仅在其触发时满足的条件（按时间触发的条件、webhook）
+func (d SceneCondition) IsEventCondition() bool {
+	return d.IsTimeCondition() || d.ConditionType == ConditionTypeWebhook
+}
+
+// IsAttrCondition 是否为设备属性 attr 的状态条件
+func (d SceneCondition) IsAttrCondition(deviceID int, attr Attribute) bool {
+	if d.ConditionType != ConditionTypeDeviceStatus || d.DeviceID != deviceID {
+		return false
+	}
+	var item Attribute
+	if err := json.Unmarshal(d.ConditionAttr, &item); err != nil {
+		return false
+	}
+	return item.InstanceID == attr.InstanceID && item.Attribute.Attribute == attr.Attribute.Attribute
+}
+
+// SolarTime 获取日出日落条件在 day 当天的触发时间
+func (d SceneCondition) SolarTime(day time.Time, area Area) (t time.Time, err error) {
+	if !area.HasCoordinate() {
+		err = errors.Newf(status.SceneParamIncorrectErr, "家庭经纬度")
+		return
+	}
+	lat, lng := area.Latitude, area.Longitude
+	switch d.SolarEvent {
+	case SolarEventSunrise:
+		t, err = solar.Rise(day, lat, lng, solar.ZenithOfficial)
+	case SolarEventSunset:
+		t, err = solar.Set(day, lat, lng, solar.ZenithOfficial)
+	case SolarEventDawn:
+		t, err = solar.Rise(day, lat, lng, solar.ZenithCivil)
+	case SolarEventDusk:
+		t, err = solar.Set(day, lat, lng, solar.ZenithCivil)
+	default:
+		err = errors.Newf(status.SceneParamIncorrectErr, "太阳事件")
+		return
+	}
+	if err != nil {
+		return
+	}
+	t = t.Add(time.Duration(d.SolarOffset) * time.Second)
+	return
+}
+
 func GetConditionsBySceneID(sceneID int) (conditions []SceneCondition, err error) {
 	err = GetDB().Where("scene_id = ?", sceneID).Find(&conditions).Error
 	if err != nil {
@@ -62,11 +155,32 @@ func (c ConditionInfo) CheckCondition(userId int) (err error) {
 		return
 	}
 
+	// 仅设备状态条件可以设置持续时间
+	if c.ConditionType != ConditionTypeDeviceStatus && c.Duration != 0 {
+		err = errors.New(status.ConditionMisMatchTypeAndConfigErr)
+		return
+	}
+
 	// 定时类型
 	if c.ConditionType == ConditionTypeTiming {
 		if err = c.checkConditionTypeTiming(); err != nil {
 			return
 		}
+	} else if c.ConditionType == ConditionTypeSolar {
+		// 日出日落类型
+		if err = c.checkConditionTypeSolar(); err != nil {
+			return
+		}
+	} else if c.ConditionType == ConditionTypeCron {
+		// cron 类型
+		if err = c.checkConditionTypeCron(); err != nil {
+			return
+		}
+	} else if c.ConditionType == ConditionTypeWebhook {
+		// webhook 类型
+		if err = c.checkConditionTypeWebhook(); err != nil {
+			return
+		}
 	} else {
 		// 设备状态变化时
 		if err = c.checkConditionDevice(userId); err != nil {
@@ -78,7 +192,7 @@ func (c ConditionInfo) CheckCondition(userId int) (err error) {
 
 // checkConditionType 校验触发条件类型
 func (c ConditionInfo) checkConditionType() (err error) {
-	if c.ConditionType < ConditionTypeTiming || c.ConditionType > ConditionTypeDeviceStatus {
+	if c.ConditionType < ConditionTypeTiming || c.ConditionType > ConditionTypeWebhook {
 		err = errors.Newf(status.SceneParamIncorrectErr, "触发条件类型")
 		return
 	}
@@ -94,12 +208,87 @@ func (c ConditionInfo) checkConditionTypeTiming() (err error) {
 	return
 }
 
+// checkConditionTypeSolar 校验日出日落类型
+func (c ConditionInfo) checkConditionTypeSolar() (err error) {
+	if c.Timing != 0 || c.DeviceID != 0 {
+		err = errors.New(status.ConditionMisMatchTypeAndConfigErr)
+		return
+	}
+	switch c.SolarEvent {
+	case SolarEventSunrise, SolarEventSunset, SolarEventDawn, SolarEventDusk:
+	default:
+		err = errors.Newf(status.SceneParamIncorrectErr, "太阳事件")
+		return
+	}
+	if c.SolarOffset < -solarOffsetLimit || c.SolarOffset > solarOffsetLimit {
+		err = errors.Newf(status.SceneParamIncorrectErr, "太阳事件偏移时间")
+		return
+	}
+	return
+}
+
+// checkConditionTypeCron 校验 cron 类型
+func (c ConditionInfo) checkConditionTypeCron() (err error) {
+	if c.Timing != 0 || c.DeviceID != 0 {
+		err = errors.New(status.ConditionMisMatchTypeAndConfigErr)
+		return
+	}
+	if _, e := cron.Parse(c.CronExpr); e != nil {
+		err = errors.Wrapf(e, status.SceneParamIncorrectErr, "cron 表达式")
+		return
+	}
+	return
+}
+
+// checkConditionTypeWebhook 校验 webhook 类型，condition_attr 可选，
+// 设置时按 attribute 指定的请求内容字段过滤请求
+func (c ConditionInfo) checkConditionTypeWebhook() (err error) {
+	if c.Timing != 0 || c.DeviceID != 0 {
+		err = errors.New(status.ConditionMisMatchTypeAndConfigErr)
+		return
+	}
+	filter, ok, err := c.WebhookFilter()
+	if err != nil || !ok {
+		return
+	}
+	if filter.Attribute.Attribute == "" {
+		return errors.Newf(status.SceneParamIncorrectErr, "webhook 参数")
+	}
+	if c.Operator == "" || c.Operator.IsEdgeTriggered() {
+		return errors.Newf(status.SceneParamIncorrectErr, "操作符")
+	}
+	if err = c.checkOperatorType(); err != nil {
+		return
+	}
+	return c.checkOperatorVal(filter.Val)
+}
+
+// WebhookFilter 获取 webhook 条件对请求内容的过滤配置，attribute 为请求内容的字段，
+// 多级字段以 . 分隔，未设置时 ok 为 false，任意请求都满足条件
+func (d SceneCondition) WebhookFilter() (filter Attribute, ok bool, err error) {
+	if len(d.ConditionAttr) == 0 || string(d.ConditionAttr) == "null" {
+		return
+	}
+	if err = json.Unmarshal(d.ConditionAttr, &filter); err != nil {
+		err = errors.Wrapf(err, status.SceneParamIncorrectErr, "webhook 参数")
+		return
+	}
+	ok = true
+	return
+}
+
 // checkConditionDevice 校验设备类型
 func (c ConditionInfo) checkConditionDevice(userId int) (err error) {
 	if c.DeviceID <= 0 || c.Timing != 0 {
 		err = errors.New(status.ConditionMisMatchTypeAndConfigErr)
 		return
 	}
+	// 属性变化类的条件没有持续状态
+	if c.Duration < 0 || c.Duration > durationLimit ||
+		(c.Duration > 0 && c.Operator.IsEdgeTriggered()) {
+		err = errors.Newf(status.SceneParamIncorrectErr, "状态持续时间")
+		return
+	}
 
 	if err = c.CheckConditionItem(userId, c.DeviceID); err != nil {
 		return
@@ -117,9 +306,12 @@ func (d SceneCondition) CheckConditionItem(userId, deviceId int) (err error) {
 		err = errors.Wrap(err, errors.InternalServerErr)
 		return
 	}
+	if err = d.checkOperatorVal(item.Val); err != nil {
+		return
+	}
 
-	// 设备控制权限的判断
-	if !IsDeviceControlPermit(userId, deviceId, item) {
+	// 设备控制权限的判断，只读属性不需要控制权限
+	if !IsReadOnlyAttr(deviceId, item) && !IsDeviceControlPermit(userId, deviceId, item) {
 		err = errors.New(status.DeviceOrSceneControlDeny)
 		return
 	}
@@ -130,9 +322,14 @@ func (d SceneCondition) CheckConditionItem(userId, deviceId int) (err error) {
 // checkOperatorType() 校验操作类型
 func (d SceneCondition) checkOperatorType() (err error) {
 	var opMap = map[OperatorType]bool{
-		OperatorGT: true,
-		OperatorLT: true,
-		OperatorEQ: true,
+		OperatorGT:          true,
+		OperatorLT:          true,
+		OperatorEQ:          true,
+		OperatorNE:          true,
+		OperatorBetween:     true,
+		OperatorIn:          true,
+		OperatorChangedTo:   true,
+		OperatorChangedFrom: true,
 	}
 
 	if d.Operator != "" {
@@ -144,6 +341,46 @@ func (d SceneCondition) checkOperatorType() (err error) {
 	return
 }
 
+// checkOperatorVal 校验操作符对应的属性值，范围为 [最小值, 最大值]，枚举为非空的标量数组，比较相等时为标量
+func (d SceneCondition) checkOperatorVal(val interface{}) (err error) {
+	switch d.Operator {
+	case OperatorEQ, OperatorNE, OperatorChangedTo, OperatorChangedFrom:
+		if !IsScalarVal(val) {
+			return errors.Newf(status.SceneParamIncorrectErr, "属性值")
+		}
+	case OperatorBetween:
+		vals, ok := val.([]interface{})
+		if !ok || len(vals) != 2 {
+			return errors.Newf(status.SceneParamIncorrectErr, "属性值范围")
+		}
+		min, ok1 := vals[0].(float64)
+		max, ok2 := vals[1].(float64)
+		if !ok1 || !ok2 || min > max {
+			return errors.Newf(status.SceneParamIncorrectErr, "属性值范围")
+		}
+	case OperatorIn:
+		vals, ok := val.([]interface{})
+		if !ok || len(vals) == 0 {
+			return errors.Newf(status.SceneParamIncorrectErr, "属性值")
+		}
+		for _, v := range vals {
+			if !IsScalarVal(v) {
+				return errors.Newf(status.SceneParamIncorrectErr, "属性值")
+			}
+		}
+	}
+	return
+}
+
+// IsScalarVal 属性值是否为可直接比较的标量，对象和数组比较时会 panic
+func IsScalarVal(val interface{}) bool {
+	switch val.(type) {
+	case nil, bool, string, float64, float32, int, int64, int32, uint, uint64, uint32:
+		return true
+	}
+	return false
+}
+
 // GetScenesByCondition 根据条件获取场景
 func GetScenesByCondition(deviceID int, attr Attribute) (scenes []Scene, err error) {
 	conds, err := GetConditions(deviceID, attr)
@@ -0,0 +1,113 @@
+package entity
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// conditionGroupMaxDepth 条件组最大嵌套层数
+const conditionGroupMaxDepth = 4
+
+// ConditionGroup 场景条件组，可嵌套组成条件树
+// 组节点设置 Logic 和 Children，叶子节点通过 Condition 引用场景条件的 Key
+type ConditionGroup struct {
+	Logic     int              `json:"logic,omitempty" yaml:"logic,omitempty"`         // 1 为 全部满足，2为满足任一
+	Children  []ConditionGroup `json:"children,omitempty" yaml:"children,omitempty"`   // 子条件或子条件组
+	Condition string           `json:"condition,omitempty" yaml:"condition,omitempty"` // 引用的场景条件的 key
+}
+
+// IsLeaf 是否为引用单个条件的叶子节点
+func (g ConditionGroup) IsLeaf() bool {
+	return g.Condition != ""
+}
+
+// IsMatchAll 组内条件是否需要全部满足
+func (g ConditionGroup) IsMatchAll() bool {
+	return g.Logic == MatchAllCondition
+}
+
+// GetConditionTree 获取场景的条件树，未设置时 ok 为 false
+func (s Scene) GetConditionTree() (tree ConditionGroup, ok bool, err error) {
+	if len(s.ConditionTree) == 0 || bytes.Equal(s.ConditionTree, []byte("null")) {
+		return
+	}
+	if err = json.Unmarshal(s.ConditionTree, &tree); err != nil {
+		err = errors.Newf(status.SceneParamIncorrectErr, "条件组")
+		return
+	}
+	return tree, true, nil
+}
+
+// CheckConditionTree 校验条件树，conditions 为场景保存后的全部触发条件
+func (s Scene) CheckConditionTree(conditions []SceneCondition) (err error) {
+	tree, ok, err := s.GetConditionTree()
+	if err != nil || !ok {
+		return
+	}
+	if tree.IsLeaf() {
+		return errors.Newf(status.SceneParamIncorrectErr, "条件组")
+	}
+
+	keys := make(map[string]SceneCondition)
+	for _, c := range conditions {
+		if c.Key == "" {
+			return errors.Newf(status.SceneParamIncorrectErr, "触发条件 key")
+		}
+		if _, exist := keys[c.Key]; exist {
+			return errors.Newf(status.SceneParamIncorrectErr, "触发条件 key")
+		}
+		keys[c.Key] = c
+	}
+
+	used := make(map[string]bool)
+	if _, err = tree.check(keys, used, 1); err != nil {
+		return
+	}
+	// 所有条件都需要在条件树中
+	if len(used) != len(keys) {
+		return errors.Newf(status.SceneParamIncorrectErr, "条件组")
+	}
+	return
+}
+
+// check 递归校验条件组，返回满足该节点最少需要的定时或 webhook 条件个数
+// 定时条件和 webhook 条件只在其触发时满足，所以同一个“全部满足”组内最多只能要求一个这类条件
+func (g ConditionGroup) check(keys map[string]SceneCondition, used map[string]bool, depth int) (timeCount int, err error) {
+	if g.IsLeaf() {
+		c, ok := keys[g.Condition]
+		if !ok || used[g.Condition] || g.Logic != 0 || len(g.Children) != 0 {
+			return 0, errors.Newf(status.SceneParamIncorrectErr, "条件组")
+		}
+		used[g.Condition] = true
+		if c.IsEventCondition() {
+			timeCount = 1
+		}
+		return
+	}
+
+	if depth > conditionGroupMaxDepth || len(g.Children) == 0 {
+		return 0, errors.Newf(status.SceneParamIncorrectErr, "条件组")
+	}
+	if g.Logic != MatchAllCondition && g.Logic != MatchAnyCondition {
+		return 0, errors.Newf(status.SceneParamIncorrectErr, "满足条件类型")
+	}
+
+	for i, child := range g.Children {
+		var count int
+		if count, err = child.check(keys, used, depth+1); err != nil {
+			return
+		}
+		if g.IsMatchAll() {
+			timeCount += count
+		} else if i == 0 || count < timeCount {
+			timeCount = count
+		}
+	}
+	if timeCount > 1 {
+		return 0, errors.New(status.ConditionTimingCountErr)
+	}
+	return
+}
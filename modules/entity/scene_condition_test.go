@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckOperatorVal(t *testing.T) {
+	c := SceneCondition{Operator: OperatorEQ}
+	assert.Nil(t, c.checkOperatorVal("on"))
+	assert.Nil(t, c.checkOperatorVal(float64(1)))
+	// 比较相等时只允许标量
+	assert.NotNil(t, c.checkOperatorVal(map[string]interface{}{"type": "ring"}))
+	assert.NotNil(t, c.checkOperatorVal([]interface{}{"ring"}))
+	c.Operator = OperatorNE
+	assert.NotNil(t, c.checkOperatorVal([]interface{}{"ring"}))
+
+	c.Operator = OperatorIn
+	assert.Nil(t, c.checkOperatorVal([]interface{}{"cool", "heat"}))
+	assert.NotNil(t, c.checkOperatorVal([]interface{}{"cool", map[string]interface{}{}}))
+	assert.NotNil(t, c.checkOperatorVal([]interface{}{}))
+}
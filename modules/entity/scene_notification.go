@@ -0,0 +1,117 @@
+package entity
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"text/template"
+
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+const (
+	notificationRetriesLimit = 5    // webhook 最多重试的次数
+	messageSizeLimit         = 1000 // 消息模板的最大长度
+)
+
+// Notification 通知任务的配置
+type Notification struct {
+	// Message 消息模板，使用 text/template 语法，可引用的数据参考 NotificationData，如：
+	// {{.Device}} 的 {{.Attribute}} 变为 {{.Val}}
+	Message string `json:"message" yaml:"message"`
+
+	// webhook 有关配置
+	URL     string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Secret  string            `json:"secret,omitempty" yaml:"secret,omitempty"` // 签名密钥，为空时不签名
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Retries int               `json:"retries,omitempty" yaml:"retries,omitempty"` // 发送失败后重试的次数
+
+	// 提醒有关配置
+	UserIDs []int `json:"user_ids,omitempty" yaml:"user_ids,omitempty"` // 接收提醒的用户，为空时推送给家庭所有用户
+}
+
+// NotificationData 通知的消息模板可引用的数据
+type NotificationData struct {
+	SceneID int    `json:"scene_id"`
+	Scene   string `json:"scene"` // 场景名称
+
+	// 触发场景的设备状态，不是设备状态触发时为空
+	DeviceID   int         `json:"device_id,omitempty"`
+	Device     string      `json:"device,omitempty"` // 设备名称
+	InstanceID int         `json:"instance_id,omitempty"`
+	Attribute  string      `json:"attribute,omitempty"`
+	Val        interface{} `json:"val,omitempty"`
+
+	// webhook 触发场景时的请求内容，不是 webhook 触发时为空
+	Payload map[string]interface{} `json:"payload,omitempty"`
+
+	Time int64 `json:"time"` // 执行时间
+}
+
+// IsNotification 是否为通知任务
+func (task SceneTask) IsNotification() bool {
+	return task.Type == TaskTypeWebhook || task.Type == TaskTypeAlert
+}
+
+// GetNotification 获取通知任务的配置
+func (task SceneTask) GetNotification() (n Notification, err error) {
+	if len(task.Notification) == 0 {
+		err = errors.Newf(status.SceneParamIncorrectErr, "通知")
+		return
+	}
+	if err = json.Unmarshal(task.Notification, &n); err != nil {
+		err = errors.Wrapf(err, status.SceneParamIncorrectErr, "通知")
+	}
+	return
+}
+
+// CheckNotification 校验通知任务的配置，提醒的用户需要属于 areaID 家庭
+func (task SceneTask) CheckNotification(areaID uint64) (err error) {
+	if task.DeviceID != 0 || task.ControlSceneID != 0 {
+		return errors.New(status.TaskTypeErr)
+	}
+	n, err := task.GetNotification()
+	if err != nil {
+		return
+	}
+	if n.Message == "" || len(n.Message) > messageSizeLimit {
+		return errors.Newf(status.SceneParamIncorrectErr, "消息")
+	}
+	if _, e := template.New("message").Parse(n.Message); e != nil {
+		return errors.Wrapf(e, status.SceneParamIncorrectErr, "消息模板")
+	}
+
+	switch task.Type {
+	case TaskTypeWebhook:
+		u, e := url.Parse(n.URL)
+		if e != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Newf(status.SceneParamIncorrectErr, "webhook 地址")
+		}
+		if n.Retries < 0 || n.Retries > notificationRetriesLimit {
+			return errors.Newf(status.SceneParamIncorrectErr, "重试次数")
+		}
+	case TaskTypeAlert:
+		for _, userID := range n.UserIDs {
+			if _, err = GetUserByIDAndAreaID(userID, areaID); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Render 使用 data 生成消息
+func (n Notification) Render(data NotificationData) (message string, err error) {
+	t, err := template.New("message").Parse(n.Message)
+	if err != nil {
+		err = errors.Wrapf(err, status.SceneParamIncorrectErr, "消息模板")
+		return
+	}
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, data); err != nil {
+		err = errors.Wrapf(err, status.SceneParamIncorrectErr, "消息模板")
+		return
+	}
+	return buf.String(), nil
+}
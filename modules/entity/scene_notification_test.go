@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationRender(t *testing.T) {
+	n := Notification{Message: "{{.Scene}}: {{.Device}} 的 {{.Attribute}} 变为 {{.Val}}"}
+	message, err := n.Render(NotificationData{Scene: "离家", Device: "门窗传感器", Attribute: "contact", Val: "open"})
+	assert.Nil(t, err)
+	assert.Equal(t, "离家: 门窗传感器 的 contact 变为 open", message)
+
+	n.Message = "{{.Unknown}}"
+	_, err = n.Render(NotificationData{})
+	assert.NotNil(t, err)
+}
+
+func TestCheckNotification(t *testing.T) {
+	task := SceneTask{Type: TaskTypeWebhook, Notification: []byte(`{"message":"hi","url":"ftp://example.com"}`)}
+	assert.NotNil(t, task.CheckNotification(1))
+	task.Notification = []byte(`{"message":"hi","url":"https://example.com/hook","retries":3}`)
+	assert.Nil(t, task.CheckNotification(1))
+	task.Notification = []byte(`{"message":"{{.Scene","url":"https://example.com/hook"}`)
+	assert.NotNil(t, task.CheckNotification(1))
+}
@@ -0,0 +1,318 @@
+package entity
+
+import (
+	"encoding/json"
+	errors2 "errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// SceneRevision 场景的历史版本，每次创建、修改或回滚场景时保存，保存后不再修改
+type SceneRevision struct {
+	ID        int            `json:"-"`
+	SceneID   int            `json:"scene_id" gorm:"uniqueIndex:idx_scene_revisions_scene_revision"`
+	Revision  int            `json:"revision" gorm:"uniqueIndex:idx_scene_revisions_scene_revision"` // 场景内递增的版本号，从1开始
+	AuthorID  int            `json:"author_id"`                                                      // 修改场景的用户id
+	Snapshot  datatypes.JSON `json:"-"`                                                              // refer to SceneSnapshot
+	CreatedAt time.Time      `json:"-"`
+
+	AreaID uint64 `json:"-" gorm:"type:bigint;index"`
+	Area   Area   `json:"-" gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+func (r SceneRevision) TableName() string {
+	return "scene_revisions"
+}
+
+// SceneSnapshot 场景版本保存的场景配置
+type SceneSnapshot struct {
+	Name           string         `json:"name"`
+	ConditionLogic int            `json:"condition_logic"`
+	ConditionTree  datatypes.JSON `json:"condition_tree"`
+	TimePeriodType TimePeriodType `json:"time_period"`
+	EffectStart    int64          `json:"effect_start_time"`
+	EffectEnd      int64          `json:"effect_end_time"`
+	RepeatType     RepeatType     `json:"repeat_type"`
+	RepeatDate     string         `json:"repeat_date"`
+	AutoRun        bool           `json:"auto_run"`
+	Mode           SceneMode      `json:"mode"`
+	MaxRuns        int            `json:"max_runs"`
+
+	SceneConditions []ConditionInfo `json:"scene_conditions"`
+	SceneTasks      []SceneTask     `json:"scene_tasks"`
+}
+
+// SceneChange 两个场景版本之间的一项差异
+type SceneChange struct {
+	Field  string      `json:"field"`        // 场景配置项，触发条件为 scene_conditions，执行任务为 scene_tasks
+	ID     int         `json:"id,omitempty"` // 触发条件或执行任务的id
+	Action string      `json:"action"`       // added, removed, modified
+	From   interface{} `json:"from,omitempty"`
+	To     interface{} `json:"to,omitempty"`
+}
+
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// NewSceneSnapshot 获取场景当前配置的快照，scene 需要包含触发条件和执行任务
+func NewSceneSnapshot(scene Scene) SceneSnapshot {
+	snapshot := SceneSnapshot{
+		Name:            scene.Name,
+		ConditionLogic:  scene.ConditionLogic,
+		ConditionTree:   scene.ConditionTree,
+		TimePeriodType:  scene.TimePeriodType,
+		EffectStart:     scene.EffectStart.Unix(),
+		EffectEnd:       scene.EffectEnd.Unix(),
+		RepeatType:      scene.RepeatType,
+		RepeatDate:      scene.RepeatDate,
+		AutoRun:         scene.AutoRun,
+		Mode:            scene.Mode,
+		MaxRuns:         scene.MaxRuns,
+		SceneConditions: make([]ConditionInfo, 0),
+		SceneTasks:      make([]SceneTask, 0),
+	}
+	for _, c := range scene.SceneConditions {
+		snapshot.SceneConditions = append(snapshot.SceneConditions,
+			ConditionInfo{SceneCondition: c, Timing: c.TimingAt.Unix()})
+	}
+	snapshot.SceneTasks = append(snapshot.SceneTasks, scene.SceneTasks...)
+	return snapshot
+}
+
+// GetSnapshot 获取版本保存的场景配置
+func (r SceneRevision) GetSnapshot() (snapshot SceneSnapshot, err error) {
+	if err = json.Unmarshal(r.Snapshot, &snapshot); err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+	}
+	return
+}
+
+// SaveSceneRevision 保存场景当前配置为新版本，需要与修改场景在同一事务 tx 中执行
+func SaveSceneRevision(sceneID, authorID int, tx *gorm.DB) (revision SceneRevision, err error) {
+	// 先递增版本号（仅更新版本号，不触发场景的校验），并发保存时按递增后的版本号依次保存，不会重复
+	if err = tx.Model(&Scene{}).Where("id=?", sceneID).
+		UpdateColumn("revision", gorm.Expr("revision + 1")).Error; err != nil {
+		return
+	}
+	var scene Scene
+	if err = tx.Preload("SceneConditions").Preload("SceneTasks").
+		First(&scene, sceneID).Error; err != nil {
+		return
+	}
+	snapshot, err := json.Marshal(NewSceneSnapshot(scene))
+	if err != nil {
+		return
+	}
+	revision = SceneRevision{
+		SceneID:   sceneID,
+		Revision:  scene.Revision,
+		AuthorID:  authorID,
+		Snapshot:  snapshot,
+		CreatedAt: time.Now(),
+		AreaID:    scene.AreaID,
+	}
+	err = tx.Create(&revision).Error
+	return
+}
+
+// EnsureSceneRevision 没有版本的场景（如升级前创建的场景）保存当前配置为第一个版本，作者为场景创建者
+func EnsureSceneRevision(sceneID int, tx *gorm.DB) (err error) {
+	var scene Scene
+	if err = tx.First(&scene, sceneID).Error; err != nil {
+		return
+	}
+	if scene.Revision != 0 {
+		return
+	}
+	_, err = SaveSceneRevision(sceneID, scene.CreatorID, tx)
+	return
+}
+
+// GetSceneRevisions 获取场景的所有版本，新版本在前
+func GetSceneRevisions(sceneID int) (revisions []SceneRevision, err error) {
+	err = GetDB().Where("scene_id=?", sceneID).Order("revision desc").Find(&revisions).Error
+	if err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+	}
+	return
+}
+
+// GetSceneRevision 获取场景的某个版本
+func GetSceneRevision(sceneID, revision int) (r SceneRevision, err error) {
+	err = GetDB().Where("scene_id=? and revision=?", sceneID, revision).First(&r).Error
+	if err != nil {
+		if errors2.Is(err, gorm.ErrRecordNotFound) {
+			err = errors.Wrap(err, status.SceneRevisionNotExist)
+			return
+		}
+		err = errors.Wrap(err, errors.InternalServerErr)
+	}
+	return
+}
+
+// RollbackScene 将场景恢复为 revision 版本的配置，恢复后保存为新版本
+// 触发条件和执行任务按版本中的配置重新创建
+// check 在恢复前校验版本中的配置，如当前用户对设备和场景的控制权限，校验失败时不恢复
+func RollbackScene(sceneID, revision, authorID int, check func(snapshot SceneSnapshot) error) (r SceneRevision, err error) {
+	target, err := GetSceneRevision(sceneID, revision)
+	if err != nil {
+		return
+	}
+	snapshot, err := target.GetSnapshot()
+	if err != nil {
+		return
+	}
+	if err = IsSceneNameExist(snapshot.Name, sceneID); err != nil {
+		return
+	}
+
+	err = GetDB().Transaction(func(tx *gorm.DB) (err error) {
+		var scene Scene
+		if err = tx.First(&scene, sceneID).Error; err != nil {
+			return
+		}
+		if scene.AutoRun != snapshot.AutoRun {
+			return errors.New(status.SceneTypeForbidModify)
+		}
+		if err = check(snapshot); err != nil {
+			return
+		}
+		updates := map[string]interface{}{
+			"name":             snapshot.Name,
+			"condition_logic":  snapshot.ConditionLogic,
+			"condition_tree":   snapshot.ConditionTree,
+			"time_period_type": snapshot.TimePeriodType,
+			"effect_start":     time.Unix(snapshot.EffectStart, 0),
+			"effect_end":       time.Unix(snapshot.EffectEnd, 0),
+			"repeat_type":      snapshot.RepeatType,
+			"repeat_date":      snapshot.RepeatDate,
+			"mode":             snapshot.Mode,
+			"max_runs":         snapshot.MaxRuns,
+		}
+		if err = tx.Model(&scene).Updates(updates).Error; err != nil {
+			return
+		}
+
+		if err = tx.Where("scene_id=?", sceneID).Delete(&SceneCondition{}).Error; err != nil {
+			return
+		}
+		if err = tx.Where("scene_id=?", sceneID).Delete(&SceneTask{}).Error; err != nil {
+			return
+		}
+		// 保留版本中的id，回滚后与其他版本的差异、执行日志中的执行任务id仍然对应
+		for _, c := range snapshot.SceneConditions {
+			condition := c.SceneCondition
+			condition.SceneID = sceneID
+			condition.TimingAt = time.Unix(c.Timing, 0)
+			if err = tx.Create(&condition).Error; err != nil {
+				return
+			}
+		}
+		for _, t := range snapshot.SceneTasks {
+			t.SceneID = sceneID
+			if err = tx.Create(&t).Error; err != nil {
+				return
+			}
+		}
+
+		r, err = SaveSceneRevision(sceneID, authorID, tx)
+		return
+	})
+	if err != nil {
+		if _, ok := err.(errors.Error); !ok {
+			err = errors.Wrap(err, errors.InternalServerErr)
+		}
+	}
+	return
+}
+
+// DiffSceneSnapshot 比较两个场景版本的配置，触发条件和执行任务按id比较
+func DiffSceneSnapshot(from, to SceneSnapshot) (changes []SceneChange) {
+	changes = make([]SceneChange, 0)
+	fromFields, toFields := snapshotFields(from), snapshotFields(to)
+	var fields []string
+	for field := range toFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if !reflect.DeepEqual(fromFields[field], toFields[field]) {
+			changes = append(changes, SceneChange{
+				Field:  field,
+				Action: ChangeModified,
+				From:   fromFields[field],
+				To:     toFields[field],
+			})
+		}
+	}
+
+	var fromConditions, toConditions []interface{}
+	for _, c := range from.SceneConditions {
+		fromConditions = append(fromConditions, c)
+	}
+	for _, c := range to.SceneConditions {
+		toConditions = append(toConditions, c)
+	}
+	changes = append(changes, diffItems("scene_conditions", fromConditions, toConditions, func(item interface{}) int {
+		return item.(ConditionInfo).ID
+	})...)
+
+	var fromTasks, toTasks []interface{}
+	for _, t := range from.SceneTasks {
+		fromTasks = append(fromTasks, t)
+	}
+	for _, t := range to.SceneTasks {
+		toTasks = append(toTasks, t)
+	}
+	changes = append(changes, diffItems("scene_tasks", fromTasks, toTasks, func(item interface{}) int {
+		return item.(SceneTask).ID
+	})...)
+	return
+}
+
+// snapshotFields 获取除触发条件和执行任务外的场景配置项
+func snapshotFields(snapshot SceneSnapshot) (fields map[string]interface{}) {
+	snapshot.SceneConditions = nil
+	snapshot.SceneTasks = nil
+	data, _ := json.Marshal(snapshot)
+	_ = json.Unmarshal(data, &fields)
+	delete(fields, "scene_conditions")
+	delete(fields, "scene_tasks")
+	return
+}
+
+// diffItems 按 id 比较触发条件或执行任务
+func diffItems(field string, from, to []interface{}, id func(interface{}) int) (changes []SceneChange) {
+	fromItems := make(map[int]interface{})
+	for _, item := range from {
+		fromItems[id(item)] = item
+	}
+	toIDs := make(map[int]bool)
+	for _, item := range to {
+		toIDs[id(item)] = true
+		old, ok := fromItems[id(item)]
+		if !ok {
+			changes = append(changes, SceneChange{Field: field, ID: id(item), Action: ChangeAdded, To: item})
+			continue
+		}
+		if !reflect.DeepEqual(old, item) {
+			changes = append(changes, SceneChange{Field: field, ID: id(item), Action: ChangeModified, From: old, To: item})
+		}
+	}
+	for _, item := range from {
+		if !toIDs[id(item)] {
+			changes = append(changes, SceneChange{Field: field, ID: id(item), Action: ChangeRemoved, From: item})
+		}
+	}
+	return
+}
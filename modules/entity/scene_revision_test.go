@@ -0,0 +1,110 @@
+package entity
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+func TestDiffSceneSnapshot(t *testing.T) {
+	scene := Scene{
+		Name:           "离家",
+		ConditionLogic: MatchAllCondition,
+		EffectStart:    time.Unix(1000, 0),
+		EffectEnd:      time.Unix(2000, 0),
+		SceneConditions: []SceneCondition{
+			{ID: 1, ConditionType: ConditionTypeTiming, TimingAt: time.Unix(1500, 0)},
+		},
+		SceneTasks: []SceneTask{
+			{ID: 1, Type: TaskTypeSmartDevice, DeviceID: 1},
+			{ID: 2, Type: TaskTypeManualRun, ControlSceneID: 2},
+		},
+	}
+	from := NewSceneSnapshot(scene)
+	assert.Empty(t, DiffSceneSnapshot(from, from))
+
+	scene.Name = "晚安"
+	scene.SceneConditions[0].TimingAt = time.Unix(1600, 0)
+	scene.SceneTasks = []SceneTask{
+		{ID: 2, Type: TaskTypeManualRun, ControlSceneID: 2},
+		{ID: 3, Type: TaskTypeSmartDevice, DeviceID: 2},
+	}
+	changes := DiffSceneSnapshot(from, NewSceneSnapshot(scene))
+	assert.Equal(t, []SceneChange{
+		{Field: "name", Action: ChangeModified, From: "离家", To: "晚安"},
+		{Field: "scene_conditions", ID: 1, Action: ChangeModified,
+			From: from.SceneConditions[0], To: NewSceneSnapshot(scene).SceneConditions[0]},
+		{Field: "scene_tasks", ID: 3, Action: ChangeAdded, To: scene.SceneTasks[1]},
+		{Field: "scene_tasks", ID: 1, Action: ChangeRemoved, From: from.SceneTasks[0]},
+	}, changes)
+}
+
+func TestRollbackScene(t *testing.T) {
+	area, err := CreateArea("rollback")
+	assert.Nil(t, err)
+	// 测试数据库不会清理，场景使用不重复的名称
+	name := fmt.Sprintf("rollback_%d", area.ID)
+	scene := Scene{
+		Name:           name,
+		AutoRun:        true,
+		CreatedAt:      time.Now(),
+		AreaID:         area.ID,
+		TimePeriodType: TimePeriodTypeAllDay,
+		RepeatType:     RepeatTypeAllDay,
+		RepeatDate:     "1234567",
+		SceneConditions: []SceneCondition{
+			{ConditionType: ConditionTypeTiming, TimingAt: time.Unix(1500, 0)},
+		},
+		SceneTasks: []SceneTask{
+			{Type: TaskTypeManualRun, ControlSceneID: 2},
+		},
+	}
+	assert.Nil(t, CreateScene(&scene))
+	_, err = SaveSceneRevision(scene.ID, 1, GetDB())
+	assert.Nil(t, err)
+
+	// 其他场景的执行任务在后面创建，回滚时重新分配id会与版本中的id不同
+	other := scene
+	other.ID, other.Name = 0, name+"_other"
+	other.SceneConditions = nil
+	other.SceneTasks = []SceneTask{{Type: TaskTypeManualRun, ControlSceneID: 2}}
+	assert.Nil(t, CreateScene(&other))
+
+	// 修改执行任务后回滚到第一个版本
+	assert.Nil(t, GetDB().Where("scene_id=?", scene.ID).Delete(&SceneTask{}).Error)
+	assert.Nil(t, GetDB().Create(&SceneTask{SceneID: scene.ID, Type: TaskTypeManualRun, ControlSceneID: 3}).Error)
+	_, err = SaveSceneRevision(scene.ID, 1, GetDB())
+	assert.Nil(t, err)
+	// 同一场景的版本号不重复
+	assert.NotNil(t, GetDB().Create(&SceneRevision{SceneID: scene.ID, Revision: 2, AreaID: area.ID}).Error)
+
+	// 校验失败时不恢复
+	deny := errors.New(status.DeviceOrSceneControlDeny)
+	_, err = RollbackScene(scene.ID, 1, 1, func(snapshot SceneSnapshot) error { return deny })
+	assert.Equal(t, deny, err)
+	tasks, err := GetSceneTasksBySceneID(scene.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, 3, tasks[0].ControlSceneID)
+	}
+
+	r, err := RollbackScene(scene.ID, 1, 1, func(snapshot SceneSnapshot) error {
+		assert.Equal(t, 2, snapshot.SceneTasks[0].ControlSceneID)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, r.Revision)
+
+	// 触发条件和执行任务保留版本中的id
+	info, err := GetSceneInfoById(scene.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, info.SceneConditions, 1) && assert.Len(t, info.SceneTasks, 1) {
+		assert.Equal(t, scene.SceneConditions[0].ID, info.SceneConditions[0].ID)
+		assert.Equal(t, scene.SceneTasks[0].ID, info.SceneTasks[0].ID)
+		assert.Equal(t, 2, info.SceneTasks[0].ControlSceneID)
+	}
+}
@@ -12,7 +12,11 @@ import (
 
 // 一个任务仅允许关联一个设备，对应的多个功能点配置；
 // 或者
-// 一个任务仅允许控制同一场景类型下的多个场景
+// 一个任务仅允许控制同一场景类型下的多个场景；
+// 或者
+// 一个任务为流程控制步骤，按设备状态执行嵌套的步骤；
+// 或者
+// 一个任务发送一条通知
 
 type TaskType int
 
@@ -21,6 +25,18 @@ const (
 	TaskTypeManualRun
 	TaskTypeEnableAutoRun
 	TaskTypeDisableAutoRun
+	TaskTypeIf      // 条件判断：设备状态满足条件执行 then，否则执行 else
+	TaskTypeWait    // 等待：设备状态满足条件后执行 then，超时执行 else
+	TaskTypeRepeat  // 重复：按间隔重复执行 then
+	TaskTypeWebhook // 通知：发送 webhook 请求
+	TaskTypeAlert   // 通知：向家庭中的用户推送提醒
+)
+
+const (
+	stepDepthLimit     = 3            // 流程控制步骤最多嵌套的层数
+	repeatTimesLimit   = 100          // 重复步骤最多重复的次数
+	waitTimeoutLimit   = 24 * 60 * 60 // 等待步骤最长等待的秒数
+	deviceTimeoutLimit = 10 * 60      // 设备任务最长的超时秒数
 )
 
 // SceneTask 场景任务
@@ -33,6 +49,16 @@ type SceneTask struct {
 
 	DeviceID   int            `json:"device_id"`
 	Attributes datatypes.JSON `json:"attributes"` // refer to Attribute
+
+	// 流程控制步骤有关配置，嵌套步骤的延时相对于所属步骤开始执行的时间
+	Condition       datatypes.JSON `json:"condition"`        // 判断或等待的设备状态，refer to SceneCondition
+	Then            datatypes.JSON `json:"then"`             // refer to []SceneTask
+	Else            datatypes.JSON `json:"else"`             // refer to []SceneTask
+	TimeoutSeconds  int            `json:"timeout_seconds"`  // 等待的最长秒数；设备任务为执行的超时秒数，为0时使用配置
+	RepeatTimes     int            `json:"repeat_times"`     // 重复的次数
+	IntervalSeconds int            `json:"interval_seconds"` // 每次重复间隔的秒数
+
+	Notification datatypes.JSON `json:"notification"` // 通知任务的配置，refer to Notification
 }
 
 func (d SceneTask) TableName() string {
@@ -59,17 +85,29 @@ func (task SceneTask) CheckTaskDevice(userId int) (err error) {
 		err = errors.Newf(status.SceneParamIncorrectErr, "scene_task_devices")
 		return
 	}
+	if task.TimeoutSeconds < 0 || task.TimeoutSeconds > deviceTimeoutLimit {
+		err = errors.Newf(status.SceneParamIncorrectErr, "超时时间")
+		return
+	}
 
 	var ds []Attribute
 	if err = json.Unmarshal(task.Attributes, &ds); err != nil {
 		logger.Error(err)
 		return
 	}
+	device, err := GetDeviceByID(task.DeviceID)
+	if err != nil {
+		err = errors.Wrap(err, status.DeviceNotExist)
+		return
+	}
 	up, err := GetUserPermissions(userId)
 	if err != nil {
 		return
 	}
 	for _, taskDevice := range ds {
+		if err = device.CheckControlAttr(taskDevice); err != nil {
+			return
+		}
 		if !up.IsDeviceAttrPermit(task.DeviceID, taskDevice) {
 			err = errors.New(status.DeviceOrSceneControlDeny)
 			return
@@ -80,8 +118,186 @@ func (task SceneTask) CheckTaskDevice(userId int) (err error) {
 
 // checkTaskType 执行任务类型校验
 func (task SceneTask) CheckTaskType() (err error) {
-	if task.Type < TaskTypeSmartDevice || task.Type > TaskTypeDisableAutoRun {
+	if task.Type < TaskTypeSmartDevice || task.Type > TaskTypeAlert {
+		err = errors.New(status.TaskTypeErr)
+	}
+	return
+}
+
+// IsSceneControl 是否为控制场景的任务
+func (task SceneTask) IsSceneControl() bool {
+	return task.Type >= TaskTypeManualRun && task.Type <= TaskTypeDisableAutoRun
+}
+
+// IsControlStep 是否为流程控制步骤
+func (task SceneTask) IsControlStep() bool {
+	return task.Type >= TaskTypeIf && task.Type <= TaskTypeRepeat
+}
+
+// TaskName 不控制设备或场景的任务（流程控制步骤、通知）的名称，用于记录日志
+func (task SceneTask) TaskName() string {
+	switch task.Type {
+	case TaskTypeIf:
+		return "条件判断"
+	case TaskTypeWait:
+		return "等待设备状态"
+	case TaskTypeRepeat:
+		return "重复执行"
+	case TaskTypeWebhook:
+		return "发送 webhook"
+	case TaskTypeAlert:
+		return "推送提醒"
+	}
+	return ""
+}
+
+// GetCondition 获取流程控制步骤判断的设备状态条件
+func (task SceneTask) GetCondition() (condition SceneCondition, err error) {
+	if len(task.Condition) == 0 {
+		err = errors.Newf(status.SceneParamIncorrectErr, "步骤条件")
+		return
+	}
+	if err = json.Unmarshal(task.Condition, &condition); err != nil {
+		err = errors.Wrapf(err, status.SceneParamIncorrectErr, "步骤条件")
+		return
+	}
+	condition.ID = 0
+	condition.SceneID = task.SceneID
+	condition.ConditionType = ConditionTypeDeviceStatus
+	return
+}
+
+// GetThen 获取流程控制步骤中条件满足、等待成功或重复执行的步骤
+func (task SceneTask) GetThen() ([]SceneTask, error) {
+	return task.getSteps(task.Then, "then")
+}
+
+// GetElse 获取流程控制步骤中条件不满足或等待超时执行的步骤
+func (task SceneTask) GetElse() ([]SceneTask, error) {
+	return task.getSteps(task.Else, "else")
+}
+
+// getSteps 解析嵌套的步骤，嵌套步骤与所属步骤属于同一场景
+func (task SceneTask) getSteps(data datatypes.JSON, field string) (steps []SceneTask, err error) {
+	if len(data) == 0 || string(data) == "null" {
+		return
+	}
+	if err = json.Unmarshal(data, &steps); err != nil {
+		err = errors.Wrapf(err, status.SceneParamIncorrectErr, field)
+		return
+	}
+	for i := range steps {
+		steps[i].ID = 0
+		steps[i].SceneID = task.SceneID
+	}
+	return
+}
+
+// LeafTasks 获取实际控制设备或场景的任务，流程控制步骤返回其嵌套的所有任务
+func (task SceneTask) LeafTasks() (tasks []SceneTask, err error) {
+	if task.IsNotification() {
+		return
+	}
+	if !task.IsControlStep() {
+		return []SceneTask{task}, nil
+	}
+	thenSteps, err := task.GetThen()
+	if err != nil {
+		return
+	}
+	elseSteps, err := task.GetElse()
+	if err != nil {
+		return
+	}
+	for _, step := range append(thenSteps, elseSteps...) {
+		var leaves []SceneTask
+		if leaves, err = step.LeafTasks(); err != nil {
+			return
+		}
+		tasks = append(tasks, leaves...)
+	}
+	return
+}
+
+// CheckControlStep 校验流程控制步骤的配置，返回需要继续校验的嵌套步骤
+func (task SceneTask) CheckControlStep(userId int) (steps []SceneTask, err error) {
+	return task.checkControlStep(userId, 1)
+}
+
+func (task SceneTask) checkControlStep(userId, depth int) (steps []SceneTask, err error) {
+	if depth > stepDepthLimit {
+		err = errors.Newf(status.SceneParamIncorrectErr, "步骤嵌套层数")
+		return
+	}
+	if task.DeviceID != 0 || task.ControlSceneID != 0 {
 		err = errors.New(status.TaskTypeErr)
+		return
+	}
+
+	thenSteps, err := task.GetThen()
+	if err != nil {
+		return
+	}
+	elseSteps, err := task.GetElse()
+	if err != nil {
+		return
+	}
+	switch task.Type {
+	case TaskTypeIf:
+		if len(thenSteps) == 0 && len(elseSteps) == 0 {
+			err = errors.Newf(status.SceneParamIncorrectErr, "then")
+			return
+		}
+	case TaskTypeWait:
+		if task.TimeoutSeconds <= 0 || task.TimeoutSeconds > waitTimeoutLimit {
+			err = errors.Newf(status.SceneParamIncorrectErr, "等待超时时间")
+			return
+		}
+	case TaskTypeRepeat:
+		if len(thenSteps) == 0 || len(elseSteps) != 0 {
+			err = errors.Newf(status.SceneParamIncorrectErr, "then")
+			return
+		}
+		if task.RepeatTimes <= 0 || task.RepeatTimes > repeatTimesLimit {
+			err = errors.Newf(status.SceneParamIncorrectErr, "重复次数")
+			return
+		}
+		if task.IntervalSeconds < 0 {
+			err = errors.Newf(status.SceneParamIncorrectErr, "重复间隔")
+			return
+		}
+	}
+
+	if task.Type != TaskTypeRepeat {
+		var condition SceneCondition
+		if condition, err = task.GetCondition(); err != nil {
+			return
+		}
+		// 步骤执行时才判断状态，没有状态变化
+		if condition.DeviceID <= 0 || condition.Operator.IsEdgeTriggered() ||
+			condition.Duration < 0 || condition.Duration > durationLimit {
+			err = errors.Newf(status.SceneParamIncorrectErr, "步骤条件")
+			return
+		}
+		if err = condition.CheckConditionItem(userId, condition.DeviceID); err != nil {
+			return
+		}
+	}
+
+	for _, step := range append(thenSteps, elseSteps...) {
+		if step.DelaySeconds < 0 {
+			err = errors.Newf(status.SceneParamIncorrectErr, "延时")
+			return
+		}
+		if !step.IsControlStep() {
+			steps = append(steps, step)
+			continue
+		}
+		var nested []SceneTask
+		if nested, err = step.checkControlStep(userId, depth+1); err != nil {
+			return
+		}
+		steps = append(steps, nested...)
 	}
 	return
 }
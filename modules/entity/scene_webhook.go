@@ -0,0 +1,71 @@
+package entity
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	errors2 "errors"
+
+	"gorm.io/gorm"
+
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// webhookTokenBytes webhook 密钥的随机字节数
+const webhookTokenBytes = 32
+
+// newWebhookToken 生成 webhook 密钥
+func newWebhookToken() (token string, err error) {
+	b := make([]byte, webhookTokenBytes)
+	if _, err = rand.Read(b); err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetSceneWebhookToken 获取场景的 webhook 密钥，未生成时生成并保存
+func GetSceneWebhookToken(sceneID int) (token string, err error) {
+	scene, err := GetSceneById(sceneID)
+	if err != nil {
+		if errors2.Is(err, gorm.ErrRecordNotFound) {
+			err = errors.New(status.SceneNotExist)
+		} else {
+			err = errors.Wrap(err, errors.InternalServerErr)
+		}
+		return
+	}
+	if scene.WebhookToken != "" {
+		return scene.WebhookToken, nil
+	}
+	return ResetSceneWebhookToken(sceneID)
+}
+
+// ResetSceneWebhookToken 重新生成场景的 webhook 密钥，旧的地址随即失效
+func ResetSceneWebhookToken(sceneID int) (token string, err error) {
+	if token, err = newWebhookToken(); err != nil {
+		return
+	}
+	// 只更新密钥，不触发场景的 BeforeSave 校验
+	if err = GetDB().Model(&Scene{}).Where("id=?", sceneID).
+		UpdateColumn("webhook_token", token).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+	}
+	return
+}
+
+// GetSceneByWebhookToken 根据 webhook 密钥获取场景
+func GetSceneByWebhookToken(token string) (scene Scene, err error) {
+	if token == "" {
+		err = errors.New(status.SceneNotExist)
+		return
+	}
+	if err = GetDB().Where("webhook_token=?", token).First(&scene).Error; err != nil {
+		if errors2.Is(err, gorm.ErrRecordNotFound) {
+			err = errors.New(status.SceneNotExist)
+		} else {
+			err = errors.Wrap(err, errors.InternalServerErr)
+		}
+	}
+	return
+}
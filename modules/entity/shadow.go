@@ -2,6 +2,8 @@ package entity
 
 import (
 	"errors"
+	"reflect"
+	"time"
 
 	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
 )
@@ -11,6 +13,8 @@ type State struct {
 	Desired map[int]map[string]interface{} `json:"desired"`
 	// Reported 报告值
 	Reported map[int]map[string]interface{} `json:"reported"`
+	// Previous 报告值变化前的值
+	Previous map[int]map[string]interface{} `json:"previous"`
 }
 
 type Metadata struct {
@@ -35,6 +39,7 @@ func NewShadow() Shadow {
 		State: State{
 			Desired:  make(map[int]map[string]interface{}),
 			Reported: make(map[int]map[string]interface{}),
+			Previous: make(map[int]map[string]interface{}),
 		},
 		Metadata: Metadata{
 			Desired:  make(map[int]map[string]AttrMetadata),
@@ -43,13 +48,83 @@ func NewShadow() Shadow {
 	}
 }
 
-func (s *Shadow) UpdateReported(instanceID int, attr server.Attribute) {
+// UpdateReported 更新属性的报告值，返回更新前的报告值（第一次上报时为 nil）及值是否变化（第一次上报视为变化）
+func (s *Shadow) UpdateReported(instanceID int, attr server.Attribute) (previous interface{}, changed bool) {
 
+	if s.State.Reported == nil {
+		s.State.Reported = make(map[int]map[string]interface{})
+	}
+	changed = true
+	if ins, ok := s.State.Reported[instanceID]; ok {
+		if old, ok := ins[attr.Attribute]; ok {
+			previous = old
+			changed = !reflect.DeepEqual(old, attr.Val)
+			if changed {
+				s.updatePrevious(instanceID, attr.Attribute, old)
+			}
+		}
+		ins[attr.Attribute] = attr.Val
+	} else {
+		s.State.Reported[instanceID] = map[string]interface{}{attr.Attribute: attr.Val}
+	}
+	// 仅在值变化时更新时间戳，用于判断状态持续的时间
+	if changed {
+		s.updateReportedMetadata(instanceID, attr.Attribute, time.Now())
+	}
+	return
+}
+
+// SetReported 直接设置属性的报告值、变化前的值（为 nil 时不设置）和变化时间，用于模拟设备状态
+func (s *Shadow) SetReported(instanceID int, attr server.Attribute, previous interface{}, changedAt time.Time) {
+	if s.State.Reported == nil {
+		s.State.Reported = make(map[int]map[string]interface{})
+	}
 	if ins, ok := s.State.Reported[instanceID]; ok {
 		ins[attr.Attribute] = attr.Val
 	} else {
 		s.State.Reported[instanceID] = map[string]interface{}{attr.Attribute: attr.Val}
 	}
+	if previous != nil {
+		s.updatePrevious(instanceID, attr.Attribute, previous)
+	}
+	s.updateReportedMetadata(instanceID, attr.Attribute, changedAt)
+}
+
+// updatePrevious 保存属性变化前的报告值
+func (s *Shadow) updatePrevious(instanceID int, attribute string, val interface{}) {
+	if s.State.Previous == nil {
+		s.State.Previous = make(map[int]map[string]interface{})
+	}
+	if ins, ok := s.State.Previous[instanceID]; ok {
+		ins[attribute] = val
+	} else {
+		s.State.Previous[instanceID] = map[string]interface{}{attribute: val}
+	}
+}
+
+func (s *Shadow) updateReportedMetadata(instanceID int, attribute string, at time.Time) {
+	if s.Metadata.Reported == nil {
+		s.Metadata.Reported = make(map[int]map[string]AttrMetadata)
+	}
+	md := AttrMetadata{Timestamp: at.Unix()}
+	if ins, ok := s.Metadata.Reported[instanceID]; ok {
+		ins[attribute] = md
+	} else {
+		s.Metadata.Reported[instanceID] = map[string]AttrMetadata{attribute: md}
+	}
+}
+
+// ReportedAt 属性报告值最近一次变化的时间
+func (s Shadow) ReportedAt(instanceID int, attribute string) (t time.Time, ok bool) {
+	ins, ok := s.Metadata.Reported[instanceID]
+	if !ok {
+		return
+	}
+	md, ok := ins[attribute]
+	if !ok {
+		return
+	}
+	return time.Unix(md.Timestamp, 0), true
 }
 
 func (s Shadow) reportedAttr(instanceID int, attribute string) (val interface{}, err error) {
@@ -67,3 +142,13 @@ func (s Shadow) reportedAttr(instanceID int, attribute string) (val interface{},
 func (s Shadow) Get(instanceID int, attribute string) (val interface{}, err error) {
 	return s.reportedAttr(instanceID, attribute)
 }
+
+// GetPrevious 获取属性变化前的报告值
+func (s Shadow) GetPrevious(instanceID int, attribute string) (val interface{}, ok bool) {
+	ins, ok := s.State.Previous[instanceID]
+	if !ok {
+		return
+	}
+	val, ok = ins[attribute]
+	return
+}
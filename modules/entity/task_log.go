@@ -20,13 +20,23 @@ const (
 	TaskDeviceAlreadyDeleted
 	TaskDeviceDisConnect
 	TaskSceneAlreadyDeleted
+	TaskCanceled
+	TaskMissed
+	TaskSkipped
 )
 
 var (
 	taskErrMap = map[errors.Code]TaskResultType{
-		errors.GetCode(status.SceneNotExist):  TaskSceneAlreadyDeleted,
-		errors.GetCode(status.DeviceNotExist): TaskDeviceAlreadyDeleted,
-		errors.GetCode(status.DeviceOffline):  TaskDeviceDisConnect,
+		errors.GetCode(status.SceneNotExist):     TaskSceneAlreadyDeleted,
+		errors.GetCode(status.DeviceNotExist):    TaskDeviceAlreadyDeleted,
+		errors.GetCode(status.DeviceOffline):     TaskDeviceDisConnect,
+		errors.GetCode(status.SceneTaskCanceled): TaskCanceled,
+		errors.GetCode(status.SceneTaskMissed):   TaskMissed,
+		errors.GetCode(status.SceneRunSkipped):   TaskSkipped,
+		errors.GetCode(status.SceneWaitTimeout):  TaskTimeout,
+		errors.GetCode(status.DeviceTaskTimeout): TaskTimeout,
+
+		errors.GetCode(status.DeviceTaskPartFailed): TaskPartSuccess,
 	}
 )
 
@@ -41,11 +51,16 @@ type TaskLog struct {
 	Error  string
 
 	DeviceLocation string // 设备区域
+	SceneRevision  int    // 执行的场景版本
 
 	TaskID        string    `gorm:"unique"` // 任务ID
 	ParentTaskID  *string   // 父任务id
+	RootTaskID    string    `gorm:"index"`                                        // 所属场景执行的任务id，场景执行的日志为自身的任务id
 	ChildTaskLogs []TaskLog `gorm:"foreignkey:parent_task_id;references:task_id"` // 子任务日志
 
+	SceneID  int `gorm:"index"` // 所属场景执行的场景id，子任务与父任务相同
+	DeviceID int `gorm:"index"` // 控制的设备id
+
 	FinishedAt time.Time
 	CreatedAt  time.Time
 
@@ -99,18 +114,30 @@ func UpdateParentLog(parentTaskID string) error {
 		Finish:     true,
 		FinishedAt: time.Now(),
 	}
-	var errCount int
+	var (
+		errCount  int
+		partCount int
+		canceled  bool
+	)
 	for _, tl := range taskLogs {
 		if tl.Result == 0 {
 			return nil
 		}
-		if tl.Error != "" {
+		if tl.Result == TaskPartSuccess { // 子任务部分成功
+			partCount += 1
+		} else if tl.Error != "" {
 			errCount += 1
 		}
+		if tl.Result == TaskCanceled {
+			canceled = true
+		}
 	}
-	if errCount == len(taskLogs) {
+	// 有子任务被取消则该次执行为已取消
+	if canceled {
+		update.Result = TaskCanceled
+	} else if errCount == len(taskLogs) {
 		update.Result = TaskFail
-	} else if errCount == 0 {
+	} else if errCount == 0 && partCount == 0 {
 		update.Result = TaskSuccess
 	} else {
 		update.Result = TaskPartSuccess
@@ -134,6 +161,9 @@ func NewTaskLog(target interface{}, taskID string, parentTaskID *string) error {
 		taskType TaskType
 		location Location
 		areaID   uint64
+		revision int
+		sceneID  int
+		deviceID int
 	)
 	switch v := target.(type) {
 	case Scene:
@@ -143,20 +173,44 @@ func NewTaskLog(target interface{}, taskID string, parentTaskID *string) error {
 			taskType = TaskTypeEnableAutoRun // TODO 不准确
 		}
 		areaID = v.AreaID
+		revision = v.Revision
+		sceneID = v.ID
 	case Device:
 		name = v.Name
 		location, _ = GetLocationByID(v.LocationID)
 		taskType = TaskTypeSmartDevice
 		areaID = v.AreaID
+		deviceID = v.ID
+	case SceneTask: // 流程控制步骤、通知
+		name = v.TaskName()
+		taskType = v.Type
+		sceneID = v.SceneID
+		if scene, err := GetSceneByIDWithUnscoped(v.SceneID); err == nil {
+			areaID = scene.AreaID
+		}
 	}
 	taskLog := TaskLog{
 		Name:           name,
 		DeviceLocation: location.Name,
+		SceneRevision:  revision,
 		Type:           taskType,
 		TaskID:         taskID,
 		ParentTaskID:   parentTaskID,
+		RootTaskID:     taskID,
+		SceneID:        sceneID,
+		DeviceID:       deviceID,
 		CreatedAt:      time.Now(),
 		AreaID:         areaID,
 	}
+	// 子任务属于父任务所在的场景执行
+	if parentTaskID != nil {
+		var parent TaskLog
+		if err := GetDB().Where("task_id=?", *parentTaskID).First(&parent).Error; err == nil {
+			taskLog.SceneID = parent.SceneID
+			if parent.RootTaskID != "" {
+				taskLog.RootTaskID = parent.RootTaskID
+			}
+		}
+	}
 	return GetDB().Create(&taskLog).Error
 }
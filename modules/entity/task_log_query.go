@@ -0,0 +1,155 @@
+package entity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// TaskLogFilter 场景执行日志的筛选条件，为零值的条件不筛选
+type TaskLogFilter struct {
+	AreaID    uint64
+	SceneID   int              // 执行的场景
+	DeviceID  int              // 执行中控制了该设备
+	Results   []TaskResultType // 执行结果
+	StartTime time.Time        // 完成时间不早于
+	EndTime   time.Time        // 完成时间早于
+}
+
+// TaskLogCursor 场景执行日志分页的游标，为上一页最后一条日志的完成时间和id
+type TaskLogCursor struct {
+	FinishedAt time.Time
+	ID         int
+}
+
+// NewTaskLogCursor 生成日志的游标
+func NewTaskLogCursor(tl TaskLog) TaskLogCursor {
+	return TaskLogCursor{FinishedAt: tl.FinishedAt, ID: tl.ID}
+}
+
+// ParseTaskLogCursor 解析游标字符串，格式为 完成时间(纳秒)_id
+func ParseTaskLogCursor(s string) (cursor TaskLogCursor, err error) {
+	parts := strings.Split(s, "_")
+	if len(parts) != 2 {
+		err = errors.Newf(status.SceneParamIncorrectErr, "游标")
+		return
+	}
+	ns, e1 := strconv.ParseInt(parts[0], 10, 64)
+	id, e2 := strconv.Atoi(parts[1])
+	if e1 != nil || e2 != nil {
+		err = errors.Newf(status.SceneParamIncorrectErr, "游标")
+		return
+	}
+	return TaskLogCursor{FinishedAt: time.Unix(0, ns), ID: id}, nil
+}
+
+// String 游标字符串
+func (c TaskLogCursor) String() string {
+	return fmt.Sprintf("%d_%d", c.FinishedAt.UnixNano(), c.ID)
+}
+
+// SceneRunLogs 获取已完成的场景执行日志，按完成时间倒序，每次执行一条，子任务日志在 ChildTaskLogs 中；
+// cursor 不为空时从游标之后开始，否则从 offset 开始
+func SceneRunLogs(filter TaskLogFilter, cursor *TaskLogCursor, offset, size int) (taskLogs []TaskLog, err error) {
+	db := sceneRunQuery(filter).
+		Preload("ChildTaskLogs").
+		Order("finished_at desc, id desc")
+	if cursor != nil {
+		db = db.Where("finished_at < ? or (finished_at = ? and id < ?)",
+			cursor.FinishedAt, cursor.FinishedAt, cursor.ID)
+	} else {
+		db = db.Offset(offset)
+	}
+	if err = db.Limit(size).Find(&taskLogs).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+	}
+	return
+}
+
+// sceneRunQuery 按筛选条件查询已完成的场景执行日志
+func sceneRunQuery(filter TaskLogFilter) *gorm.DB {
+	db := GetDB().Where("parent_task_id is null and type !=? and finish=? and result !=? and area_id=?",
+		TaskTypeSmartDevice, true, TaskSceneAlreadyDeleted, filter.AreaID)
+	if filter.SceneID != 0 {
+		db = db.Where("scene_id=?", filter.SceneID)
+	}
+	if filter.DeviceID != 0 {
+		rootIDs := GetDB().Model(&TaskLog{}).Select("root_task_id").Where("device_id=?", filter.DeviceID)
+		db = db.Where("task_id in (?)", rootIDs)
+	}
+	if len(filter.Results) != 0 {
+		db = db.Where("result in (?)", filter.Results)
+	}
+	if !filter.StartTime.IsZero() {
+		db = db.Where("finished_at >= ?", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		db = db.Where("finished_at < ?", filter.EndTime)
+	}
+	return db
+}
+
+// IsFailed 执行结果是否为失败（包括部分成功），已取消、已跳过及错过执行时间不算失败
+func (r TaskResultType) IsFailed() bool {
+	switch r {
+	case TaskSuccess, TaskCanceled, TaskMissed, TaskSkipped:
+		return false
+	}
+	return true
+}
+
+// SceneRunStat 场景的执行统计
+type SceneRunStat struct {
+	SceneID     int                    `json:"scene_id"`
+	Name        string                 `json:"name"`
+	Total       int                    `json:"total"`        // 执行次数
+	Failed      int                    `json:"failed"`       // 失败次数，包括部分成功
+	FailureRate float64                `json:"failure_rate"` // 失败率
+	Results     map[TaskResultType]int `json:"results"`      // 各执行结果的次数
+}
+
+// GetSceneRunStats 按场景统计符合筛选条件的场景执行日志，按场景id排列
+func GetSceneRunStats(filter TaskLogFilter) (stats []SceneRunStat, err error) {
+	var rows []struct {
+		SceneID int
+		Result  TaskResultType
+		Count   int
+	}
+	// 旧版本的日志没有记录场景id，不参与统计
+	if err = sceneRunQuery(filter).Model(&TaskLog{}).
+		Where("scene_id != 0").
+		Select("scene_id, result, count(*) as count").
+		Group("scene_id, result").
+		Order("scene_id").
+		Scan(&rows).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+
+	stats = make([]SceneRunStat, 0)
+	for _, row := range rows {
+		if len(stats) == 0 || stats[len(stats)-1].SceneID != row.SceneID {
+			stat := SceneRunStat{SceneID: row.SceneID, Results: make(map[TaskResultType]int)}
+			if scene, e := GetSceneByIDWithUnscoped(row.SceneID); e == nil {
+				stat.Name = scene.Name
+			}
+			stats = append(stats, stat)
+		}
+		stat := &stats[len(stats)-1]
+		stat.Total += row.Count
+		stat.Results[row.Result] += row.Count
+		if row.Result.IsFailed() {
+			stat.Failed += row.Count
+		}
+	}
+	for i := range stats {
+		stats[i].FailureRate = float64(stats[i].Failed) / float64(stats[i].Total)
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// taskLogCleanBatch 每次清理的场景执行日志数
+const taskLogCleanBatch = 500
+
+// CleanTaskLogs 清理创建时间早于 before 的执行日志，以及每个家庭超出 maxCount 条的场景执行日志，
+// 场景执行的子任务日志一起删除；before 为零值时不按时间清理，maxCount 为0时不按数量清理
+func CleanTaskLogs(before time.Time, maxCount int) (count int64, err error) {
+	if !before.IsZero() {
+		var n int64
+		n, err = cleanRootTaskLogs(func() ([]string, error) {
+			var taskIDs []string
+			err := GetDB().Unscoped().Model(&TaskLog{}).
+				Where("parent_task_id is null and created_at < ?", before).
+				Limit(taskLogCleanBatch).Pluck("task_id", &taskIDs).Error
+			return taskIDs, err
+		})
+		if count += n; err != nil {
+			return
+		}
+	}
+	if maxCount <= 0 {
+		return
+	}
+
+	var areaIDs []uint64
+	if err = GetDB().Unscoped().Model(&TaskLog{}).
+		Where("parent_task_id is null").
+		Distinct().Pluck("area_id", &areaIDs).Error; err != nil {
+		err = errors.Wrap(err, errors.InternalServerErr)
+		return
+	}
+	for _, areaID := range areaIDs {
+		var n int64
+		n, err = cleanRootTaskLogs(func() ([]string, error) {
+			// 保留最新的 maxCount 条，删除之后的日志
+			var taskIDs []string
+			err := GetDB().Unscoped().Model(&TaskLog{}).
+				Where("parent_task_id is null and area_id=?", areaID).
+				Order("id desc").Offset(maxCount).
+				Limit(taskLogCleanBatch).Pluck("task_id", &taskIDs).Error
+			return taskIDs, err
+		})
+		if count += n; err != nil {
+			return
+		}
+	}
+	return
+}
+
+// cleanRootTaskLogs 分批删除 next 返回的场景执行日志及其子任务日志，直到没有需要删除的日志
+func cleanRootTaskLogs(next func() ([]string, error)) (count int64, err error) {
+	for {
+		var taskIDs []string
+		if taskIDs, err = next(); err != nil {
+			err = errors.Wrap(err, errors.InternalServerErr)
+			return
+		}
+		if len(taskIDs) == 0 {
+			return
+		}
+		var n int64
+		n, err = deleteTaskLogTree(taskIDs)
+		if count += n; err != nil || n == 0 {
+			return
+		}
+	}
+}
+
+// deleteTaskLogTree 删除日志及其所有子任务日志，子任务日志引用父任务日志，从最深的一层开始删除
+func deleteTaskLogTree(taskIDs []string) (count int64, err error) {
+	levels := [][]string{taskIDs}
+	for {
+		var childIDs []string
+		if err = GetDB().Unscoped().Model(&TaskLog{}).
+			Where("parent_task_id in (?)", levels[len(levels)-1]).
+			Pluck("task_id", &childIDs).Error; err != nil {
+			err = errors.Wrap(err, errors.InternalServerErr)
+			return
+		}
+		if len(childIDs) == 0 {
+			break
+		}
+		levels = append(levels, childIDs)
+	}
+
+	for i := len(levels) - 1; i >= 0; i-- {
+		result := GetDB().Unscoped().Where("task_id in (?)", levels[i]).Delete(&TaskLog{})
+		if result.Error != nil {
+			err = errors.Wrap(result.Error, errors.InternalServerErr)
+			return
+		}
+		count += result.RowsAffected
+	}
+	return
+}
@@ -1,6 +1,9 @@
 package entity
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 
@@ -52,3 +55,83 @@ func TestUpdateParentLog(t *testing.T) {
 	GetDB().Where("id=?", "1").Find(&taskLog)
 	assert.Equal(t, taskLog.Result, TaskFail)
 }
+
+// addSceneRunLog 添加一条已完成的场景执行日志及其控制设备的子任务日志
+func addSceneRunLog(area Area, sceneID, deviceID int, result TaskResultType, createdAt time.Time) TaskLog {
+	id := fmt.Sprintf("run-%d-%d", area.ID, createdAt.UnixNano())
+	childID := id + "-device"
+	root := TaskLog{Name: "scene", Type: TaskTypeManualRun, Finish: true, Result: result,
+		TaskID: id, RootTaskID: id, SceneID: sceneID, FinishedAt: createdAt, CreatedAt: createdAt, AreaID: area.ID}
+	GetDB().Create(&root)
+	GetDB().Create(&TaskLog{Name: "device", Type: TaskTypeSmartDevice, Finish: true, Result: result,
+		TaskID: childID, ParentTaskID: &id, RootTaskID: id, SceneID: sceneID, DeviceID: deviceID,
+		FinishedAt: createdAt, CreatedAt: createdAt, AreaID: area.ID})
+	return root
+}
+
+func TestSceneRunLogs(t *testing.T) {
+	area := Area{Name: "test_scene_run_logs"}
+	assert.NoError(t, GetDB().Create(&area).Error)
+	now := time.Now()
+	addSceneRunLog(area, 1, 10, TaskSuccess, now.Add(-3*time.Hour))
+	addSceneRunLog(area, 1, 11, TaskFail, now.Add(-2*time.Hour))
+	addSceneRunLog(area, 2, 10, TaskTimeout, now.Add(-time.Hour))
+
+	// 游标分页
+	logs, err := SceneRunLogs(TaskLogFilter{AreaID: area.ID}, nil, 0, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 2) {
+		assert.Equal(t, TaskTimeout, logs[0].Result)
+		assert.Len(t, logs[0].ChildTaskLogs, 1)
+		cursor, err := ParseTaskLogCursor(NewTaskLogCursor(logs[1]).String())
+		assert.NoError(t, err)
+		logs, err = SceneRunLogs(TaskLogFilter{AreaID: area.ID}, &cursor, 0, 2)
+		assert.NoError(t, err)
+		if assert.Len(t, logs, 1) {
+			assert.Equal(t, TaskSuccess, logs[0].Result)
+		}
+	}
+
+	logs, err = SceneRunLogs(TaskLogFilter{AreaID: area.ID, SceneID: 1, DeviceID: 10}, nil, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, logs, 1)
+	logs, err = SceneRunLogs(TaskLogFilter{AreaID: area.ID, Results: []TaskResultType{TaskFail, TaskTimeout},
+		StartTime: now.Add(-150 * time.Minute)}, nil, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, logs, 2)
+
+	stats, err := GetSceneRunStats(TaskLogFilter{AreaID: area.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, 1, stats[0].SceneID)
+		assert.Equal(t, 2, stats[0].Total)
+		assert.Equal(t, 0.5, stats[0].FailureRate)
+		assert.Equal(t, 1.0, stats[1].FailureRate)
+	}
+}
+
+func TestCleanTaskLogs(t *testing.T) {
+	area := Area{Name: "test_clean_task_logs"}
+	assert.NoError(t, GetDB().Create(&area).Error)
+	now := time.Now()
+	old := addSceneRunLog(area, 1, 10, TaskSuccess, now.AddDate(0, 0, -10))
+	addSceneRunLog(area, 1, 10, TaskSuccess, now.Add(-2*time.Hour))
+	latest := addSceneRunLog(area, 1, 10, TaskSuccess, now.Add(-time.Hour))
+
+	// 过期的日志及其子任务日志
+	count, err := CleanTaskLogs(now.AddDate(0, 0, -7), 0)
+	assert.NoError(t, err)
+	assert.True(t, count >= 2)
+	var n int64
+	GetDB().Model(&TaskLog{}).Where("root_task_id=?", old.TaskID).Count(&n)
+	assert.Equal(t, int64(0), n)
+
+	// 每个家庭只保留最新的日志
+	_, err = CleanTaskLogs(time.Time{}, 1)
+	assert.NoError(t, err)
+	var logs []TaskLog
+	GetDB().Where("area_id=?", area.ID).Find(&logs)
+	if assert.Len(t, logs, 2) {
+		assert.Equal(t, latest.TaskID, logs[0].RootTaskID)
+	}
+}
@@ -0,0 +1,98 @@
+package entity
+
+import (
+	"encoding/json"
+
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+)
+
+// thingModel 设备保存的物模型，只解析校验属性需要的字段
+type thingModel struct {
+	Instances []struct {
+		InstanceID int                `json:"instance_id"`
+		Attributes []server.Attribute `json:"attributes"`
+	} `json:"instances"`
+}
+
+// GetThingModelAttr 获取物模型中实例 instanceID 的属性 attr，物模型不存在或没有该属性时 ok 为 false
+func (d Device) GetThingModelAttr(instanceID int, attr string) (a server.Attribute, ok bool) {
+	var tm thingModel
+	if len(d.ThingModel) == 0 || json.Unmarshal(d.ThingModel, &tm) != nil {
+		return
+	}
+	for _, ins := range tm.Instances {
+		if ins.InstanceID != instanceID {
+			continue
+		}
+		for _, a := range ins.Attributes {
+			if a.Attribute == attr {
+				return a, true
+			}
+		}
+	}
+	return
+}
+
+// IsReadOnlyAttr 属性是否为只读属性（如传感器上报的状态），只读属性不需要控制权限即可作为触发条件
+func IsReadOnlyAttr(deviceID int, attr Attribute) bool {
+	d, err := GetDeviceByID(deviceID)
+	if err != nil {
+		return false
+	}
+	a, ok := d.GetThingModelAttr(attr.InstanceID, attr.Attribute.Attribute)
+	return ok && a.ReadOnly
+}
+
+// CheckControlAttr 校验设置的属性及其值：属性需要可以设置，数值在范围内，枚举为有效值；
+// 没有保存物模型的设备不校验
+func (d Device) CheckControlAttr(attr Attribute) error {
+	if len(d.ThingModel) == 0 {
+		return nil
+	}
+	name := attr.Attribute.Attribute
+	a, ok := d.GetThingModelAttr(attr.InstanceID, name)
+	if !ok {
+		return errors.Newf(status.BlueprintAttrNotSupport, d.Name, name)
+	}
+	if a.ReadOnly {
+		return errors.Newf(status.DeviceAttrReadOnly, name)
+	}
+	if !isAttrValValid(a, attr.Val) {
+		return errors.Newf(status.DeviceAttrValIncorrect, name)
+	}
+	return nil
+}
+
+// isAttrValValid 值是否符合属性的类型、范围及枚举值
+func isAttrValValid(a server.Attribute, val interface{}) bool {
+	switch a.ValType {
+	case "int", "float", "enum":
+		v, ok := val.(float64)
+		if !ok {
+			return false
+		}
+		if a.ValType != "float" && v != float64(int(v)) {
+			return false
+		}
+		if a.Min != nil && v < float64(*a.Min) || a.Max != nil && v > float64(*a.Max) {
+			return false
+		}
+		if a.ValType == "enum" && len(a.Enums) != 0 {
+			for _, e := range a.Enums {
+				if float64(e) == v {
+					return true
+				}
+			}
+			return false
+		}
+	case "bool":
+		_, ok := val.(bool)
+		return ok
+	case "string":
+		_, ok := val.(string)
+		return ok
+	}
+	return true
+}
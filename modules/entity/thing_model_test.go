@@ -0,0 +1,38 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+)
+
+func TestCheckControlAttr(t *testing.T) {
+	device := Device{Name: "thermostat", ThingModel: []byte(`{"instances":[{"type":"thermostat","instance_id":1,
+"attributes":[{"attribute":"target_temperature","val_type":"int","min":16,"max":30},
+{"attribute":"current_temperature","val_type":"float","read_only":true},
+{"attribute":"hvac_mode","val_type":"enum","enums":[0,1,2]}]}]}`)}
+
+	attr := func(name string, val interface{}) Attribute {
+		return Attribute{Attribute: server.Attribute{Attribute: name, Val: val}, InstanceID: 1}
+	}
+	code := func(err error) int {
+		if e, ok := err.(errors.Error); ok {
+			return e.Code.Status
+		}
+		return 0
+	}
+
+	assert.NoError(t, device.CheckControlAttr(attr("target_temperature", float64(26))))
+	assert.NoError(t, device.CheckControlAttr(attr("hvac_mode", float64(2))))
+	assert.Equal(t, status.DeviceAttrValIncorrect, code(device.CheckControlAttr(attr("target_temperature", float64(31)))))
+	assert.Equal(t, status.DeviceAttrValIncorrect, code(device.CheckControlAttr(attr("target_temperature", 25.5))))
+	assert.Equal(t, status.DeviceAttrValIncorrect, code(device.CheckControlAttr(attr("hvac_mode", float64(3)))))
+	assert.Equal(t, status.DeviceAttrReadOnly, code(device.CheckControlAttr(attr("current_temperature", float64(20)))))
+	assert.Equal(t, status.BlueprintAttrNotSupport, code(device.CheckControlAttr(attr("power", "on"))))
+
+	// 没有物模型的设备不校验
+	assert.NoError(t, Device{}.CheckControlAttr(attr("power", "on")))
+}
@@ -0,0 +1,202 @@
+package event
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+const (
+	defaultWorkers   = 4   // 每个订阅者处理事件的协程数
+	defaultQueueSize = 256 // 每个协程待处理的事件数上限，超出时丢弃事件
+)
+
+// Handler 处理事件
+type Handler func(e Event) error
+
+// DeviceStateHandler 将设备状态改变回调包装为事件处理函数
+func DeviceStateHandler(cb func(d entity.Device, attr entity.Attribute) error) Handler {
+	return func(e Event) error {
+		if e, ok := e.(DeviceStateChanged); ok {
+			return cb(e.Device, e.Attr)
+		}
+		return nil
+	}
+}
+
+// Option 订阅选项
+type Option func(s *Subscription)
+
+// WithTypes 只订阅指定类型的事件
+func WithTypes(types ...Type) Option {
+	return func(s *Subscription) {
+		for _, t := range types {
+			s.types[t] = true
+		}
+	}
+}
+
+// WithArea 只订阅家庭 areaID 的事件
+func WithArea(areaID uint64) Option {
+	return func(s *Subscription) {
+		s.areaID = areaID
+	}
+}
+
+// WithQueueSize 设置每个协程待处理的事件数上限
+func WithQueueSize(size int) Option {
+	return func(s *Subscription) {
+		if size > 0 {
+			s.queueSize = size
+		}
+	}
+}
+
+// Subscription 订阅者，事件按顺序键分配到固定的协程处理，保证顺序键相同的事件按顺序处理
+type Subscription struct {
+	name      string
+	handler   Handler
+	types     map[Type]bool // 为空时订阅所有类型
+	areaID    uint64        // 为0时订阅所有家庭
+	queueSize int
+
+	queues  []chan Event
+	done    chan struct{}
+	wg      sync.WaitGroup
+	dropped uint64
+}
+
+// match 是否订阅了该事件
+func (s *Subscription) match(e Event) bool {
+	if len(s.types) != 0 && !s.types[e.Type()] {
+		return false
+	}
+	return s.areaID == 0 || s.areaID == e.Area()
+}
+
+// deliver 将事件加入待处理队列，不阻塞发布者，队列已满时丢弃事件
+func (s *Subscription) deliver(e Event) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.Key()))
+	queue := s.queues[h.Sum32()%uint32(len(s.queues))]
+
+	select {
+	case <-s.done:
+	case queue <- e:
+	default:
+		// 只记录第一次及每100次丢弃，避免日志过多
+		if n := atomic.AddUint64(&s.dropped, 1); n == 1 || n%100 == 0 {
+			logger.Warnf("event subscriber %s is too slow, %d events dropped", s.name, n)
+		}
+	}
+}
+
+// Dropped 队列已满丢弃的事件数
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) run(queue chan Event) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case e := <-queue:
+			s.handle(e)
+		}
+	}
+}
+
+func (s *Subscription) handle(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("event subscriber %s panic: %v", s.name, r)
+		}
+	}()
+	if err := s.handler(e); err != nil {
+		logger.Errorf("event subscriber %s handle %s err: %v", s.name, e.Type(), err)
+	}
+}
+
+// Bus 事件总线
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe 订阅事件，name 用于日志
+func (b *Bus) Subscribe(name string, handler Handler, opts ...Option) *Subscription {
+	s := &Subscription{
+		name:      name,
+		handler:   handler,
+		types:     make(map[Type]bool),
+		queueSize: defaultQueueSize,
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.queues = make([]chan Event, defaultWorkers)
+	for i := range s.queues {
+		s.queues[i] = make(chan Event, s.queueSize)
+		s.wg.Add(1)
+		go s.run(s.queues[i])
+	}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Unsubscribe 取消订阅，未处理的事件被丢弃
+func (b *Bus) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	_, ok := b.subs[s]
+	delete(b.subs, s)
+	b.mu.Unlock()
+
+	if ok {
+		close(s.done)
+		s.wg.Wait()
+	}
+}
+
+// Publish 发布事件，只将事件加入订阅者的队列，不等待处理完成
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if s.match(e) {
+			s.deliver(e)
+		}
+	}
+}
+
+var (
+	globalBus     *Bus
+	globalBusOnce sync.Once
+)
+
+// GetBus 获取全局的事件总线
+func GetBus() *Bus {
+	globalBusOnce.Do(func() {
+		globalBus = NewBus()
+	})
+	return globalBus
+}
+
+// Publish 向全局的事件总线发布事件
+func Publish(e Event) {
+	GetBus().Publish(e)
+}
@@ -0,0 +1,108 @@
+package event
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+)
+
+func stateChanged(areaID uint64, deviceID int, val int) DeviceStateChanged {
+	e := DeviceStateChanged{Device: entity.Device{ID: deviceID, AreaID: areaID}}
+	e.Attr.Val = val
+	return e
+}
+
+func TestBusOrderPerDevice(t *testing.T) {
+	bus := NewBus()
+	var (
+		mu   sync.Mutex
+		vals = make(map[int][]int)
+		wg   sync.WaitGroup
+	)
+	wg.Add(200)
+	sub := bus.Subscribe("order", DeviceStateHandler(func(d entity.Device, attr entity.Attribute) error {
+		defer wg.Done()
+		mu.Lock()
+		vals[d.ID] = append(vals[d.ID], attr.Val.(int))
+		mu.Unlock()
+		return nil
+	}))
+	defer bus.Unsubscribe(sub)
+
+	for i := 0; i < 100; i++ {
+		bus.Publish(stateChanged(1, 1, i))
+		bus.Publish(stateChanged(1, 2, i))
+	}
+	wg.Wait()
+
+	for _, deviceID := range []int{1, 2} {
+		for i, v := range vals[deviceID] {
+			assert.Equal(t, i, v, "同一设备的事件按发布顺序处理")
+		}
+	}
+}
+
+func TestBusFilter(t *testing.T) {
+	bus := NewBus()
+	received := make(chan Event, 10)
+	sub := bus.Subscribe("filter", func(e Event) error {
+		received <- e
+		return nil
+	}, WithTypes(TypeDeviceAdded), WithArea(1))
+	defer bus.Unsubscribe(sub)
+
+	bus.Publish(stateChanged(1, 1, 0))
+	bus.Publish(DeviceAdded{Device: entity.Device{ID: 1, AreaID: 2}})
+	bus.Publish(DeviceAdded{Device: entity.Device{ID: 2, AreaID: 1}})
+
+	select {
+	case e := <-received:
+		assert.Equal(t, 2, e.(DeviceAdded).Device.ID)
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+	assert.Len(t, received, 0)
+}
+
+func TestBusSlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	started := make(chan struct{}, 1)
+	block := make(chan struct{})
+	slow := bus.Subscribe("slow", func(e Event) error {
+		started <- struct{}{}
+		<-block
+		return nil
+	}, WithQueueSize(1))
+	defer bus.Unsubscribe(slow)
+
+	fast := make(chan Event, 100)
+	sub := bus.Subscribe("fast", func(e Event) error {
+		fast <- e
+		return nil
+	})
+	defer bus.Unsubscribe(sub)
+
+	bus.Publish(stateChanged(1, 1, 0))
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		for i := 1; i < 10; i++ {
+			bus.Publish(stateChanged(1, 1, i))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked by slow subscriber")
+	}
+	assert.Eventually(t, func() bool { return len(fast) == 10 }, time.Second, 10*time.Millisecond)
+	// 处理中1个，队列中1个，其余丢弃
+	assert.Equal(t, uint64(8), slow.Dropped())
+	close(block)
+	<-started
+}
@@ -0,0 +1,99 @@
+// Package event 模块间的事件总线，各模块发布事件并订阅其他模块的事件，
+// 每个订阅者独立处理事件，处理慢的订阅者不会阻塞发布者及其他订阅者
+package event
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+)
+
+// Type 事件类型
+type Type string
+
+const (
+	TypeDeviceStateChanged Type = "device_state_changed" // 设备上报属性状态
+	TypeDeviceAdded        Type = "device_added"         // 添加设备
+	TypeDeviceRemoved      Type = "device_removed"       // 删除设备
+	TypeSceneExecuted      Type = "scene_executed"       // 场景开始执行
+	TypePluginInstalled    Type = "plugin_installed"     // 安装或更新插件
+	TypeUserJoined         Type = "user_joined"          // 用户加入家庭
+)
+
+// Event 事件
+type Event interface {
+	Type() Type
+	// Area 事件所属的家庭
+	Area() uint64
+	// Key 顺序键，同一订阅者按发布的顺序处理顺序键相同的事件，如同一设备的事件
+	Key() string
+}
+
+func deviceKey(deviceID int) string {
+	return "device:" + strconv.Itoa(deviceID)
+}
+
+// DeviceStateChanged 设备上报属性状态
+type DeviceStateChanged struct {
+	Device entity.Device
+	Attr   entity.Attribute
+	// Previous 上报前设备影子中的值，第一次上报时为 nil
+	Previous interface{}
+	// Changed 上报的值是否与设备影子中的值不同，设备会定期重复上报未变化的状态
+	Changed bool
+}
+
+func (e DeviceStateChanged) Type() Type   { return TypeDeviceStateChanged }
+func (e DeviceStateChanged) Area() uint64 { return e.Device.AreaID }
+func (e DeviceStateChanged) Key() string  { return deviceKey(e.Device.ID) }
+
+// DeviceAdded 添加设备
+type DeviceAdded struct {
+	Device entity.Device
+}
+
+func (e DeviceAdded) Type() Type   { return TypeDeviceAdded }
+func (e DeviceAdded) Area() uint64 { return e.Device.AreaID }
+func (e DeviceAdded) Key() string  { return deviceKey(e.Device.ID) }
+
+// DeviceRemoved 删除设备
+type DeviceRemoved struct {
+	Device entity.Device
+}
+
+func (e DeviceRemoved) Type() Type   { return TypeDeviceRemoved }
+func (e DeviceRemoved) Area() uint64 { return e.Device.AreaID }
+func (e DeviceRemoved) Key() string  { return deviceKey(e.Device.ID) }
+
+// SceneExecuted 场景开始执行
+type SceneExecuted struct {
+	Scene  entity.Scene
+	TaskID string // 本次执行的任务id
+	Time   time.Time
+}
+
+func (e SceneExecuted) Type() Type   { return TypeSceneExecuted }
+func (e SceneExecuted) Area() uint64 { return e.Scene.AreaID }
+func (e SceneExecuted) Key() string  { return "scene:" + strconv.Itoa(e.Scene.ID) }
+
+// PluginInstalled 安装或更新插件
+type PluginInstalled struct {
+	AreaID   uint64
+	PluginID string
+	Version  string
+}
+
+func (e PluginInstalled) Type() Type   { return TypePluginInstalled }
+func (e PluginInstalled) Area() uint64 { return e.AreaID }
+func (e PluginInstalled) Key() string  { return "plugin:" + e.PluginID }
+
+// UserJoined 用户加入家庭
+type UserJoined struct {
+	AreaID uint64
+	UserID int
+}
+
+func (e UserJoined) Type() Type   { return TypeUserJoined }
+func (e UserJoined) Area() uint64 { return e.AreaID }
+func (e UserJoined) Key() string  { return "user:" + strconv.Itoa(e.UserID) }
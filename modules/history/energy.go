@@ -0,0 +1,38 @@
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/plugin"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+const (
+	energyMeterInstance = "energy_meter" // 电量计量实例的类型
+	energyAttribute     = "energy"       // 累计用电量属性
+)
+
+// energyMu 串行记录用电量，避免同一实例的并发上报重复计算差值
+var energyMu sync.Mutex
+
+// RecordEnergy 设备状态改变回调，记录电量计量实例上报的累计用电量
+func RecordEnergy(d entity.Device, attr entity.Attribute) error {
+	if attr.Attribute.Attribute != energyAttribute {
+		return nil
+	}
+	instanceType, err := plugin.GetInstanceType(d, attr.InstanceID)
+	if err != nil || instanceType != energyMeterInstance {
+		return err
+	}
+	reading, ok := attr.Val.(float64)
+	if !ok {
+		logger.Warnf("device %d invalid energy: %v", d.ID, attr.Val)
+		return nil
+	}
+
+	energyMu.Lock()
+	defer energyMu.Unlock()
+	return entity.AddEnergyReading(d, attr.InstanceID, reading, time.Now())
+}
@@ -0,0 +1,127 @@
+// Package history 记录设备上报的属性状态历史及用电量，并定期清理过期的状态历史
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/now"
+	"github.com/zhiting-tech/smartassistant/modules/config"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+const (
+	flushInterval = 5 * time.Second // 批量保存状态历史的间隔，减少对存储的写入次数
+	pendingLimit  = 10000           // 未保存的记录数上限，超出时丢弃最早的记录
+	cleanHour     = 4               // 每天清理状态历史的时间
+)
+
+// stateKey 设备属性
+type stateKey struct {
+	deviceID   int
+	instanceID int
+	attribute  string
+}
+
+// Recorder 记录设备上报的属性状态，值未变化的上报不重复记录
+type Recorder struct {
+	mu      sync.Mutex
+	pending []entity.DeviceStateLog
+	last    map[stateKey]string // 各属性最近一次记录的值
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		last: make(map[stateKey]string),
+	}
+}
+
+// OnDeviceStateChange 设备状态改变回调，记录变化后的属性值
+func (r *Recorder) OnDeviceStateChange(d entity.Device, attr entity.Attribute) error {
+	if config.GetConf().DeviceHistory.Disabled {
+		return nil
+	}
+	log, err := entity.NewDeviceStateLog(d, attr, time.Now())
+	if err != nil {
+		return err
+	}
+	r.add(log)
+	return nil
+}
+
+// add 添加未保存的记录，返回是否添加
+func (r *Recorder) add(log entity.DeviceStateLog) bool {
+	key := stateKey{deviceID: log.DeviceID, instanceID: log.InstanceID, attribute: log.Attribute}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.last[key]; ok && last == log.Val {
+		return false
+	}
+	r.last[key] = log.Val
+	if len(r.pending) >= pendingLimit {
+		logger.Warnf("too many pending device state logs, drop the oldest")
+		r.pending = r.pending[1:]
+	}
+	r.pending = append(r.pending, log)
+	return true
+}
+
+// flush 保存所有未保存的记录
+func (r *Recorder) flush() {
+	r.mu.Lock()
+	logs := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	if err := entity.CreateDeviceStateLogs(logs); err != nil {
+		logger.Errorf("create device state logs err: %v", err)
+	}
+}
+
+// Run 定时保存状态历史，每天清理一次过期的记录
+func (r *Recorder) Run(ctx context.Context) {
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+	cleanTimer := time.NewTimer(time.Until(nextCleanTime(time.Now())))
+	defer cleanTimer.Stop()
+
+	for {
+		select {
+		case <-flushTicker.C:
+			r.flush()
+		case t := <-cleanTimer.C:
+			clean(t)
+			cleanTimer.Reset(time.Until(nextCleanTime(time.Now())))
+		case <-ctx.Done():
+			r.flush()
+			logger.Info("device state recorder stopped")
+			return
+		}
+	}
+}
+
+// nextCleanTime 获取 t 之后下一次清理状态历史的时间
+func nextCleanTime(t time.Time) time.Time {
+	next := now.New(t).BeginningOfDay().Add(cleanHour * time.Hour)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// clean 按配置的保留天数和数量清理状态历史
+func clean(t time.Time) {
+	conf := config.GetConf().DeviceHistory
+	var before time.Time
+	if days := conf.GetRetentionDays(); days > 0 {
+		before = t.AddDate(0, 0, -days)
+	}
+	count, err := entity.CleanDeviceStateLogs(before, conf.GetMaxCount())
+	if err != nil {
+		logger.Errorf("clean device state logs err: %v", err)
+	}
+	logger.Infof("%d device state logs cleaned", count)
+}
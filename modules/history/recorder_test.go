@@ -0,0 +1,22 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+)
+
+func TestRecorderAdd(t *testing.T) {
+	r := NewRecorder()
+	log := entity.DeviceStateLog{DeviceID: 1, InstanceID: 1, Attribute: "power", Val: `"on"`}
+	assert.True(t, r.add(log))
+	// 值未变化不重复记录
+	assert.False(t, r.add(log))
+
+	log.Val = `"off"`
+	assert.True(t, r.add(log))
+	log.InstanceID = 2
+	assert.True(t, r.add(log))
+	assert.Len(t, r.pending, 3)
+}
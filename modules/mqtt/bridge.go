@@ -0,0 +1,216 @@
+// Package mqtt MQTT 桥接，将设备上报的属性状态发布到 MQTT 服务器，
+// 并订阅设置属性的主题，以服务用户的权限通过插件设置设备属性
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	errors2 "errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zhiting-tech/smartassistant/modules/config"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/plugin"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+	"gorm.io/gorm"
+)
+
+// errInvalidTopicLevel 设备 identity 或属性名不能作为主题的一级
+var errInvalidTopicLevel = errors2.New("invalid mqtt topic level")
+
+const (
+	setSuffix    = "set"
+	setQueueSize = 256 // 待处理的设置属性消息数上限，超出时丢弃消息
+)
+
+// message 收到的设置属性消息
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// setTarget 设置属性主题对应的设备属性
+type setTarget struct {
+	areaID     uint64
+	identity   string
+	instanceID int
+	attribute  string
+}
+
+// Bridge 设备属性状态与 MQTT 的桥接，
+// 属性主题为 <前缀>/<家庭id>/<设备identity>/<实例id>/<属性>，设置属性的主题为 <属性主题>/set
+type Bridge struct {
+	conf   config.MQTT
+	client Client
+	// sets 设置属性的消息按收到的顺序处理，避免阻塞 MQTT 客户端接收消息
+	sets chan message
+
+	// setAttributes 通过插件设置设备属性
+	setAttributes func(areaID uint64, pluginID, identity string, data json.RawMessage) error
+}
+
+func NewBridge(conf config.MQTT, client Client) *Bridge {
+	return &Bridge{
+		conf:          conf,
+		client:        client,
+		sets:          make(chan message, setQueueSize),
+		setAttributes: plugin.SetAttributes,
+	}
+}
+
+// Run 连接 MQTT 服务器并处理设置属性的消息，直到 ctx 取消
+func (b *Bridge) Run(ctx context.Context) {
+	if err := b.client.Connect(ctx, b.onConnect); err != nil {
+		logger.Errorf("mqtt connect to %s err: %v", b.conf.Broker, err)
+		return
+	}
+	defer b.client.Disconnect()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-b.sets:
+			if err := b.handleSet(m); err != nil {
+				logger.Warnf("mqtt set %s err: %v", m.topic, err)
+			}
+		}
+	}
+}
+
+// onConnect 每次连接成功后重新订阅设置属性的主题，未配置服务用户时不订阅
+func (b *Bridge) onConnect() {
+	if b.conf.ServiceUserID == 0 {
+		return
+	}
+	filter := b.conf.GetTopicPrefix() + "/+/+/+/+/" + setSuffix
+	if err := b.client.Subscribe(filter, b.conf.GetQoS(), b.onSetMessage); err != nil {
+		logger.Errorf("mqtt subscribe %s err: %v", filter, err)
+	}
+}
+
+func (b *Bridge) onSetMessage(topic string, payload []byte) {
+	select {
+	case b.sets <- message{topic: topic, payload: payload}:
+	default:
+		logger.Warnf("too many pending mqtt set messages, drop %s", topic)
+	}
+}
+
+// OnDeviceStateChange 设备状态改变回调，将属性值以 JSON 发布到属性主题，未连接时不发布
+func (b *Bridge) OnDeviceStateChange(d entity.Device, attr entity.Attribute) error {
+	if !b.client.IsConnected() {
+		return nil
+	}
+	topic, err := b.stateTopic(d, attr)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(attr.Val)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(topic, b.conf.GetQoS(), b.conf.Retain, payload)
+}
+
+// stateTopic 设备属性的主题，identity 或属性名包含主题分隔符或通配符时返回错误，避免改变主题的层级
+func (b *Bridge) stateTopic(d entity.Device, attr entity.Attribute) (topic string, err error) {
+	if !isTopicLevel(d.Identity) || !isTopicLevel(attr.Attribute.Attribute) {
+		err = fmt.Errorf("%w: %s/%s", errInvalidTopicLevel, d.Identity, attr.Attribute.Attribute)
+		return
+	}
+	topic = strings.Join([]string{
+		b.conf.GetTopicPrefix(),
+		strconv.FormatUint(d.AreaID, 10),
+		d.Identity,
+		strconv.Itoa(attr.InstanceID),
+		attr.Attribute.Attribute,
+	}, "/")
+	return
+}
+
+// isTopicLevel 是否可以作为主题的一级，不能为空或包含 /、+、#
+func isTopicLevel(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "/+#")
+}
+
+// parseSetTopic 解析设置属性的主题
+func (b *Bridge) parseSetTopic(topic string) (t setTarget, err error) {
+	prefix := b.conf.GetTopicPrefix() + "/"
+	if !strings.HasPrefix(topic, prefix) {
+		err = errors.New(errors.BadRequest)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(topic, prefix), "/")
+	if len(parts) != 5 || parts[4] != setSuffix || parts[1] == "" || parts[3] == "" {
+		err = errors.New(errors.BadRequest)
+		return
+	}
+	if t.areaID, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+	if t.instanceID, err = strconv.Atoi(parts[2]); err != nil {
+		err = errors.Wrap(err, errors.BadRequest)
+		return
+	}
+	t.identity = parts[1]
+	t.attribute = parts[3]
+	return
+}
+
+// handleSet 以服务用户的权限设置设备属性，服务用户需要属于设备所在的家庭并有该属性的控制权限；
+// 消息内容为属性值的 JSON，不是 JSON 时作为字符串
+func (b *Bridge) handleSet(m message) (err error) {
+	t, err := b.parseSetTopic(m.topic)
+	if err != nil {
+		return
+	}
+	var val interface{}
+	if err = json.Unmarshal(m.payload, &val); err != nil {
+		val = string(m.payload)
+	}
+
+	d, err := entity.GetAreaDevice(t.areaID, t.identity)
+	if err != nil {
+		if errors2.Is(err, gorm.ErrRecordNotFound) {
+			err = errors.Wrap(err, status.DeviceNotExist)
+		}
+		return
+	}
+	attr := entity.Attribute{
+		Attribute:  server.Attribute{Attribute: t.attribute, Val: val},
+		InstanceID: t.instanceID,
+	}
+	if err = d.CheckControlAttr(attr); err != nil {
+		return
+	}
+
+	user, err := entity.GetUserByID(b.conf.ServiceUserID)
+	if err != nil {
+		return
+	}
+	if user.AreaID != d.AreaID {
+		return errors.New(status.Deny)
+	}
+	up, err := entity.GetUserPermissions(user.ID)
+	if err != nil {
+		return
+	}
+	if !up.IsDeviceAttrControlPermit(d.ID, t.instanceID, t.attribute) {
+		return errors.New(status.Deny)
+	}
+
+	data, err := json.Marshal(server.SetRequest{Attributes: []server.SetAttribute{
+		{InstanceID: t.instanceID, Attribute: t.attribute, Val: val},
+	}})
+	if err != nil {
+		return
+	}
+	return b.setAttributes(d.AreaID, d.PluginID, d.Identity, data)
+}
@@ -0,0 +1,227 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/modules/config"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+)
+
+func TestMain(m *testing.M) {
+	config.TestSetup()
+	code := m.Run()
+	config.TestTeardown()
+	os.Exit(code)
+}
+
+// fakeBroker 本地的模拟 MQTT 服务器
+type fakeBroker struct {
+	mu       sync.Mutex
+	retained map[string][]byte
+	subs     map[string]func(topic string, payload []byte)
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		retained: make(map[string][]byte),
+		subs:     make(map[string]func(topic string, payload []byte)),
+	}
+}
+
+func (f *fakeBroker) Connect(ctx context.Context, onConnect func()) error {
+	onConnect()
+	return nil
+}
+
+func (f *fakeBroker) IsConnected() bool {
+	return true
+}
+
+func (f *fakeBroker) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	f.mu.Lock()
+	if retained {
+		f.retained[topic] = payload
+	}
+	var handlers []func(topic string, payload []byte)
+	for filter, h := range f.subs {
+		if topicMatch(filter, topic) {
+			handlers = append(handlers, h)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, h := range handlers {
+		h(topic, payload)
+	}
+	return nil
+}
+
+func (f *fakeBroker) Subscribe(filter string, qos byte, handler func(topic string, payload []byte)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subs[filter] = handler
+	return nil
+}
+
+func (f *fakeBroker) Disconnect() {}
+
+// topicMatch 主题是否匹配订阅，支持 + 及 # 通配符
+func topicMatch(filter, topic string) bool {
+	fs, ts := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+type setCall struct {
+	areaID   uint64
+	pluginID string
+	identity string
+	req      server.SetRequest
+}
+
+func newTestBridge(t *testing.T, serviceUserID int) (*Bridge, *fakeBroker, chan setCall) {
+	broker := newFakeBroker()
+	b := NewBridge(config.MQTT{Retain: true, ServiceUserID: serviceUserID}, broker)
+	calls := make(chan setCall, 10)
+	b.setAttributes = func(areaID uint64, pluginID, identity string, data json.RawMessage) error {
+		c := setCall{areaID: areaID, pluginID: pluginID, identity: identity}
+		assert.NoError(t, json.Unmarshal(data, &c.req))
+		calls <- c
+		return nil
+	}
+	return b, broker, calls
+}
+
+func createTestUser(t *testing.T, areaID uint64) entity.User {
+	user := entity.User{AreaID: areaID}
+	assert.NoError(t, entity.CreateUser(&user, entity.GetDB()))
+	return user
+}
+
+func TestOnDeviceStateChange(t *testing.T) {
+	b, broker, _ := newTestBridge(t, 0)
+	d := entity.Device{AreaID: 1, Identity: "0x0001"}
+	attr := entity.Attribute{Attribute: server.Attribute{Attribute: "power", Val: "on"}, InstanceID: 1}
+	assert.NoError(t, b.OnDeviceStateChange(d, attr))
+	assert.Equal(t, `"on"`, string(broker.retained["sa/1/0x0001/1/power"]))
+
+	attr.Attribute.Attribute, attr.Val = "brightness", 50
+	assert.NoError(t, b.OnDeviceStateChange(d, attr))
+	assert.Equal(t, "50", string(broker.retained["sa/1/0x0001/1/brightness"]))
+
+	for _, identity := range []string{"a/b", "a+", "#", ""} {
+		d.Identity = identity
+		assert.ErrorIs(t, b.OnDeviceStateChange(d, attr), errInvalidTopicLevel, identity)
+	}
+	assert.Len(t, broker.retained, 2)
+}
+
+func TestParseSetTopic(t *testing.T) {
+	b := NewBridge(config.MQTT{TopicPrefix: "home/sa"}, newFakeBroker())
+	target, err := b.parseSetTopic("home/sa/1/0x0001/2/power/set")
+	assert.NoError(t, err)
+	assert.Equal(t, setTarget{areaID: 1, identity: "0x0001", instanceID: 2, attribute: "power"}, target)
+
+	for _, topic := range []string{
+		"sa/1/0x0001/2/power/set",
+		"home/sa/1/0x0001/2/power",
+		"home/sa/x/0x0001/2/power/set",
+		"home/sa/1/0x0001/x/power/set",
+		"home/sa/1/0x0001/2/power/set/x",
+	} {
+		_, err = b.parseSetTopic(topic)
+		assert.Error(t, err, topic)
+	}
+}
+
+func TestSetAttributes(t *testing.T) {
+	area, err := entity.CreateArea("mqtt")
+	assert.NoError(t, err)
+	owner := createTestUser(t, area.ID)
+	assert.NoError(t, entity.SetAreaOwnerID(area.ID, owner.ID, entity.GetDB()))
+	member := createTestUser(t, area.ID)
+
+	// 测试数据库不会清理，设备使用不重复的 identity
+	identity := fmt.Sprintf("0x%x", area.ID)
+	d := entity.Device{AreaID: area.ID, Identity: identity, PluginID: "demo", Name: "light",
+		ThingModel: []byte(`{"instances":[{"type":"light_bulb","instance_id":1,"attributes":[
+{"attribute":"power","val_type":"string"},
+{"attribute":"brightness","val_type":"int","min":1,"max":100},
+{"attribute":"rssi","val_type":"int","read_only":true}]}]}`)}
+	assert.NoError(t, entity.AddDevice(&d, entity.GetDB()))
+
+	// 服务用户有控制权限时，经由插件设置属性
+	b, broker, calls := newTestBridge(t, owner.ID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+	assert.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		return len(broker.subs) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	topic := func(attr string) string {
+		return fmt.Sprintf("sa/%d/%s/1/%s/set", area.ID, identity, attr)
+	}
+	assert.NoError(t, broker.Publish(topic("brightness"), 0, false, []byte("80")))
+	select {
+	case c := <-calls:
+		assert.Equal(t, area.ID, c.areaID)
+		assert.Equal(t, "demo", c.pluginID)
+		assert.Equal(t, identity, c.identity)
+		assert.Equal(t, []server.SetAttribute{{InstanceID: 1, Attribute: "brightness", Val: float64(80)}}, c.req.Attributes)
+	case <-time.After(time.Second):
+		t.Fatal("set attributes not called")
+	}
+
+	// 非 JSON 的值作为字符串
+	assert.NoError(t, broker.Publish(topic("power"), 0, false, []byte("on")))
+	select {
+	case c := <-calls:
+		assert.Equal(t, "on", c.req.Attributes[0].Val)
+	case <-time.After(time.Second):
+		t.Fatal("set attributes not called")
+	}
+
+	code := func(err error) int {
+		if e, ok := err.(errors.Error); ok {
+			return e.Code.Status
+		}
+		return 0
+	}
+	set := func(b *Bridge, topic, payload string) error {
+		return b.handleSet(message{topic: topic, payload: []byte(payload)})
+	}
+	assert.Equal(t, status.DeviceAttrValIncorrect, code(set(b, topic("brightness"), "101")))
+	assert.Equal(t, status.DeviceAttrReadOnly, code(set(b, topic("rssi"), "1")))
+	assert.Equal(t, status.DeviceNotExist, code(set(b, fmt.Sprintf("sa/%d/unknown/1/power/set", area.ID), `"on"`)))
+
+	// 服务用户没有控制权限
+	b2, _, _ := newTestBridge(t, member.ID)
+	assert.Equal(t, status.Deny, code(set(b2, topic("power"), `"on"`)))
+
+	// 服务用户不属于设备所在的家庭
+	other, err := entity.CreateArea("other")
+	assert.NoError(t, err)
+	b3, _, _ := newTestBridge(t, createTestUser(t, other.ID).ID)
+	assert.Equal(t, status.Deny, code(set(b3, topic("power"), `"on"`)))
+}
@@ -0,0 +1,120 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/zhiting-tech/smartassistant/modules/config"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+const (
+	waitTimeout    = 5 * time.Second  // 等待发布、订阅完成的时间
+	retryInterval  = 10 * time.Second // 连接失败后重试的间隔
+	disconnectWait = 250              // 断开连接时等待未完成工作的毫秒数
+)
+
+var (
+	errTimeout      = errors.New("mqtt operation timeout")
+	errNotConnected = errors.New("mqtt client not connected")
+)
+
+// Client MQTT 客户端，测试时可替换为本地的模拟服务器
+type Client interface {
+	// Connect 连接服务器，连接断开后自动重连，每次连接成功后调用 onConnect
+	Connect(ctx context.Context, onConnect func()) error
+	IsConnected() bool
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+	// Subscribe 订阅主题，filter 可以包含通配符
+	Subscribe(filter string, qos byte, handler func(topic string, payload []byte)) error
+	Disconnect()
+}
+
+// pahoClient 基于 paho 的 MQTT 客户端，连接在 Bridge.Run 的协程中建立，
+// 发布在事件总线的协程中进行，client 需要加锁访问
+type pahoClient struct {
+	conf   config.MQTT
+	mu     sync.RWMutex
+	client paho.Client
+}
+
+func NewClient(conf config.MQTT) Client {
+	return &pahoClient{conf: conf}
+}
+
+func (c *pahoClient) Connect(ctx context.Context, onConnect func()) error {
+	opts := paho.NewClientOptions().
+		AddBroker(c.conf.Broker).
+		SetClientID(c.conf.GetClientID()).
+		SetUsername(c.conf.Username).
+		SetPassword(c.conf.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(retryInterval).
+		SetOnConnectHandler(func(paho.Client) {
+			logger.Infof("mqtt connected to %s", c.conf.Broker)
+			onConnect()
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Warnf("mqtt connection lost: %v", err)
+		})
+	client := paho.NewClient(opts)
+	c.mu.Lock()
+	c.client = client
+	c.mu.Unlock()
+
+	// 服务器不可用时会一直重试，直到连接成功或 ctx 取消
+	token := client.Connect()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		client.Disconnect(0)
+		return ctx.Err()
+	}
+}
+
+func (c *pahoClient) getClient() paho.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+func (c *pahoClient) IsConnected() bool {
+	client := c.getClient()
+	return client != nil && client.IsConnected()
+}
+
+func (c *pahoClient) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	client := c.getClient()
+	if client == nil {
+		return errNotConnected
+	}
+	return wait(client.Publish(topic, qos, retained, payload))
+}
+
+func (c *pahoClient) Subscribe(filter string, qos byte, handler func(topic string, payload []byte)) error {
+	client := c.getClient()
+	if client == nil {
+		return errNotConnected
+	}
+	return wait(client.Subscribe(filter, qos, func(_ paho.Client, m paho.Message) {
+		handler(m.Topic(), m.Payload())
+	}))
+}
+
+func (c *pahoClient) Disconnect() {
+	if client := c.getClient(); client != nil {
+		client.Disconnect(disconnectWait)
+	}
+}
+
+func wait(token paho.Token) error {
+	if !token.WaitTimeout(waitTimeout) {
+		return errTimeout
+	}
+	return token.Error()
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/event"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
 	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/proto"
 	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
@@ -33,8 +34,7 @@ type client struct {
 	mu      sync.Mutex // clients 锁
 	clients map[string]*pluginClient
 
-	devicesCancel        sync.Map
-	stateChangeCallbacks []OnDeviceStateChange
+	devicesCancel sync.Map
 }
 
 func (c *client) DeviceConfigs() (configs []DeviceConfig) {
@@ -97,10 +97,10 @@ func (c *client) Disconnect(identity, pluginID string, authParams map[string]str
 	return nil
 }
 
-func NewClient(callbacks ...OnDeviceStateChange) *client {
+// NewClient 新建插件客户端，设备上报的状态通过事件总线发布
+func NewClient() *client {
 	return &client{
-		clients:              make(map[string]*pluginClient),
-		stateChangeCallbacks: callbacks,
+		clients: make(map[string]*pluginClient),
 	}
 }
 
@@ -199,29 +199,34 @@ func (c *client) ListenStateChange(pluginID string) {
 			continue
 		}
 
-		for _, callback := range c.stateChangeCallbacks {
-			a := entity.Attribute{
-				Attribute:  attr,
-				InstanceID: int(resp.InstanceId),
-			}
-			go func(cb OnDeviceStateChange) {
-				if err := cb(d, a); err != nil {
-					logger.Errorf("state change callback err: %s", err.Error())
-				}
-			}(callback)
+		a := entity.Attribute{
+			Attribute:  attr,
+			InstanceID: int(resp.InstanceId),
+		}
+		// 先同步更新设备影子再发布事件，事件的订阅者可能丢弃事件，但影子不能丢失更新，
+		// 订阅者处理事件时也能从影子获取到最新值及变化前的值
+		previous, changed, err := UpdateShadowReported(d, a)
+		if err != nil {
+			logger.Errorf("update device %d shadow err: %v", d.ID, err)
 		}
+		event.Publish(event.DeviceStateChanged{Device: d, Attr: a, Previous: previous, Changed: changed})
 	}
 	logger.Println("StateChangeFromPlugin exit")
 }
 
 func (c *client) SetAttributes(d entity.Device, data json.RawMessage) (result []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return c.SetAttributesContext(ctx, d, data)
+}
+
+// SetAttributesContext 设置设备属性，超时及取消由 ctx 控制
+func (c *client) SetAttributesContext(ctx context.Context, d entity.Device, data json.RawMessage) (result []byte, err error) {
 	req := proto.SetAttributesReq{
 		Identity: d.Identity,
 		Data:     data,
 	}
 	logger.Debug("set attributes: ", string(data))
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
 	cli, err := c.get(d.PluginID)
 	if err != nil {
 		return
@@ -1,18 +1,23 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	plugin2 "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
 	"net/http"
+	"sync"
 
 	"github.com/zhiting-tech/smartassistant/modules/config"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/event"
 	"github.com/zhiting-tech/smartassistant/modules/types"
 	"github.com/zhiting-tech/smartassistant/modules/types/status"
 	"github.com/zhiting-tech/smartassistant/modules/utils/url"
 	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 	"gorm.io/gorm"
 )
 
@@ -50,9 +55,15 @@ func RemoveDevice(deviceID int) (err error) {
 	if err = entity.DelDeviceByID(deviceID); err != nil {
 		return errors.Wrap(err, errors.InternalServerErr)
 	}
+	event.Publish(event.DeviceRemoved{Device: d})
 	return
 }
 
+// GetShadow 获取设备影子
+func GetShadow(d entity.Device) (shadow entity.Shadow, err error) {
+	return getShadow(d)
+}
+
 func getShadow(d entity.Device) (shadow entity.Shadow, err error) {
 	// 从设备影子中获取属性
 	if err = json.Unmarshal(d.Shadow, &shadow); err != nil {
@@ -68,37 +79,92 @@ func getThingModel(d entity.Device) (thingModel DeviceAttributes, err error) {
 	return
 }
 
-// UpdateShadowReported 更新设备影子属性报告值
-func UpdateShadowReported(d entity.Device, attr entity.Attribute) (err error) {
+// GetInstanceType 获取设备实例的类型，实例不存在时返回空字符串
+func GetInstanceType(d entity.Device, instanceID int) (string, error) {
+	thingModel, err := getThingModel(d)
+	if err != nil {
+		return "", err
+	}
+	for _, instance := range thingModel.Instances {
+		if instance.InstanceId == instanceID {
+			return instance.Type, nil
+		}
+	}
+	return "", nil
+}
+
+// shadowMu 串行更新设备影子，避免同一设备的并发更新相互覆盖
+var shadowMu sync.Mutex
+
+// UpdateShadowReported 更新设备影子属性报告值，返回更新前的报告值及报告值是否变化
+func UpdateShadowReported(d entity.Device, attr entity.Attribute) (previous interface{}, changed bool, err error) {
+	shadowMu.Lock()
+	defer shadowMu.Unlock()
+
+	// 重新获取设备，保证基于最新的影子更新
+	if d, err = entity.GetDeviceByID(d.ID); err != nil {
+		return
+	}
 	// 从设备影子中获取属性
 	shadow, err := getShadow(d)
 	if err != nil {
 		return
 	}
-	shadow.UpdateReported(attr.InstanceID, attr.Attribute)
+	previous, changed = shadow.UpdateReported(attr.InstanceID, attr.Attribute)
 	d.Shadow, err = json.Marshal(shadow)
 	if err != nil {
 		return
 	}
-	return entity.GetDB().Save(d).Error
+	err = entity.GetDB().Save(d).Error
+	return
 }
 
 // SetAttributes 通过插件设置设备的属性
 func SetAttributes(areaID uint64, pluginID, identity string, data json.RawMessage) (err error) {
-	d, err := entity.GetPluginDevice(areaID, pluginID, identity)
+	d, err := getSetAttributesDevice(areaID, pluginID, identity)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			d = entity.Device{Identity: identity, PluginID: "homekit"}
-			err = nil
-		} else {
-			return
-		}
+		return
 	}
 
 	_, err = GetGlobalClient().SetAttributes(d, data)
 	return
 }
 
+// SetAttributesContext 通过插件设置设备的属性，超时及取消由 ctx 控制
+func SetAttributesContext(ctx context.Context, areaID uint64, pluginID, identity string, data json.RawMessage) (err error) {
+	d, err := getSetAttributesDevice(areaID, pluginID, identity)
+	if err != nil {
+		return
+	}
+
+	_, err = GetGlobalClient().SetAttributesContext(ctx, d, data)
+	return
+}
+
+func getSetAttributesDevice(areaID uint64, pluginID, identity string) (d entity.Device, err error) {
+	d, err = entity.GetPluginDevice(areaID, pluginID, identity)
+	if err == gorm.ErrRecordNotFound {
+		return entity.Device{Identity: identity, PluginID: "homekit"}, nil
+	}
+	return
+}
+
+// IsTransientErr 判断设置设备属性的错误是否为临时错误（如插件暂时不可用、请求超时），可以重试
+func IsTransientErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	cause := errors.Cause(err)
+	if cause == context.DeadlineExceeded {
+		return true
+	}
+	switch grpcstatus.Code(cause) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
 // GetControlAttributeByID 获取设备属性（不包括设备型号、厂商等属性）
 func GetControlAttributeByID(d entity.Device, instanceID int, attr string) (attribute entity.Attribute, err error) {
 	as, err := GetControlAttributes(d)
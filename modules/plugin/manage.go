@@ -28,6 +28,8 @@ type Client interface {
 	DevicesDiscover(ctx context.Context) <-chan DiscoverResponse
 	GetAttributes(device entity.Device) (DeviceAttributes, error)
 	SetAttributes(device entity.Device, data json.RawMessage) (result []byte, err error)
+	// SetAttributesContext 设置设备属性，超时及取消由 ctx 控制
+	SetAttributesContext(ctx context.Context, device entity.Device, data json.RawMessage) (result []byte, err error)
 	HealthCheck(entity.Device) error
 	IsOnline(entity.Device) bool
 
@@ -65,7 +67,7 @@ func SetGlobalClient(c Client) {
 
 func GetGlobalClient() Client {
 	globalClientOnce.Do(func() {
-		globalClient = NewClient(DefaultOnDeviceStateChange)
+		globalClient = NewClient()
 	})
 	return globalClient
 }
@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/event"
 	"github.com/zhiting-tech/smartassistant/modules/plugin/docker"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
 	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
@@ -166,6 +167,7 @@ func (p Plugin) Install() (err error) {
 		logger.Errorf("UpdatePluginStatus err: %s", err.Error())
 		return
 	}
+	event.Publish(event.PluginInstalled{AreaID: p.AreaID, PluginID: p.ID, Version: p.Version})
 	return
 }
 
@@ -195,9 +197,16 @@ func (p Plugin) Remove() (err error) {
 		logger.Error(err.Error())
 	}
 
+	devices, err := entity.GetDevicesByPluginID(p.ID)
+	if err != nil {
+		return
+	}
 	if err = entity.DelDevicesByPlgID(p.ID); err != nil {
 		return
 	}
+	for _, d := range devices {
+		event.Publish(event.DeviceRemoved{Device: d})
+	}
 
 	if err = entity.DelPlugin(p.ID, p.AreaID); err != nil {
 		return
@@ -245,10 +254,6 @@ func GetInfoFromDeviceAttrs(pluginID string, das DeviceAttributes) (d entity.Dev
 
 type OnDeviceStateChange func(d entity.Device, attr entity.Attribute) error
 
-func DefaultOnDeviceStateChange(d entity.Device, attr entity.Attribute) error {
-	return errors2.New("OnDeviceStateChange not implement")
-}
-
 type DiscoverResponse struct {
 	Name         string `json:"name"`
 	Identity     string `json:"identity"`
@@ -0,0 +1,206 @@
+package task
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/plugin"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+// ConditionEnv 判断场景条件时的当前时间和设备状态，可替换用于模拟执行场景
+type ConditionEnv struct {
+	Now     time.Time
+	Shadows map[int]entity.Shadow  // 设备id -> 设备影子，未设置的设备从数据库获取
+	Payload map[string]interface{} // webhook 请求内容，用于模拟 webhook 触发
+}
+
+// currentEnv 使用当前时间和设备实际状态
+func currentEnv() ConditionEnv {
+	return ConditionEnv{Now: time.Now()}
+}
+
+// IsConditionsSatisfied 按当前时间和设备状态判断场景条件是否满足
+func IsConditionsSatisfied(scene entity.Scene, trigConditionIDs ...int) bool {
+	return currentEnv().IsConditionsSatisfied(scene, trigConditionIDs...)
+}
+
+// IsInTimePeriod 当前是否在场景的生效时间段内
+func IsInTimePeriod(scene entity.Scene) bool {
+	return currentEnv().IsInTimePeriod(scene)
+}
+
+// IsConditionSatisfied 按设备当前状态判断是否满足条件
+func IsConditionSatisfied(condition entity.SceneCondition) bool {
+	return currentEnv().IsConditionSatisfied(condition)
+}
+
+// getShadow 获取设备影子，优先使用设置的设备状态
+func (env ConditionEnv) getShadow(deviceID int) (shadow entity.Shadow, err error) {
+	if s, ok := env.Shadows[deviceID]; ok {
+		return s, nil
+	}
+	device, err := entity.GetDeviceByID(deviceID)
+	if err != nil {
+		return
+	}
+	return plugin.GetShadow(device)
+}
+
+// IsConditionsSatisfied 场景条件是否满足 trigConditionIDs 为触发场景的条件id（定时条件、设备状态变化条件或 webhook 条件）
+func (env ConditionEnv) IsConditionsSatisfied(scene entity.Scene, trigConditionIDs ...int) bool {
+	if !scene.IsOn {
+		logger.Debugf("scene %d: is off\n", scene.ID)
+		return false
+	}
+	if !env.IsInTimePeriod(scene) { // 不在有效时间段内则不执行
+		logger.Debugf("scene %d: not in effective time period\n", scene.ID)
+		return false
+	}
+	trig := make(map[int]bool)
+	for _, id := range trigConditionIDs {
+		trig[id] = true
+	}
+
+	tree, ok, err := scene.GetConditionTree()
+	if err != nil {
+		logger.Errorf("scene %d: get condition tree err: %v\n", scene.ID, err)
+		return false
+	}
+	if ok {
+		conditions := make(map[string]entity.SceneCondition)
+		for _, c := range scene.SceneConditions {
+			conditions[c.Key] = c
+		}
+		return env.isGroupSatisfied(tree, conditions, trig)
+	}
+
+	var isTrigByEvent bool
+	for _, condition := range scene.SceneConditions {
+		if condition.IsEventCondition() && trig[condition.ID] {
+			isTrigByEvent = true
+		}
+	}
+	// “任一满足”情况下，定时或 webhook 触发的任务直接满足条件
+	if !scene.IsMatchAllCondition() && isTrigByEvent {
+		return true
+	}
+	for _, condition := range scene.SceneConditions {
+		if condition.IsTimeCondition() {
+			continue
+		}
+
+		// 任一满足
+		if !scene.IsMatchAllCondition() && env.isSceneConditionSatisfied(condition, trig) {
+			logger.Debugf("scene %d: condition:%d satisfied\n", scene.ID, condition.ID)
+			return true
+		}
+		// 全部满足（有一个不满足）
+		if scene.IsMatchAllCondition() && !env.isSceneConditionSatisfied(condition, trig) {
+			logger.Debugf("scene %d: condition:%d not satisfied\n", scene.ID, condition.ID)
+			return false
+		}
+	}
+
+	logger.Debugf("scene.ID %d, scene.ConditionLogic %d \n", scene.ID, scene.ConditionLogic)
+	return scene.IsMatchAllCondition()
+}
+
+// isGroupSatisfied 条件组是否满足
+func (env ConditionEnv) isGroupSatisfied(group entity.ConditionGroup, conditions map[string]entity.SceneCondition, trig map[int]bool) bool {
+	if group.IsLeaf() {
+		c, ok := conditions[group.Condition]
+		if !ok {
+			return false
+		}
+		return env.isSceneConditionSatisfied(c, trig)
+	}
+
+	for _, child := range group.Children {
+		satisfied := env.isGroupSatisfied(child, conditions, trig)
+		// 全部满足时有一个不满足，或任一满足时有一个满足，即可得出结果
+		if satisfied != group.IsMatchAll() {
+			return satisfied
+		}
+	}
+	return group.IsMatchAll()
+}
+
+// isSceneConditionSatisfied 定时条件、webhook 条件和属性变化类条件仅在由其触发时满足
+func (env ConditionEnv) isSceneConditionSatisfied(c entity.SceneCondition, trig map[int]bool) bool {
+	if c.IsEventCondition() {
+		return trig[c.ID]
+	}
+	if c.Operator.IsEdgeTriggered() && !trig[c.ID] {
+		return false
+	}
+	return env.IsConditionSatisfied(c)
+}
+
+// IsInTimePeriod 是否在时间段内
+func (env ConditionEnv) IsInTimePeriod(scene entity.Scene) bool {
+
+	weekday := env.Now.Weekday()
+	if !strings.Contains(scene.RepeatDate, strconv.Itoa(int(weekday))) {
+		logger.Debugf("scene %d: today not in repeat date\n", scene.ID)
+		return false
+	}
+
+	if scene.TimePeriodType == entity.TimePeriodTypeCustom {
+		days := int(env.Now.Sub(scene.EffectStart).Hours() / 24)
+		effectEndTime := scene.EffectEnd.AddDate(0, 0, days)
+		effectStartTime := scene.EffectStart.AddDate(0, 0, days)
+		return env.Now.Before(effectEndTime) && env.Now.After(effectStartTime)
+	}
+	return true
+}
+
+// IsConditionSatisfied 判断设备状态是否满足条件
+func (env ConditionEnv) IsConditionSatisfied(condition entity.SceneCondition) bool {
+	if condition.IsEventCondition() {
+		return false
+	}
+
+	var item entity.Attribute
+	if err := json.Unmarshal(condition.ConditionAttr, &item); err != nil {
+		logger.Error("Unmarshal error:", err)
+		return false
+	}
+	// 从设备影子中获取最新的报告值
+	shadow, err := env.getShadow(condition.DeviceID)
+	if err != nil {
+		logger.Errorf("get device %d shadow err:%v\n", condition.DeviceID, err)
+		return false
+	}
+	val, err := shadow.Get(item.InstanceID, item.Attribute.Attribute)
+	if err != nil {
+		logger.Error("GetAttribute error:", err)
+		return false
+	}
+	if condition.Operator.IsEdgeTriggered() {
+		// 与变化前的值比较
+		previous, ok := shadow.GetPrevious(item.InstanceID, item.Attribute.Attribute)
+		if !ok {
+			return false
+		}
+		if condition.Operator == entity.OperatorChangedTo {
+			return isScalarEqual(val, item.Val) && !isScalarEqual(previous, item.Val)
+		}
+		return isScalarEqual(previous, item.Val) && !isScalarEqual(val, item.Val)
+	}
+	if !isValSatisfied(condition.Operator, val, item.Val) {
+		return false
+	}
+	if condition.Duration == 0 {
+		return true
+	}
+	// 状态需要持续一段时间
+	reportedAt, ok := shadow.ReportedAt(item.InstanceID, item.Attribute.Attribute)
+	if !ok {
+		return false
+	}
+	return env.Now.Sub(reportedAt) >= time.Duration(condition.Duration)*time.Second
+}
@@ -0,0 +1,133 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	errors2 "errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/modules/config"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/plugin"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+	plugin2 "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+	"gorm.io/gorm"
+)
+
+// setAttributesTimeout 每次请求插件设置设备属性的超时时间
+const setAttributesTimeout = 10 * time.Second
+
+// retryPolicy 设置设备属性遇到临时错误时的重试策略
+type retryPolicy struct {
+	retries  int           // 重试次数
+	interval time.Duration // 首次重试间隔，之后每次加倍
+}
+
+func newRetryPolicy(conf config.Task) retryPolicy {
+	return retryPolicy{
+		retries:  conf.GetDeviceRetries(),
+		interval: conf.GetDeviceRetryInterval(),
+	}
+}
+
+// do 执行 f，遇到临时错误时按间隔重试，直到成功、重试次数用完或 ctx 结束
+func (p retryPolicy) do(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	interval := p.interval
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, setAttributesTimeout)
+		err = f(attemptCtx)
+		cancel()
+		if err == nil || attempt >= p.retries || ctx.Err() != nil || !plugin.IsTransientErr(err) {
+			return
+		}
+		logger.Warnf("set attributes err: %s, retry after %s", err, interval)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		interval *= 2
+	}
+}
+
+// executeDevice 控制设备执行，各属性分别设置，部分属性设置失败不影响其他属性
+func (m *LocalManager) executeDevice(task entity.SceneTask) (err error) {
+
+	var ds []entity.Attribute
+	if err := json.Unmarshal(task.Attributes, &ds); err != nil {
+		logger.Error(err)
+		return err
+	}
+	device, err := entity.GetDeviceByID(task.DeviceID)
+	if err != nil {
+		if errors2.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New(status.DeviceNotExist)
+		}
+		return errors.Wrap(err, http.StatusInternalServerError)
+	}
+
+	conf := config.GetConf().Task
+	timeout := conf.GetDeviceTimeout()
+	if task.TimeoutSeconds > 0 {
+		timeout = time.Duration(task.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	policy := newRetryPolicy(conf)
+
+	var errs []error
+	for _, d := range ds {
+		if ctx.Err() != nil { // 超时后不再设置剩余的属性
+			errs = append(errs, ctx.Err())
+			break
+		}
+		logger.Infof("execute device command device id:%d instance id:%d attr:%s val:%v",
+			device.ID, d.InstanceID, d.Attribute.Attribute, d.Attribute.Val)
+
+		attributes := []plugin2.SetAttribute{
+			{
+				InstanceID: d.InstanceID,
+				Attribute:  d.Attribute.Attribute,
+				Val:        d.Attribute.Val,
+			},
+		}
+
+		data, _ := json.Marshal(plugin2.SetRequest{Attributes: attributes})
+		err = policy.do(ctx, func(ctx context.Context) error {
+			return plugin.SetAttributesContext(ctx, device.AreaID, device.PluginID, device.Identity, data)
+		})
+		if err != nil {
+			logger.Errorf("set device %d attr %s err: %s", device.ID, d.Attribute.Attribute, err)
+			errs = append(errs, err)
+		}
+	}
+	return deviceTaskErr(ctx, len(ds), errs)
+}
+
+// deviceTaskErr 根据各属性设置的结果生成设备任务的错误：
+// 超时为 DeviceTaskTimeout，部分属性失败为 DeviceTaskPartFailed，
+// 全部失败时插件不可用为 DeviceOffline，否则为 DeviceTaskFailed
+func deviceTaskErr(ctx context.Context, total int, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Wrap(ctx.Err(), status.DeviceTaskTimeout)
+	}
+
+	last := errors.Cause(errs[len(errs)-1])
+	if len(errs) < total {
+		return errors.Wrapf(last, status.DeviceTaskPartFailed, fmt.Sprintf("%d/%d", len(errs), total))
+	}
+	if last == plugin.NotExistErr || plugin.IsTransientErr(last) {
+		return errors.Wrap(last, status.DeviceOffline)
+	}
+	return errors.Wrapf(last, status.DeviceTaskFailed, last.Error())
+}
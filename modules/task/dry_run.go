@@ -0,0 +1,186 @@
+package task
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+)
+
+// DryRunAction 模拟执行场景时的一个执行动作
+type DryRunAction struct {
+	DelaySeconds   int                `json:"delay_seconds"`
+	ExecuteAt      int64              `json:"execute_at"`
+	Type           entity.TaskType    `json:"type"`
+	DeviceID       int                `json:"device_id,omitempty"`
+	Attributes     []entity.Attribute `json:"attributes,omitempty"` // 依次写入设备的属性
+	ControlSceneID int                `json:"control_scene_id,omitempty"`
+	Satisfied      *bool              `json:"satisfied,omitempty"` // 流程控制步骤的条件是否满足
+	Message        string             `json:"message,omitempty"`   // 通知的消息
+}
+
+// DryRunResult 模拟执行场景的结果
+type DryRunResult struct {
+	InTimePeriod        bool           `json:"in_time_period"`
+	ConditionsSatisfied bool           `json:"conditions_satisfied"`
+	WillRun             bool           `json:"will_run"`
+	Actions             []DryRunAction `json:"actions"`
+}
+
+// DryRunScene 按 env 的时间和设备状态模拟执行场景，返回按执行顺序排列的动作，不会实际控制设备或场景
+// 手动场景不判断条件，直接返回执行动作
+func DryRunScene(env ConditionEnv, scene entity.Scene, trigConditionIDs ...int) (result DryRunResult, err error) {
+	trigConditionIDs = env.filterWebhookTrigger(scene, trigConditionIDs)
+	if scene.AutoRun {
+		result.InTimePeriod = env.IsInTimePeriod(scene)
+		result.ConditionsSatisfied = env.IsConditionsSatisfied(scene, trigConditionIDs...)
+		result.WillRun = result.ConditionsSatisfied
+	} else {
+		result.InTimePeriod = true
+		result.ConditionsSatisfied = true
+		result.WillRun = true
+	}
+
+	result.Actions = make([]DryRunAction, 0)
+	data := env.notificationData(scene, trigConditionIDs...)
+	if err = env.dryRunTasks(&result.Actions, scene.SceneTasks, 0, data); err != nil {
+		return
+	}
+	// 按延时先后排列，延时相同的保持任务顺序
+	sort.SliceStable(result.Actions, func(i, j int) bool {
+		return result.Actions[i].DelaySeconds < result.Actions[j].DelaySeconds
+	})
+	return
+}
+
+// dryRunTasks 模拟执行任务，offset 为任务所属步骤开始执行的秒数；
+// 流程控制步骤按 env 的设备状态展开，设备状态不会变化，未满足的等待步骤在超时后执行 else
+func (env ConditionEnv) dryRunTasks(actions *[]DryRunAction, sceneTasks []entity.SceneTask, offset int, data entity.NotificationData) (err error) {
+	for _, sceneTask := range sceneTasks {
+		delay := offset + sceneTask.DelaySeconds
+		action := DryRunAction{
+			DelaySeconds: delay,
+			ExecuteAt:    env.Now.Add(time.Duration(delay) * time.Second).Unix(),
+			Type:         sceneTask.Type,
+		}
+		var nested []DryRunAction
+		switch {
+		case sceneTask.Type == entity.TaskTypeSmartDevice:
+			action.DeviceID = sceneTask.DeviceID
+			if err = json.Unmarshal(sceneTask.Attributes, &action.Attributes); err != nil {
+				return
+			}
+		case sceneTask.IsControlStep():
+			if nested, err = env.dryRunStep(&action, sceneTask, delay, data); err != nil {
+				return
+			}
+		case sceneTask.IsNotification():
+			var n entity.Notification
+			if n, err = sceneTask.GetNotification(); err != nil {
+				return
+			}
+			data.Time = action.ExecuteAt
+			if action.Message, err = n.Render(data); err != nil {
+				return
+			}
+		default:
+			action.ControlSceneID = sceneTask.ControlSceneID
+		}
+		*actions = append(*actions, action)
+		*actions = append(*actions, nested...)
+	}
+	return
+}
+
+// dryRunStep 模拟执行流程控制步骤，展开执行的嵌套步骤
+func (env ConditionEnv) dryRunStep(action *DryRunAction, step entity.SceneTask, delay int, data entity.NotificationData) (actions []DryRunAction, err error) {
+	var steps []entity.SceneTask
+	switch step.Type {
+	case entity.TaskTypeIf, entity.TaskTypeWait:
+		var condition entity.SceneCondition
+		if condition, err = step.GetCondition(); err != nil {
+			return
+		}
+		satisfied := env.IsConditionSatisfied(condition)
+		action.Satisfied = &satisfied
+		if satisfied {
+			steps, err = step.GetThen()
+		} else {
+			steps, err = step.GetElse()
+			if step.Type == entity.TaskTypeWait {
+				delay += step.TimeoutSeconds
+			}
+		}
+		if err != nil {
+			return
+		}
+		err = env.dryRunTasks(&actions, steps, delay, data)
+	case entity.TaskTypeRepeat:
+		if steps, err = step.GetThen(); err != nil {
+			return
+		}
+		// 上一次的任务都执行后，间隔 interval_seconds 秒开始下一次
+		start := delay
+		for i := 0; i < step.RepeatTimes; i++ {
+			var iteration []DryRunAction
+			if err = env.dryRunTasks(&iteration, steps, start, data); err != nil {
+				return
+			}
+			for _, a := range iteration {
+				if a.DelaySeconds > start {
+					start = a.DelaySeconds
+				}
+			}
+			start += step.IntervalSeconds
+			actions = append(actions, iteration...)
+		}
+	}
+	return
+}
+
+// filterWebhookTrigger 去掉 env 的请求内容不满足的 webhook 触发条件
+func (env ConditionEnv) filterWebhookTrigger(scene entity.Scene, trigConditionIDs []int) (ids []int) {
+	webhooks := make(map[int]entity.SceneCondition)
+	for _, c := range scene.SceneConditions {
+		if c.ConditionType == entity.ConditionTypeWebhook {
+			webhooks[c.ID] = c
+		}
+	}
+	for _, id := range trigConditionIDs {
+		if c, ok := webhooks[id]; ok && !IsPayloadSatisfied(c, env.Payload) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// notificationData 通知的消息模板可引用的数据，触发条件中第一个设备状态条件作为触发场景的设备状态
+func (env ConditionEnv) notificationData(scene entity.Scene, trigConditionIDs ...int) (data entity.NotificationData) {
+	data = entity.NotificationData{SceneID: scene.ID, Scene: scene.Name, Payload: env.Payload}
+	trig := make(map[int]bool)
+	for _, id := range trigConditionIDs {
+		trig[id] = true
+	}
+	for _, c := range scene.SceneConditions {
+		if c.ConditionType != entity.ConditionTypeDeviceStatus || !trig[c.ID] {
+			continue
+		}
+		var item entity.Attribute
+		if err := json.Unmarshal(c.ConditionAttr, &item); err != nil {
+			continue
+		}
+		data.DeviceID = c.DeviceID
+		data.InstanceID = item.InstanceID
+		data.Attribute = item.Attribute.Attribute
+		if shadow, err := env.getShadow(c.DeviceID); err == nil {
+			data.Val, _ = shadow.Get(item.InstanceID, item.Attribute.Attribute)
+		}
+		if device, err := entity.GetDeviceByIDWithUnscoped(c.DeviceID); err == nil {
+			data.Device = device.Name
+		}
+		return
+	}
+	return
+}
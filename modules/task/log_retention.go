@@ -0,0 +1,47 @@
+package task
+
+import (
+	"time"
+
+	"github.com/jinzhu/now"
+	"github.com/zhiting-tech/smartassistant/modules/config"
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+// logCleanHour 每天清理执行日志的时间
+const logCleanHour = 4
+
+// addCleanTaskLogTask 每天定时清理过期的执行日志
+func (m *LocalManager) addCleanTaskLogTask(executeTime time.Time) {
+	f := func(task *Task) error {
+		cleanTaskLogs(time.Now())
+		m.addCleanTaskLogTask(executeTime.AddDate(0, 0, 1))
+		return nil
+	}
+	// 清理任务本身不记录日志
+	m.queue.push(NewTaskAt(f, executeTime))
+}
+
+// nextLogCleanTime 获取 t 之后下一次清理执行日志的时间
+func nextLogCleanTime(t time.Time) time.Time {
+	next := now.New(t).BeginningOfDay().Add(logCleanHour * time.Hour)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// cleanTaskLogs 按配置的保留天数和数量清理执行日志
+func cleanTaskLogs(t time.Time) {
+	conf := config.GetConf().Task
+	var before time.Time
+	if days := conf.GetLogRetentionDays(); days > 0 {
+		before = t.AddDate(0, 0, -days)
+	}
+	count, err := entity.CleanTaskLogs(before, conf.GetLogMaxCount())
+	if err != nil {
+		logger.Errorf("clean task logs err: %v", err)
+	}
+	logger.Infof("%d task logs cleaned", count)
+}
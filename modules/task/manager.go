@@ -5,17 +5,18 @@ import (
 	"encoding/json"
 	errors2 "errors"
 	"fmt"
-	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jinzhu/now"
+	"github.com/zhiting-tech/smartassistant/modules/config"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
-	"github.com/zhiting-tech/smartassistant/modules/plugin"
+	"github.com/zhiting-tech/smartassistant/modules/event"
 	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/cron"
 	"github.com/zhiting-tech/smartassistant/pkg/errors"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
-	plugin2 "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
 	"gorm.io/gorm"
 )
 
@@ -27,15 +28,19 @@ var (
 type Manager interface {
 	AddSceneTask(entity.Scene)
 	DeleteSceneTask(sceneID int)
+	CancelSceneTask(sceneID int)
 	RestartSceneTask(sceneID int) error
-	DeviceStateChange(d entity.Device, attr entity.Attribute) error
+	DeviceStateChange(e event.Event) error
+	WebhookTrigger(sceneID int, payload map[string]interface{}) (triggered bool, err error)
 	Run(ctx context.Context)
 }
 
 // LocalManager Task 服务
 type LocalManager struct {
-	queue        *queueServe
-	runningScene sync.Map // 正在执行的场景的id -> queue index
+	queue         *queueServe
+	runningScene  sync.Map // 正在执行的场景的id -> *sceneRuns
+	cronTasks     sync.Map // 场景 cron 条件 -> 当前有效的 task id
+	durationTasks sync.Map // 场景持续时间条件 -> 等待中的 *Task
 }
 
 func NewLocalManager() *LocalManager {
@@ -63,10 +68,16 @@ func GetManager() Manager {
 func (m *LocalManager) Run(ctx context.Context) {
 	logger.Info("starting task manager")
 	go m.queue.start(ctx)
+	// 恢复重启前未执行的延时任务
+	m.restoreQueuedTasks()
 	// 重启时编排任务
 	m.addSceneTaskByTime(time.Now())
+	// cron 条件的场景不参与每天编排，由各自的任务排出下一次执行
+	m.addCronScenesTask()
 	// 每天 23:55:00 进行第二天任务编排
 	m.addArrangeSceneTask(now.EndOfDay().Add(-5 * time.Minute))
+	// 每天清理过期的执行日志
+	m.addCleanTaskLogTask(nextLogCleanTime(time.Now()))
 	// TODO 扫描已安装的插件，并且启动，连接 state change...
 	<-ctx.Done()
 	// TODO 断开连接
@@ -85,10 +96,103 @@ func (m *LocalManager) addSceneTaskByTime(t time.Time) {
 		if !IsSceneHaveTimeCondition(scene) {
 			continue
 		}
-		m.AddSceneTask(scene)
+		m.addTimeSceneTask(scene, t)
 	}
 }
 
+// addTimeSceneTask 将自动场景在 day 当天的定时触发任务加入队列
+func (m *LocalManager) addTimeSceneTask(scene entity.Scene, day time.Time) {
+	endOfDay := now.New(day).EndOfDay()
+	for _, c := range scene.SceneConditions {
+		// cron 条件由 addCronSceneTask 单独编排
+		if !c.IsTimeCondition() || c.ConditionType == entity.ConditionTypeCron {
+			continue
+		}
+
+		execTime, err := conditionExecTime(scene, c, day)
+		if err != nil {
+			logger.Warnf("scene %d condition %d get execute time err: %v", scene.ID, c.ID, err)
+			continue
+		}
+		if execTime.Before(time.Now()) || execTime.After(endOfDay) {
+			logger.Infof("now:%v,invalid next execute time:%v", time.Now(), execTime)
+			continue
+		}
+
+		t := NewTaskAt(m.wrapSceneFunc(scene, c.ID), execTime).WithScene(scene.ID)
+		m.pushTask(t, scene)
+	}
+}
+
+// addCronScenesTask 将所有 cron 条件的场景加入队列
+func (m *LocalManager) addCronScenesTask() {
+	scenes, err := entity.GetCronScenes()
+	if err != nil {
+		logger.Errorf("get cron scenes err %v", err)
+		return
+	}
+	for _, scene := range scenes {
+		m.addCronSceneTask(scene)
+	}
+}
+
+// addCronSceneTask 将场景的 cron 条件加入队列
+func (m *LocalManager) addCronSceneTask(scene entity.Scene) {
+	for _, c := range scene.SceneConditions {
+		if c.ConditionType != entity.ConditionTypeCron {
+			continue
+		}
+		m.pushCronTask(scene, c, time.Now())
+	}
+}
+
+// pushCronTask 计算 cron 条件在 after 之后的执行时间并加入队列，
+// 任务运行时先排出下一次执行，再执行场景
+func (m *LocalManager) pushCronTask(scene entity.Scene, c entity.SceneCondition, after time.Time) {
+	schedule, err := cron.Parse(c.CronExpr)
+	if err != nil {
+		logger.Warnf("scene %d condition %d parse cron err: %v", scene.ID, c.ID, err)
+		return
+	}
+	execTime := schedule.Next(after)
+	if execTime.IsZero() {
+		logger.Infof("scene %d condition %d cron %s has no next execute time", scene.ID, c.ID, c.CronExpr)
+		return
+	}
+
+	key := conditionTaskKey(scene.ID, c.ID)
+	sceneFunc := m.wrapSceneFunc(scene, c.ID)
+	f := func(t *Task) error {
+		// 场景重新开启或修改后会排出新的任务，旧的任务不再执行
+		if v, ok := m.cronTasks.Load(key); !ok || v.(string) != t.ID {
+			return nil
+		}
+		if m.isCronConditionValid(scene.ID, c) {
+			m.pushCronTask(scene, c, execTime)
+		} else {
+			m.cronTasks.Delete(key)
+		}
+		return sceneFunc(t)
+	}
+	t := NewTaskAt(f, execTime).WithScene(scene.ID)
+	m.cronTasks.Store(key, t.ID)
+	m.pushTask(t, scene)
+}
+
+// isCronConditionValid 场景是否仍然开启并且 cron 条件未被修改
+func (m *LocalManager) isCronConditionValid(sceneID int, c entity.SceneCondition) bool {
+	scene, err := entity.GetSceneInfoById(sceneID)
+	if err != nil || !scene.AutoRun || !scene.IsOn {
+		return false
+	}
+	for _, sc := range scene.SceneConditions {
+		if sc.ID == c.ID {
+			return sc.ConditionType == entity.ConditionTypeCron && sc.CronExpr == c.CronExpr
+		}
+	}
+	return false
+}
+
 // addArrangeSceneTask 每天定时编排场景任务
 func (m *LocalManager) addArrangeSceneTask(executeTime time.Time) {
 	var f TaskFunc
@@ -104,9 +208,31 @@ func (m *LocalManager) addArrangeSceneTask(executeTime time.Time) {
 	m.pushTask(task, "daily arrange scene task")
 }
 
-// DeleteSceneTask 删除场景任务
+// DeleteSceneTask 删除场景任务（关闭、删除或修改场景时调用），包括等待触发的任务和执行中未到时间的子任务
 func (m *LocalManager) DeleteSceneTask(sceneID int) {
-	// 现时需求如果场景对应的任务已运行，则不需要处理
+	m.cancelQueuedRuns(sceneID)
+	tasks := m.queue.removeScene(sceneID)
+	logger.Infof("delete scene %d, %d queued tasks removed", sceneID, len(tasks))
+	m.cancelTasks(tasks)
+
+	// 清除条件的计时记录，场景重新开启后重新计时
+	prefix := fmt.Sprintf("%d:", sceneID)
+	for _, taskMap := range []*sync.Map{&m.cronTasks, &m.durationTasks} {
+		taskMap.Range(func(key, value interface{}) bool {
+			if strings.HasPrefix(key.(string), prefix) {
+				taskMap.Delete(key)
+			}
+			return true
+		})
+	}
+}
+
+// CancelSceneTask 取消场景正在进行的执行，未执行的延时任务不再执行
+func (m *LocalManager) CancelSceneTask(sceneID int) {
+	m.cancelQueuedRuns(sceneID)
+	tasks := m.queue.removeSceneRunning(sceneID)
+	logger.Infof("cancel scene %d, %d queued tasks removed", sceneID, len(tasks))
+	m.cancelTasks(tasks)
 }
 
 // addSceneTaskByID 根据场景id执行场景（执行或者开启时调用）
@@ -124,33 +250,20 @@ func (m *LocalManager) addSceneTaskByID(sceneID int) error {
 
 // AddSceneTask 添加场景任务（执行或者开启时调用）
 func (m *LocalManager) AddSceneTask(scene entity.Scene) {
-	var t *Task
 	if scene.AutoRun { // 开启自动场景
 		logger.Infof("open scene %d", scene.ID)
-		// 找到定时条件的时间
-		for _, c := range scene.SceneConditions {
-			if c.ConditionType == entity.ConditionTypeTiming {
-
-				// 获取任务今天的下次执行时间
-				execTime := now.BeginningOfDay().Add(c.TimingAt.Sub(now.New(c.TimingAt).BeginningOfDay()))
-				if execTime.Before(time.Now()) || execTime.After(now.EndOfDay()) {
-					logger.Infof("now:%v,invalid next execute time:%v", time.Now(), execTime)
-					continue
-				}
-
-				t = NewTaskAt(m.wrapSceneFunc(scene, true), execTime)
-				m.pushTask(t, scene)
-				continue
-			}
-		}
+		// 获取定时条件今天的下次执行时间
+		m.addTimeSceneTask(scene, time.Now())
+		m.addCronSceneTask(scene)
 	} else { // 执行手动场景
 		logger.Infof("execute scene %d", scene.ID)
-		t = NewTask(m.wrapSceneFunc(scene, false), 0)
+		t := NewTask(m.wrapSceneFunc(scene), 0).WithScene(scene.ID)
 		m.pushTask(t, scene)
 	}
 }
 
 func (m *LocalManager) pushTask(task *Task, target interface{}) {
+	task.target = target
 	task.WithWrapper(taskLogWrapper(target))
 	m.queue.push(task)
 }
@@ -171,12 +284,8 @@ func (m *LocalManager) RestartSceneTask(sceneID int) error {
 	return m.addSceneTaskByID(sceneID)
 }
 
-func (m *LocalManager) addRunningScene(sceneID int, queueIndex int) {
-	m.runningScene.Store(sceneID, queueIndex)
-}
-
-// wrapSceneFunc  包装场景为 TaskFunc
-func (m *LocalManager) wrapSceneFunc(sc entity.Scene, isTrigByTimer bool) (f TaskFunc) {
+// wrapSceneFunc  包装场景为 TaskFunc，trigConditionIDs 为触发场景的条件id
+func (m *LocalManager) wrapSceneFunc(sc entity.Scene, trigConditionIDs ...int) (f TaskFunc) {
 	return func(t *Task) error {
 		scene, err := entity.GetSceneInfoById(sc.ID)
 		if err != nil {
@@ -188,40 +297,122 @@ func (m *LocalManager) wrapSceneFunc(sc entity.Scene, isTrigByTimer bool) (f Tas
 		if scene.Deleted.Valid { // 已删除的场景不执行
 			return errors.New(status.SceneNotExist)
 		}
-		if scene.AutoRun && !IsConditionsSatisfied(scene, isTrigByTimer) { // 自动场景则判断条件
+		if scene.AutoRun && !IsConditionsSatisfied(scene, trigConditionIDs...) { // 自动场景则判断条件
 			logger.Infof("auto scene:%d's conditons not satisfied", scene.ID)
 			return nil
 		}
-		// TODO 此代码达到其功能，需清理
-		m.addRunningScene(scene.ID, t.index)
-		for _, sceneTask := range scene.SceneTasks {
-			delay := time.Duration(sceneTask.DelaySeconds) * time.Second
-			task := NewTask(m.wrapTaskToFunc(sceneTask), delay).WithParent(t)
-
-			if sceneTask.Type == entity.TaskTypeSmartDevice { // 控制设备
-				if len(sceneTask.Attributes) == 0 {
-					continue
-				}
-				deviceID := sceneTask.DeviceID
-				var device entity.Device
-				entity.GetDB().Unscoped().First(&device, deviceID)
-				device, err := entity.GetDeviceByIDWithUnscoped(deviceID)
-				if err == nil {
-					m.pushTask(task, device)
-				}
-			} else {
-				controlScene, err := entity.GetSceneByIDWithUnscoped(sceneTask.ControlSceneID)
-				if err == nil {
-					m.pushTask(task, controlScene)
-				}
+		// 按场景的执行模式执行
+		return m.startSceneRun(scene, t)
+	}
+}
+
+// runScene 将场景的执行任务作为 t 的子任务加入队列，所有子任务结束后该次执行结束
+func (m *LocalManager) runScene(scene entity.Scene, t *Task) {
+	m.getSceneRuns(scene.ID).add(t.ID)
+	defer m.finishSceneRun(scene.ID, t.ID)
+
+	event.Publish(event.SceneExecuted{Scene: scene, TaskID: t.ID, Time: time.Now()})
+
+	m.pushSceneTasks(scene.SceneTasks, t, t.ID, time.Now(), true, nil)
+}
+
+// pushSceneTasks 将执行任务作为 parent 的子任务加入队列，延时相对于 start 计算，
+// runID 为任务所属场景执行的任务id，persist 为延时执行的任务是否保存到数据库，
+// it 为任务所属的重复步骤的一次执行
+func (m *LocalManager) pushSceneTasks(sceneTasks []entity.SceneTask, parent *Task, runID string, start time.Time, persist bool, it *iteration) {
+	runs := m.getSceneRuns(parent.sceneID)
+	for _, sceneTask := range sceneTasks {
+		delay := time.Duration(sceneTask.DelaySeconds) * time.Second
+		task, target, err := m.newSceneTask(sceneTask, parent, start.Add(delay))
+		if err != nil {
+			continue
+		}
+		// 延时执行的任务保存到数据库，服务重启后恢复
+		if persist && sceneTask.DelaySeconds > 0 {
+			if err = saveQueuedTask(task, sceneTask); err != nil {
+				logger.Error("save queued task err:", err)
 			}
 		}
-		return nil
+		if it != nil {
+			it.add()
+			task.iteration = it
+			task.WithWrapper(iterationWrapper)
+		}
+		runs.add(runID)
+		task.WithWrapper(m.sceneRunWrapper(parent.sceneID, runID))
+		m.pushTask(task, target)
 	}
 }
 
+// newSceneTask 将场景的执行任务包装为 parent 的子任务，target 为执行的设备、场景、流程控制步骤或通知
+func (m *LocalManager) newSceneTask(sceneTask entity.SceneTask, parent *Task, executeAt time.Time) (task *Task, target interface{}, err error) {
+	if sceneTask.Type == entity.TaskTypeSmartDevice { // 控制设备
+		if len(sceneTask.Attributes) == 0 {
+			err = errors.New(status.DeviceOperationNotSetErr)
+			return
+		}
+		if target, err = entity.GetDeviceByIDWithUnscoped(sceneTask.DeviceID); err != nil {
+			return
+		}
+	} else if sceneTask.IsControlStep() || sceneTask.IsNotification() { // 流程控制步骤、通知
+		target = sceneTask
+	} else {
+		if target, err = entity.GetSceneByIDWithUnscoped(sceneTask.ControlSceneID); err != nil {
+			return
+		}
+	}
+	task = NewTaskAt(m.wrapTaskToFunc(sceneTask), executeAt).WithParent(parent)
+	if sceneTask.DelaySeconds > 0 {
+		task.WithWrapper(queuedTaskWrapper)
+	}
+	return
+}
+
+// restoreQueuedTasks 恢复服务停止前保存的未执行的延时任务
+func (m *LocalManager) restoreQueuedTasks() {
+	queuedTasks, err := entity.GetQueuedTasks()
+	if err != nil {
+		logger.Errorf("get queued tasks err: %v", err)
+		return
+	}
+
+	conf := config.GetConf().Task
+	for _, qt := range queuedTasks {
+		sceneTask, err := entity.GetSceneTaskByID(qt.SceneTaskID)
+		if err != nil || qt.ParentTaskID == nil {
+			logger.Warnf("queued task %s scene task %d not found, ignore", qt.TaskID, qt.SceneTaskID)
+			_ = entity.DeleteQueuedTask(qt.TaskID)
+			continue
+		}
+		parent := (&Task{ID: *qt.ParentTaskID}).WithScene(qt.SceneID)
+		task, target, err := m.newSceneTask(sceneTask, parent, qt.ExecuteAt)
+		if err != nil {
+			logger.Warnf("queued task %s restore err: %v", qt.TaskID, err)
+			_ = entity.DeleteQueuedTask(qt.TaskID)
+			continue
+		}
+		task.ID = qt.TaskID
+
+		if !isMissedTaskRunnable(conf, qt.ExecuteAt, time.Now()) {
+			logger.Infof("queued task %s missed execute time %v, skip", qt.TaskID, qt.ExecuteAt)
+			task.target = target
+			logUnrunTask(task, errors.New(status.SceneTaskMissed))
+			_ = entity.DeleteQueuedTask(qt.TaskID)
+			continue
+		}
+		// 与 pushSceneTasks 相同，记录到所属的场景执行中，执行模式对恢复的执行同样生效
+		m.getSceneRuns(qt.SceneID).add(parent.ID)
+		task.WithWrapper(m.sceneRunWrapper(qt.SceneID, parent.ID))
+		m.pushTask(task, target)
+	}
+	logger.Infof("%d queued tasks restored", len(queuedTasks))
+}
+
 // wrapTaskToFunc 包装场景任务为 TaskFunc
 func (m *LocalManager) wrapTaskToFunc(task entity.SceneTask) (f TaskFunc) {
+	if task.IsControlStep() {
+		return m.wrapStepToFunc(task)
+	}
 	return func(t *Task) error {
 		// TODO 判断权限、判断场景是否有修改
 		fmt.Printf("execute task:%d,type:%d\n", task.ID, task.Type)
@@ -234,48 +425,15 @@ func (m *LocalManager) wrapTaskToFunc(task entity.SceneTask) (f TaskFunc) {
 			return m.setSceneOn(task.ControlSceneID)
 		case entity.TaskTypeDisableAutoRun: // 关闭场景
 			return m.setSceneOff(task.ControlSceneID)
+		case entity.TaskTypeWebhook: // 发送 webhook
+			return sendWebhook(task, t)
+		case entity.TaskTypeAlert: // 推送提醒
+			return sendAlert(task, t)
 		}
 		return nil
 	}
 }
 
-// executeDevice 控制设备执行
-func (m *LocalManager) executeDevice(task entity.SceneTask) (err error) {
-
-	var ds []entity.Attribute
-	if err := json.Unmarshal(task.Attributes, &ds); err != nil {
-		logger.Error(err)
-		return err
-	}
-	for _, d := range ds {
-		var device entity.Device
-		device, err = entity.GetDeviceByID(task.DeviceID)
-		if err != nil {
-			if errors2.Is(err, gorm.ErrRecordNotFound) {
-				return errors.New(status.DeviceNotExist)
-			}
-			return errors.Wrap(err, http.StatusInternalServerError)
-		}
-		logger.Infof("execute device command device id:%d instance id:%d attr:%s val:%v",
-			device.ID, d.InstanceID, d.Attribute.Attribute, d.Attribute.Val)
-
-		attributes := []plugin2.SetAttribute{
-			{
-				InstanceID: d.InstanceID,
-				Attribute:  d.Attribute.Attribute,
-				Val:        d.Attribute.Val,
-			},
-		}
-
-		data, _ := json.Marshal(plugin2.SetRequest{Attributes: attributes})
-		err = plugin.SetAttributes(device.AreaID, device.PluginID, device.Identity, data)
-		if err != nil {
-			return errors.Wrap(err, status.DeviceOffline)
-		}
-	}
-	return
-}
-
 // SetSceneOn 开启场景
 func (m *LocalManager) setSceneOn(sceneID int) (err error) {
 	if err = entity.SwitchAutoSceneByID(sceneID, true); err != nil {
@@ -297,13 +455,16 @@ func (m *LocalManager) setSceneOff(sceneID int) (err error) {
 }
 
 // DeviceStateChange 设备状态变化触发场景
-func (m *LocalManager) DeviceStateChange(d entity.Device, attr entity.Attribute) error {
-	m.deviceAttrChange(d.ID, attr)
+func (m *LocalManager) DeviceStateChange(e event.Event) error {
+	if e, ok := e.(event.DeviceStateChanged); ok {
+		m.deviceAttrChange(e)
+	}
 	return nil
 }
 
-// deviceAttrChange 设备属性变更时触发场景
-func (m *LocalManager) deviceAttrChange(deviceID int, attr entity.Attribute) {
+// deviceAttrChange 设备属性上报时触发场景
+func (m *LocalManager) deviceAttrChange(e event.DeviceStateChanged) {
+	deviceID, attr := e.Device.ID, e.Attr
 
 	scenes, err := entity.GetScenesByCondition(deviceID, attr)
 	if err != nil {
@@ -315,13 +476,81 @@ func (m *LocalManager) deviceAttrChange(deviceID int, attr entity.Attribute) {
 	// 遍历并包装场景为任务
 	for _, scene := range scenes {
 		scene, _ = entity.GetSceneInfoById(scene.ID)
-		// 全部满足且有定时条件则不执行
-		if scene.IsMatchAllCondition() && IsSceneHaveTimeCondition(scene) {
-			fmt.Printf("device %d state %s changed but scenes %d not match time conditoin,ignore\n",
-				deviceID, attr.Attribute.Attribute, scene.ID)
+		m.sceneAttrChange(scene, e)
+	}
+}
+
+// sceneAttrChange 设备属性上报时触发场景
+func (m *LocalManager) sceneAttrChange(scene entity.Scene, e event.DeviceStateChanged) {
+	deviceID, attr := e.Device.ID, e.Attr
+	// 全部满足且有定时条件则不执行（条件组在执行时判断）
+	if len(scene.ConditionTree) == 0 && scene.IsMatchAllCondition() && IsSceneHaveTimeCondition(scene) {
+		fmt.Printf("device %d state %s changed but scenes %d not match time conditoin,ignore\n",
+			deviceID, attr.Attribute.Attribute, scene.ID)
+		return
+	}
+
+	// 有持续时间的条件需等待状态保持足够时间后再触发
+	var trigConditionIDs []int
+	for _, c := range scene.SceneConditions {
+		if !c.IsAttrCondition(deviceID, attr) {
 			continue
 		}
-		t := NewTask(m.wrapSceneFunc(scene, false), 0)
-		m.pushTask(t, scene)
+		// 属性变化类条件只由值变化的上报触发，重复上报相同的值不触发
+		if c.Operator.IsEdgeTriggered() && !e.Changed {
+			continue
+		}
+		if c.Duration > 0 {
+			m.updateDurationTask(scene, c, e)
+		} else {
+			trigConditionIDs = append(trigConditionIDs, c.ID)
+		}
+	}
+	if len(trigConditionIDs) == 0 {
+		return
+	}
+	t := NewTask(m.wrapSceneFunc(scene, trigConditionIDs...), 0).WithScene(scene.ID).
+		WithTrigger(deviceID, attr)
+	m.pushTask(t, scene)
+}
+
+// updateDurationTask 设备状态变为满足条件时启动计时任务，不再满足时取消计时
+func (m *LocalManager) updateDurationTask(scene entity.Scene, c entity.SceneCondition, e event.DeviceStateChanged) {
+	key := conditionTaskKey(scene.ID, c.ID)
+	attr := e.Attr
+
+	var item entity.Attribute
+	if err := json.Unmarshal(c.ConditionAttr, &item); err != nil {
+		logger.Error("Unmarshal error:", err)
+		return
+	}
+	// 状态不再满足条件，取消计时
+	if !isValSatisfied(c.Operator, attr.Val, item.Val) {
+		if v, ok := m.durationTasks.LoadAndDelete(key); ok {
+			m.queue.remove(v.(*Task))
+		}
+		return
+	}
+	// 已在计时中，状态保持则不重新计时
+	if _, ok := m.durationTasks.Load(key); ok {
+		return
+	}
+	// 只在状态由不满足变为满足时计时，计时结束后状态保持（设备重复上报）不再重新计时
+	if !e.Changed || (e.Previous != nil && isValSatisfied(c.Operator, e.Previous, item.Val)) {
+		return
+	}
+
+	sceneFunc := m.wrapSceneFunc(scene)
+	f := func(t *Task) error {
+		if v, ok := m.durationTasks.Load(key); !ok || v.(*Task) != t {
+			return nil
+		}
+		m.durationTasks.Delete(key)
+		// 执行前会从设备影子中重新判断状态及持续时间
+		return sceneFunc(t)
 	}
+	t := NewTask(f, time.Duration(c.Duration)*time.Second).WithScene(scene.ID).
+		WithTrigger(c.DeviceID, attr)
+	m.durationTasks.Store(key, t)
+	m.pushTask(t, scene)
 }
@@ -1,11 +1,15 @@
 package task
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zhiting-tech/smartassistant/modules/config"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/event"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
 	"gorm.io/gorm"
 )
 
@@ -108,3 +112,335 @@ func TestDeviceAutoScene(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotEmpty(t, len(taskLogs), "auto task log not found")
 }
+
+func TestConditionExecTime(t *testing.T) {
+	area, err := entity.CreateArea("test_solar_area")
+	assert.Nil(t, err)
+	assert.Nil(t, entity.UpdateAreaCoordinate(area.ID, 22.54, 114.06))
+	scene := entity.Scene{AreaID: area.ID}
+
+	cst := time.FixedZone("CST", 8*3600)
+	day := time.Date(2021, 6, 21, 23, 55, 0, 0, cst)
+
+	timing := entity.SceneCondition{
+		ConditionType: entity.ConditionTypeTiming,
+		TimingAt:      time.Date(2021, 1, 1, 8, 30, 0, 0, cst),
+	}
+	execTime, err := conditionExecTime(scene, timing, day)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2021, 6, 21, 8, 30, 0, 0, cst), execTime)
+
+	sunset := entity.SceneCondition{
+		ConditionType: entity.ConditionTypeSolar,
+		SolarEvent:    entity.SolarEventSunset,
+		SolarOffset:   -30 * 60,
+	}
+	execTime, err = conditionExecTime(scene, sunset, day)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, time.Date(2021, 6, 21, 18, 41, 0, 0, cst), execTime, 3*time.Minute)
+}
+
+func TestConditionGroup(t *testing.T) {
+	conditions := []entity.SceneCondition{
+		{ID: 1, Key: "t1", ConditionType: entity.ConditionTypeTiming},
+		{ID: 2, Key: "t2", ConditionType: entity.ConditionTypeCron},
+		{ID: 3, Key: "t3", ConditionType: entity.ConditionTypeTiming},
+	}
+	// t1 OR (t2 AND t3) 中同一组要求两个定时条件
+	scene := entity.Scene{ConditionTree: []byte(`{"logic":2,"children":[{"condition":"t1"},
+		{"logic":1,"children":[{"condition":"t2"},{"condition":"t3"}]}]}`)}
+	assert.NotNil(t, scene.CheckConditionTree(conditions))
+
+	// 引用不存在的条件
+	scene.ConditionTree = []byte(`{"logic":2,"children":[{"condition":"t1"},{"condition":"t4"}]}`)
+	assert.NotNil(t, scene.CheckConditionTree(conditions))
+
+	// t1 OR (t2 OR t3)
+	scene.ConditionTree = []byte(`{"logic":2,"children":[{"condition":"t1"},
+		{"logic":2,"children":[{"condition":"t2"},{"condition":"t3"}]}]}`)
+	assert.Nil(t, scene.CheckConditionTree(conditions))
+
+	tree, ok, err := scene.GetConditionTree()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	keys := make(map[string]entity.SceneCondition)
+	for _, c := range conditions {
+		keys[c.Key] = c
+	}
+	assert.True(t, currentEnv().isGroupSatisfied(tree, keys, map[int]bool{3: true}))
+	assert.False(t, currentEnv().isGroupSatisfied(tree, keys, nil))
+
+	// t1 AND (t2 OR t3)：定时条件仅在由其触发时满足
+	tree = entity.ConditionGroup{Logic: entity.MatchAllCondition, Children: []entity.ConditionGroup{
+		{Condition: "t1"}, tree.Children[1],
+	}}
+	assert.False(t, currentEnv().isGroupSatisfied(tree, keys, map[int]bool{1: true}))
+}
+
+func TestIsMissedTaskRunnable(t *testing.T) {
+	at := time.Now()
+	assert.True(t, isMissedTaskRunnable(config.Task{MissedPolicy: config.MissedTaskSkip}, at.Add(time.Second), at))
+	assert.False(t, isMissedTaskRunnable(config.Task{MissedPolicy: config.MissedTaskSkip}, at.Add(-time.Second), at))
+	assert.True(t, isMissedTaskRunnable(config.Task{MissedPolicy: config.MissedTaskRun}, at.Add(-time.Hour), at))
+
+	grace := config.Task{MissedPolicy: config.MissedTaskGrace, GracePeriod: 60}
+	assert.True(t, isMissedTaskRunnable(grace, at.Add(-time.Minute), at))
+	assert.False(t, isMissedTaskRunnable(grace, at.Add(-time.Minute-time.Second), at))
+	// 未配置时默认宽限 5 分钟
+	assert.True(t, isMissedTaskRunnable(config.Task{}, at.Add(-4*time.Minute), at))
+}
+
+func TestSceneRunsQueued(t *testing.T) {
+	runs := &sceneRuns{pending: make(map[string]int)}
+	first, second := NewTask(nil, 0), NewTask(nil, 0)
+	runs.add(first.ID)
+	runs.add(first.ID)
+	runs.queued = append(runs.queued, queuedRun{task: second})
+
+	// 还有未结束的子任务
+	assert.Nil(t, runs.done(first.ID))
+	next := runs.done(first.ID)
+	assert.NotNil(t, next)
+	assert.Equal(t, second, next.task)
+	// 排队的执行开始时即占用
+	assert.Equal(t, 1, runs.pending[second.ID])
+	assert.Empty(t, runs.queued)
+	assert.Nil(t, runs.done("unknown"))
+}
+
+func TestSceneSteps(t *testing.T) {
+	area := entity.Area{Name: "test_scene_steps"}
+	assert.Nil(t, entity.GetDB().Create(&area).Error)
+	target := &entity.Scene{Name: "test_scene_steps_target", CreatorID: 1, CreatedAt: time.Now(), AreaID: area.ID}
+	assert.Nil(t, entity.GetDB().Create(target).Error)
+	controlTarget := fmt.Sprintf(`[{"type":%d,"control_scene_id":%d}]`, entity.TaskTypeManualRun, target.ID)
+	// 设备不存在，条件不满足
+	condition := []byte(`{"device_id":-1,"operator":"=","condition_attr":{"instance_id":1,"attribute":"power","val":"on"}}`)
+	wait := fmt.Sprintf(`[{"type":%d,"timeout_seconds":1,"condition":%s}]`, entity.TaskTypeWait, condition)
+	scene := &entity.Scene{
+		Name:      "test_scene_steps",
+		CreatorID: 1,
+		CreatedAt: time.Now(),
+		AreaID:    area.ID,
+		SceneTasks: []entity.SceneTask{
+			{Type: entity.TaskTypeIf, Condition: condition, Then: []byte(controlTarget), Else: []byte(wait)},
+			{Type: entity.TaskTypeRepeat, RepeatTimes: 2, IntervalSeconds: 1, Then: []byte(controlTarget)},
+		},
+	}
+	db := entity.GetDB().Session(&gorm.Session{FullSaveAssociations: true}).Model(entity.Scene{})
+	assert.Nil(t, db.Create(scene).Error)
+
+	trigger := NewTask(GetManager().(*LocalManager).wrapSceneFunc(*scene), 0).WithScene(scene.ID)
+	GetManager().(*LocalManager).pushTask(trigger, *scene)
+	time.Sleep(6 * time.Second)
+
+	// 每个步骤的日志都记录在所属任务下
+	var logs []entity.TaskLog
+	err := entity.GetDB().Where("parent_task_id=?", trigger.ID).Order("type asc").Find(&logs).Error
+	assert.Nil(t, err)
+	if !assert.Len(t, logs, 2) {
+		return
+	}
+	assert.Equal(t, entity.TaskTypeIf, logs[0].Type)
+	assert.Equal(t, entity.TaskTypeRepeat, logs[1].Type)
+	var waitLogs []entity.TaskLog
+	err = entity.GetDB().Where("parent_task_id=?", logs[0].TaskID).Find(&waitLogs).Error
+	assert.Nil(t, err)
+	if assert.Len(t, waitLogs, 1) {
+		assert.Equal(t, entity.TaskTypeWait, waitLogs[0].Type)
+		assert.Equal(t, entity.TaskTimeout, waitLogs[0].Result)
+	}
+	var repeatLogs []entity.TaskLog
+	err = entity.GetDB().Where("parent_task_id=?", logs[1].TaskID).Find(&repeatLogs).Error
+	assert.Nil(t, err)
+	assert.Len(t, repeatLogs, 2)
+	// 所有子任务结束后该次执行结束
+	_, running := GetManager().(*LocalManager).getSceneRuns(scene.ID).pending[trigger.ID]
+	assert.False(t, running)
+}
+
+func TestWebhookTrigger(t *testing.T) {
+	area := entity.Area{Name: "test_webhook_trigger"}
+	assert.Nil(t, entity.GetDB().Create(&area).Error)
+	target := &entity.Scene{Name: "test_webhook_trigger_target", CreatorID: 1, CreatedAt: time.Now(), AreaID: area.ID}
+	assert.Nil(t, entity.GetDB().Create(target).Error)
+	scene := &entity.Scene{
+		Name:           "test_webhook_trigger",
+		AutoRun:        true,
+		IsOn:           true,
+		ConditionLogic: entity.MatchAnyCondition,
+		RepeatType:     entity.RepeatTypeAllDay,
+		RepeatDate:     "1234567",
+		TimePeriodType: entity.TimePeriodTypeAllDay,
+		CreatorID:      1,
+		CreatedAt:      time.Now(),
+		AreaID:         area.ID,
+		SceneConditions: []entity.SceneCondition{
+			{ConditionType: entity.ConditionTypeWebhook, Operator: entity.OperatorEQ,
+				ConditionAttr: []byte(`{"attribute":"event.type","val":"ring"}`)},
+		},
+		SceneTasks: []entity.SceneTask{
+			{Type: entity.TaskTypeManualRun, ControlSceneID: target.ID},
+		},
+	}
+	db := entity.GetDB().Session(&gorm.Session{FullSaveAssociations: true}).Model(entity.Scene{})
+	assert.Nil(t, db.Create(scene).Error)
+
+	m := GetManager()
+	// 请求内容不满足条件时不触发
+	triggered, err := m.WebhookTrigger(scene.ID, map[string]interface{}{"event": map[string]interface{}{"type": "motion"}})
+	assert.Nil(t, err)
+	assert.False(t, triggered)
+
+	triggered, err = m.WebhookTrigger(scene.ID, map[string]interface{}{"event": map[string]interface{}{"type": "ring"}})
+	assert.Nil(t, err)
+	assert.True(t, triggered)
+	time.Sleep(2 * time.Second)
+
+	// 触发记录在场景的执行日志中
+	var log entity.TaskLog
+	err = entity.GetDB().Where("area_id=? and parent_task_id is null", area.ID).First(&log).Error
+	assert.Nil(t, err)
+	assert.Equal(t, scene.Name, log.Name)
+}
+
+// addUniqueDevice 添加 identity 不重复的设备，测试数据库不会清理
+func addUniqueDevice(t *testing.T) *entity.Device {
+	area := entity.Area{Name: "testing"}
+	assert.Nil(t, entity.GetDB().Create(&area).Error)
+	d := &entity.Device{
+		AreaID:       area.ID,
+		Name:         "testing device",
+		Identity:     fmt.Sprintf("testing_%d", time.Now().UnixNano()),
+		Manufacturer: "testing",
+		PluginID:     "testing",
+		CreatedAt:    time.Now(),
+	}
+	assert.Nil(t, entity.AddDevice(d, entity.GetDB()))
+	return d
+}
+
+func addAttrConditionScene(d *entity.Device, name string, c entity.SceneCondition) *entity.Scene {
+	c.ConditionType = entity.ConditionTypeDeviceStatus
+	c.DeviceID = d.ID
+	scene := &entity.Scene{
+		Name:            name,
+		AutoRun:         true,
+		IsOn:            true,
+		ConditionLogic:  entity.MatchAnyCondition,
+		RepeatType:      entity.RepeatTypeAllDay,
+		RepeatDate:      "1234567",
+		TimePeriodType:  entity.TimePeriodTypeAllDay,
+		CreatorID:       1,
+		CreatedAt:       time.Now(),
+		AreaID:          d.AreaID,
+		SceneConditions: []entity.SceneCondition{c},
+	}
+	db := entity.GetDB().Session(&gorm.Session{FullSaveAssociations: true}).Model(entity.Scene{})
+	_ = db.Create(scene).Error
+	return scene
+}
+
+func TestEdgeConditionUnchangedReport(t *testing.T) {
+	d := addUniqueDevice(t)
+	scene := addAttrConditionScene(d, "test_edge_condition", entity.SceneCondition{Operator: entity.OperatorChangedTo,
+		ConditionAttr: []byte(`{"instance_id":1,"attribute":"power","val":"on"}`)})
+	e := stateChanged(*d, "power", "on", "off")
+
+	m := NewLocalManager()
+	m.sceneAttrChange(*scene, e)
+	assert.Len(t, m.queue.removeScene(scene.ID), 1)
+	// 重复上报相同的值不再触发
+	m.sceneAttrChange(*scene, stateChanged(*d, "power", "on", "on"))
+	assert.Empty(t, m.queue.removeScene(scene.ID))
+}
+
+func TestDurationConditionRearm(t *testing.T) {
+	d := addUniqueDevice(t)
+	scene := addAttrConditionScene(d, "test_duration_condition", entity.SceneCondition{Operator: entity.OperatorEQ,
+		Duration: 300, ConditionAttr: []byte(`{"instance_id":1,"attribute":"power","val":"on"}`)})
+	key := conditionTaskKey(scene.ID, scene.SceneConditions[0].ID)
+
+	m := NewLocalManager()
+	// 状态变为满足条件时开始计时
+	m.sceneAttrChange(*scene, stateChanged(*d, "power", "on", "off"))
+	_, ok := m.durationTasks.Load(key)
+	assert.True(t, ok)
+	assert.Len(t, m.queue.removeScene(scene.ID), 1)
+
+	// 计时结束后，状态保持不变的重复上报不重新计时
+	m.durationTasks.Delete(key)
+	m.sceneAttrChange(*scene, stateChanged(*d, "power", "on", "on"))
+	_, ok = m.durationTasks.Load(key)
+	assert.False(t, ok)
+	assert.Empty(t, m.queue.removeScene(scene.ID))
+
+	// 状态变为不满足后再次满足，重新计时
+	m.sceneAttrChange(*scene, stateChanged(*d, "power", "off", "on"))
+	m.sceneAttrChange(*scene, stateChanged(*d, "power", "on", "off"))
+	_, ok = m.durationTasks.Load(key)
+	assert.True(t, ok)
+	assert.Len(t, m.queue.removeScene(scene.ID), 1)
+}
+
+// stateChanged 设备属性由 previous 变为 val 的上报事件
+func stateChanged(d entity.Device, attribute string, val, previous interface{}) event.DeviceStateChanged {
+	return event.DeviceStateChanged{
+		Device:   d,
+		Attr:     entity.Attribute{Attribute: server.Attribute{Attribute: attribute, Val: val}, InstanceID: 1},
+		Previous: previous,
+		Changed:  val != previous,
+	}
+}
+
+func TestQueuedRunLog(t *testing.T) {
+	area := entity.Area{Name: "test_queued_run_log"}
+	assert.Nil(t, entity.GetDB().Create(&area).Error)
+	target := &entity.Scene{Name: "test_queued_run_log_target", CreatorID: 1, CreatedAt: time.Now(), AreaID: area.ID}
+	assert.Nil(t, entity.GetDB().Create(target).Error)
+	scene := &entity.Scene{
+		Name:      "test_queued_run_log",
+		CreatorID: 1,
+		CreatedAt: time.Now(),
+		AreaID:    area.ID,
+		Mode:      entity.SceneModeQueued,
+		SceneTasks: []entity.SceneTask{
+			{Type: entity.TaskTypeManualRun, ControlSceneID: target.ID, DelaySeconds: 60},
+		},
+	}
+	db := entity.GetDB().Session(&gorm.Session{FullSaveAssociations: true}).Model(entity.Scene{})
+	assert.Nil(t, db.Create(scene).Error)
+
+	m := NewLocalManager()
+	result := func(taskID string) entity.TaskResultType {
+		var log entity.TaskLog
+		assert.Nil(t, entity.GetDB().Where("task_id=?", taskID).First(&log).Error)
+		return log.Result
+	}
+	first := NewTask(m.wrapSceneFunc(*scene), 0).WithScene(scene.ID)
+	m.pushTask(first, *scene)
+	second := NewTask(m.wrapSceneFunc(*scene), 0).WithScene(scene.ID)
+	m.pushTask(second, *scene)
+	assert.Len(t, m.queue.removeScene(scene.ID), 2)
+	first.Run()
+	second.Run()
+	assert.Equal(t, entity.TaskSuccess, result(first.ID))
+	// 排队中的执行未结束
+	assert.Equal(t, entity.TaskResultType(0), result(second.ID))
+
+	// 取消时排队的执行记录为已取消
+	m.CancelSceneTask(scene.ID)
+	assert.Equal(t, entity.TaskCanceled, result(second.ID))
+	_, running := m.getSceneRuns(scene.ID).pending[first.ID]
+	assert.False(t, running)
+
+	// 恢复的延时任务记录到所属的执行中
+	run := NewTask(nil, 0).WithScene(scene.ID)
+	delayed := NewTask(nil, time.Minute).WithParent(run)
+	assert.Nil(t, saveQueuedTask(delayed, scene.SceneTasks[0]))
+	m.restoreQueuedTasks()
+	assert.Equal(t, 1, m.getSceneRuns(scene.ID).pending[run.ID])
+	m.DeleteSceneTask(scene.ID)
+	_, running = m.getSceneRuns(scene.ID).pending[run.ID]
+	assert.False(t, running)
+}
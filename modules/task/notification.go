@@ -0,0 +1,169 @@
+package task
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+const (
+	// AlertEventType 推送提醒的事件类型
+	AlertEventType = "scene_alert"
+
+	webhookTimeout = 10 * time.Second
+	// SignatureHeader webhook 请求内容的签名，格式为 sha256=hex(hmac_sha256(secret, timestamp + "." + body))
+	SignatureHeader = "X-SA-Signature"
+	// TimestampHeader webhook 请求的时间戳，用于签名及防止重放
+	TimestampHeader = "X-SA-Timestamp"
+)
+
+// Notifier 向家庭中的用户推送事件，由 websocket 服务实现
+type Notifier interface {
+	NotifyUsers(areaID uint64, userIDs []int, eventType string, data map[string]interface{}) error
+}
+
+var (
+	notifier      Notifier
+	webhookClient = &http.Client{Timeout: webhookTimeout}
+)
+
+// SetNotifier 设置推送提醒使用的 Notifier
+func SetNotifier(n Notifier) {
+	notifier = n
+}
+
+// NotificationPayload 通知的内容，webhook 请求及提醒事件的数据
+type NotificationPayload struct {
+	Message string `json:"message"`
+	entity.NotificationData
+}
+
+// newNotificationPayload 按场景及触发场景的设备状态或 webhook 请求生成通知内容
+func newNotificationPayload(sceneTask entity.SceneTask, n entity.Notification, t *Task) (payload NotificationPayload, areaID uint64, err error) {
+	scene, err := entity.GetSceneByIDWithUnscoped(sceneTask.SceneID)
+	if err != nil {
+		return
+	}
+	areaID = scene.AreaID
+	payload.NotificationData = entity.NotificationData{
+		SceneID: scene.ID,
+		Scene:   scene.Name,
+		Time:    time.Now().Unix(),
+	}
+	if trigger := rootTask(t).trigger; trigger != nil {
+		payload.Payload = trigger.Payload
+		if trigger.DeviceID != 0 {
+			payload.DeviceID = trigger.DeviceID
+			payload.InstanceID = trigger.Attr.InstanceID
+			payload.Attribute = trigger.Attr.Attribute.Attribute
+			payload.Val = trigger.Attr.Val
+			if device, e := entity.GetDeviceByIDWithUnscoped(trigger.DeviceID); e == nil {
+				payload.Device = device.Name
+			}
+		}
+	}
+	payload.Message, err = n.Render(payload.NotificationData)
+	return
+}
+
+// sendWebhook 发送 webhook 请求，失败时按配置的次数重试，重试间隔依次加倍
+func sendWebhook(sceneTask entity.SceneTask, t *Task) (err error) {
+	n, err := sceneTask.GetNotification()
+	if err != nil {
+		return
+	}
+	payload, _, err := newNotificationPayload(sceneTask, n, t)
+	if err != nil {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, errors.InternalServerErr)
+	}
+
+	var retryable bool
+	for i := 0; i <= n.Retries; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(1<<(i-1)) * time.Second)
+		}
+		if retryable, err = postWebhook(n, body); err == nil || !retryable {
+			break
+		}
+		logger.Warnf("send webhook %s err: %v", n.URL, err)
+	}
+	if err != nil {
+		return errors.Wrapf(err, status.NotificationSendErr, err.Error())
+	}
+	return
+}
+
+// postWebhook 发送一次 webhook 请求，网络错误、服务端错误及请求过多时可以重试
+func postWebhook(n entity.Notification, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+SignWebhook(n.Secret, timestamp, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retryable = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retryable, fmt.Errorf("webhook response status %d", resp.StatusCode)
+	}
+	return
+}
+
+// SignWebhook 计算 webhook 请求内容的签名
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendAlert 向家庭中的用户推送提醒
+func sendAlert(sceneTask entity.SceneTask, t *Task) (err error) {
+	if notifier == nil {
+		return errors.Newf(status.NotificationSendErr, "推送服务未启动")
+	}
+	n, err := sceneTask.GetNotification()
+	if err != nil {
+		return
+	}
+	payload, areaID, err := newNotificationPayload(sceneTask, n, t)
+	if err != nil {
+		return
+	}
+	var data map[string]interface{}
+	b, _ := json.Marshal(payload)
+	if err = json.Unmarshal(b, &data); err != nil {
+		return errors.Wrap(err, errors.InternalServerErr)
+	}
+	if err = notifier.NotifyUsers(areaID, n.UserIDs, AlertEventType, data); err != nil {
+		return errors.Wrapf(err, status.NotificationSendErr, err.Error())
+	}
+	return
+}
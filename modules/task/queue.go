@@ -64,12 +64,16 @@ type queueServe struct {
 	mu     sync.Mutex
 	ticker *time.Ticker
 	pq     priorityQueue
+
+	// sceneTasks 场景id -> 队列中属于该场景的任务（包括触发任务和延时执行的子任务）
+	sceneTasks map[int]map[*Task]struct{}
 }
 
 func (qs *queueServe) init() {
 	items := make(map[string]int)
 	qs.pq = make(priorityQueue, len(items))
 	heap.Init(&qs.pq)
+	qs.sceneTasks = make(map[int]map[*Task]struct{})
 	qs.ticker = time.NewTicker(defaultTickTime)
 }
 
@@ -81,23 +85,105 @@ func (qs *queueServe) push(task *Task) {
 func (qs *queueServe) _push(task *Task) {
 	qs.mu.Lock()
 	heap.Push(&qs.pq, task)
+	qs.indexTask(task)
 	qs.mu.Unlock()
 }
 
 func (qs *queueServe) _pop() *Task {
 	qs.mu.Lock()
 	defer qs.mu.Unlock()
-	return heap.Pop(&qs.pq).(*Task)
+	task := heap.Pop(&qs.pq).(*Task)
+	qs.unindexTask(task)
+	return task
+}
 
+// _popDue 取出到达执行时间的任务，没有时返回队首任务的执行时间
+func (qs *queueServe) _popDue(at int64) (task *Task, next int64) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if qs.pq.Len() == 0 {
+		return
+	}
+	if qs.pq[0].Priority > at {
+		return nil, qs.pq[0].Priority
+	}
+	task = heap.Pop(&qs.pq).(*Task)
+	qs.unindexTask(task)
+	return
 }
 
 func (qs *queueServe) _remove(i int) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
 	if i < 0 || i >= qs.pq.Len() {
 		return
 	}
+	task := heap.Remove(&qs.pq, i).(*Task)
+	qs.unindexTask(task)
+}
+
+// remove 从队列中移除任务，任务不在队列中时不处理
+func (qs *queueServe) remove(task *Task) {
 	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	i := task.index
+	if i < 0 || i >= qs.pq.Len() || qs.pq[i] != task {
+		return
+	}
 	heap.Remove(&qs.pq, i)
-	qs.mu.Unlock()
+	qs.unindexTask(task)
+}
+
+// removeScene 从队列中移除场景的所有任务，返回被移除的任务
+func (qs *queueServe) removeScene(sceneID int) (tasks []*Task) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	for task := range qs.sceneTasks[sceneID] {
+		heap.Remove(&qs.pq, task.index)
+		tasks = append(tasks, task)
+	}
+	delete(qs.sceneTasks, sceneID)
+	return
+}
+
+// removeSceneRunning 从队列中移除场景正在执行中的子任务，返回被移除的任务
+func (qs *queueServe) removeSceneRunning(sceneID int) (tasks []*Task) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	for task := range qs.sceneTasks[sceneID] {
+		if task.Parent == nil {
+			continue
+		}
+		heap.Remove(&qs.pq, task.index)
+		qs.unindexTask(task)
+		tasks = append(tasks, task)
+	}
+	return
+}
+
+// indexTask 记录场景的任务，需持有锁
+func (qs *queueServe) indexTask(task *Task) {
+	if task.sceneID == 0 {
+		return
+	}
+	tasks, ok := qs.sceneTasks[task.sceneID]
+	if !ok {
+		tasks = make(map[*Task]struct{})
+		qs.sceneTasks[task.sceneID] = tasks
+	}
+	tasks[task] = struct{}{}
+}
+
+// unindexTask 删除场景任务的记录，需持有锁
+func (qs *queueServe) unindexTask(task *Task) {
+	tasks, ok := qs.sceneTasks[task.sceneID]
+	if !ok {
+		return
+	}
+	delete(tasks, task)
+	if len(tasks) == 0 {
+		delete(qs.sceneTasks, task.sceneID)
+	}
 }
 
 func (qs *queueServe) _len() int {
@@ -115,21 +201,17 @@ func (qs *queueServe) start(ctx context.Context) {
 		select {
 		case ct := <-ticker.C:
 			logger.Debugf("current ticket at: %d:%d:%d", ct.Hour(), ct.Minute(), ct.Second())
-			if qs._len() == 0 {
-				ticker.Reset(sleepTickTime)
-				continue
-			}
-			task := qs._pop()
 			now := time.Now()
-			timeAt := now.Unix()
-
-			if task.Priority > timeAt {
-				nextTick := time.Unix(task.Priority, 0).Sub(now)
-				ticker.Reset(nextTick)
-				qs._push(task)
-			} else {
+			// 未到执行时间的任务留在队列中，以便随时可以被移除
+			task, next := qs._popDue(now.Unix())
+			switch {
+			case task != nil:
 				ticker.Reset(defaultTickTime)
 				go task.Run()
+			case next == 0: // 队列为空
+				ticker.Reset(sleepTickTime)
+			default:
+				ticker.Reset(time.Unix(next, 0).Sub(now))
 			}
 		case <-ctx.Done():
 			logger.Info("stopping task queue")
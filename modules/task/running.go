@@ -0,0 +1,142 @@
+package task
+
+import (
+	"sync"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+// queuedRun queued 模式下等待执行的场景
+type queuedRun struct {
+	scene entity.Scene
+	task  *Task
+}
+
+// sceneRuns 场景正在进行的执行
+type sceneRuns struct {
+	mu sync.Mutex
+	// pending 执行的任务id -> 未结束的子任务数
+	pending map[string]int
+	queued  []queuedRun
+}
+
+func (r *sceneRuns) add(runID string) {
+	r.mu.Lock()
+	r.pending[runID]++
+	r.mu.Unlock()
+}
+
+// done 结束一个子任务，该次执行的子任务都结束时返回下一个排队的执行
+func (r *sceneRuns) done(runID string) (next *queuedRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.pending[runID]
+	if !ok {
+		return
+	}
+	if n > 1 {
+		r.pending[runID] = n - 1
+		return
+	}
+	delete(r.pending, runID)
+	if len(r.pending) == 0 && len(r.queued) != 0 {
+		next = &r.queued[0]
+		r.queued = r.queued[1:]
+		// 在释放锁前占用执行，避免新的触发插队
+		r.pending[next.task.ID] = 1
+	}
+	return
+}
+
+// clearQueued 清除排队的执行，返回被清除的执行
+func (r *sceneRuns) clearQueued() (queued []queuedRun) {
+	r.mu.Lock()
+	queued, r.queued = r.queued, nil
+	r.mu.Unlock()
+	return
+}
+
+func (m *LocalManager) getSceneRuns(sceneID int) *sceneRuns {
+	v, _ := m.runningScene.LoadOrStore(sceneID, &sceneRuns{pending: make(map[string]int)})
+	return v.(*sceneRuns)
+}
+
+// startSceneRun 按场景的执行模式开始一次执行，不执行时返回错误记录到日志
+func (m *LocalManager) startSceneRun(scene entity.Scene, t *Task) error {
+	mode := scene.GetMode()
+	// 取消正在进行的执行后重新执行
+	if mode == entity.SceneModeRestart {
+		m.CancelSceneTask(scene.ID)
+	}
+
+	runs := m.getSceneRuns(scene.ID)
+	runs.mu.Lock()
+	running := len(runs.pending)
+	switch {
+	case mode == entity.SceneModeSingle && running > 0,
+		mode == entity.SceneModeParallel && running >= scene.GetMaxRuns():
+		runs.mu.Unlock()
+		logger.Infof("scene %d is running in %s mode, ignore", scene.ID, mode)
+		return errors.New(status.SceneRunSkipped)
+	case mode == entity.SceneModeQueued && running > 0:
+		defer runs.mu.Unlock()
+		if len(runs.queued) >= scene.GetMaxRuns() {
+			logger.Infof("scene %d queued runs reach the limit, ignore", scene.ID)
+			return errors.New(status.SceneRunSkipped)
+		}
+		runs.queued = append(runs.queued, queuedRun{scene: scene, task: t})
+		// 开始执行或取消时再更新日志
+		return errStepPending
+	}
+	runs.mu.Unlock()
+
+	m.runScene(scene, t)
+	return nil
+}
+
+// finishSceneRun 结束场景执行的一个子任务，执行结束后开始排队中的下一次执行
+func (m *LocalManager) finishSceneRun(sceneID int, runID string) {
+	next := m.getSceneRuns(sceneID).done(runID)
+	if next == nil {
+		return
+	}
+	logger.Infof("scene %d start queued run %s", sceneID, next.task.ID)
+	m.runScene(next.scene, next.task)
+	if err := entity.UpdateTaskLog(next.task.ID, nil); err != nil {
+		logger.Error(err)
+	}
+	m.finishSceneRun(sceneID, next.task.ID)
+}
+
+// sceneRunWrapper 子任务结束后更新场景的执行状态
+func (m *LocalManager) sceneRunWrapper(sceneID int, runID string) WrapperFunc {
+	return func(f TaskFunc) TaskFunc {
+		return func(task *Task) error {
+			defer m.finishSceneRun(sceneID, runID)
+			return f(task)
+		}
+	}
+}
+
+// cancelQueuedRuns 取消场景排队中的执行，日志记录为已取消
+func (m *LocalManager) cancelQueuedRuns(sceneID int) {
+	for _, run := range m.getSceneRuns(sceneID).clearQueued() {
+		logUnrunTask(run.task, errors.New(status.SceneTaskCanceled))
+	}
+}
+
+// cancelTasks 取消已从队列中移除的任务
+func (m *LocalManager) cancelTasks(tasks []*Task) {
+	for _, t := range tasks {
+		if err := entity.DeleteQueuedTask(t.ID); err != nil {
+			logger.Error(err)
+		}
+		logUnrunTask(t, errors.New(status.SceneTaskCanceled))
+		if t.Parent != nil {
+			m.finishSceneRun(t.sceneID, rootTask(t).ID)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package task
+
+import (
+	errors2 "errors"
+	"sync"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+// waitPollInterval 等待步骤检查设备状态的间隔
+const waitPollInterval = time.Second
+
+// errStepPending 步骤未结束，任务已重新加入队列；或场景的执行在排队中，结束时再更新日志
+var errStepPending = errors2.New("step pending")
+
+// wrapStepToFunc 包装流程控制步骤为 TaskFunc，嵌套的步骤作为该任务的子任务加入队列，
+// 日志记录在该任务下
+func (m *LocalManager) wrapStepToFunc(step entity.SceneTask) TaskFunc {
+	var deadline time.Time // 等待步骤的超时时间，第一次执行时开始计时
+	return func(t *Task) error {
+		logger.Infof("execute step:%d,type:%d", step.ID, step.Type)
+		now := time.Now()
+		switch step.Type {
+		case entity.TaskTypeIf:
+			satisfied, err := isStepConditionSatisfied(step)
+			if err != nil {
+				return err
+			}
+			if satisfied {
+				return m.pushStepBranch(step.GetThen, t, now)
+			}
+			return m.pushStepBranch(step.GetElse, t, now)
+		case entity.TaskTypeWait:
+			if deadline.IsZero() {
+				deadline = now.Add(time.Duration(step.TimeoutSeconds) * time.Second)
+			}
+			satisfied, err := isStepConditionSatisfied(step)
+			if err != nil {
+				return err
+			}
+			if satisfied {
+				return m.pushStepBranch(step.GetThen, t, now)
+			}
+			if !now.Before(deadline) {
+				if err = m.pushStepBranch(step.GetElse, t, now); err != nil {
+					return err
+				}
+				return errors.New(status.SceneWaitTimeout)
+			}
+			// 不阻塞执行任务的协程，稍后重新加入队列检查
+			m.getSceneRuns(t.sceneID).add(rootTask(t).ID)
+			t.iteration.add()
+			t.Priority = now.Add(waitPollInterval).Unix()
+			m.queue.push(t)
+			return errStepPending
+		case entity.TaskTypeRepeat:
+			steps, err := step.GetThen()
+			if err != nil {
+				return err
+			}
+			// 所有次数执行完重复步骤才结束，所属的外层重复步骤等待其结束
+			t.iteration.add()
+			m.pushRepeat(step, steps, t, 0, now)
+		}
+		return nil
+	}
+}
+
+// iteration 重复步骤的一次执行，记录未结束的任务数（包括嵌套步骤的任务），都结束后执行 onDone
+type iteration struct {
+	mu      sync.Mutex
+	pending int
+	onDone  func()
+}
+
+func (it *iteration) add() {
+	if it == nil {
+		return
+	}
+	it.mu.Lock()
+	it.pending++
+	it.mu.Unlock()
+}
+
+// done 结束一个任务，全部结束时执行 onDone
+func (it *iteration) done() {
+	if it == nil {
+		return
+	}
+	it.mu.Lock()
+	it.pending--
+	finished := it.pending == 0
+	it.mu.Unlock()
+	if finished {
+		it.onDone()
+	}
+}
+
+// iterationWrapper 任务结束后更新所属的重复步骤的执行状态，
+// 需要在更新场景的执行状态前执行，使下一次执行的任务在场景的执行结束前加入队列
+func iterationWrapper(f TaskFunc) TaskFunc {
+	return func(task *Task) error {
+		defer task.iteration.done()
+		return f(task)
+	}
+}
+
+// pushRepeat 执行重复步骤 t 的第 i 次，在 start 开始执行；上一次的任务都结束后，间隔 interval_seconds 秒开始下一次，
+// 避免任务的延时或等待步骤超过间隔时多次执行相互重叠
+func (m *LocalManager) pushRepeat(step entity.SceneTask, steps []entity.SceneTask, t *Task, i int, start time.Time) {
+	if i >= step.RepeatTimes {
+		t.iteration.done()
+		return
+	}
+	interval := time.Duration(step.IntervalSeconds) * time.Second
+	it := &iteration{onDone: func() {
+		m.pushRepeat(step, steps, t, i+1, time.Now().Add(interval))
+	}}
+	// 加入任务期间占用，避免任务还未全部加入队列时就已结束
+	it.add()
+	m.pushSceneTasks(steps, t, rootTask(t).ID, start, false, it)
+	it.done()
+}
+
+// pushStepBranch 将步骤的一个分支作为 t 的子任务加入队列
+func (m *LocalManager) pushStepBranch(branch func() ([]entity.SceneTask, error), t *Task, start time.Time) error {
+	steps, err := branch()
+	if err != nil {
+		return err
+	}
+	m.pushSceneTasks(steps, t, rootTask(t).ID, start, false, t.iteration)
+	return nil
+}
+
+// isStepConditionSatisfied 判断设备当前的状态是否满足步骤的条件
+func isStepConditionSatisfied(step entity.SceneTask) (bool, error) {
+	condition, err := step.GetCondition()
+	if err != nil {
+		return false, err
+	}
+	return IsConditionSatisfied(condition), nil
+}
@@ -1,15 +1,11 @@
 package task
 
 import (
-	"encoding/json"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
-	"github.com/zhiting-tech/smartassistant/modules/plugin"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
 )
 
@@ -29,6 +25,20 @@ type Task struct {
 	f        TaskFunc
 	Parent   *Task // 父任务
 	wrappers []WrapperFunc
+
+	sceneID int         // 任务所属的场景，子任务与父任务相同
+	target  interface{} // 任务执行的对象，用于记录日志
+	logged  bool        // 是否已插入日志，重新加入队列的任务不再重复插入
+	trigger *Trigger    // 触发场景执行的设备状态或 webhook 请求
+
+	iteration *iteration // 任务所属的重复步骤的一次执行，不在重复步骤中时为 nil
+}
+
+// Trigger 触发场景执行的设备状态或 webhook 请求
+type Trigger struct {
+	DeviceID int
+	Attr     entity.Attribute
+	Payload  map[string]interface{} // webhook 请求内容
 }
 
 // NewTaskAt 按运行时间点创建任务
@@ -49,6 +59,25 @@ func NewTask(f TaskFunc, delay time.Duration) *Task {
 // WithParent 设置父任务
 func (item *Task) WithParent(parent *Task) *Task {
 	item.Parent = parent
+	item.sceneID = parent.sceneID
+	return item
+}
+
+// WithScene 设置任务所属的场景
+func (item *Task) WithScene(sceneID int) *Task {
+	item.sceneID = sceneID
+	return item
+}
+
+// WithTrigger 设置触发场景执行的设备状态
+func (item *Task) WithTrigger(deviceID int, attr entity.Attribute) *Task {
+	item.trigger = &Trigger{DeviceID: deviceID, Attr: attr}
+	return item
+}
+
+// WithPayload 设置触发场景执行的 webhook 请求内容
+func (item *Task) WithPayload(payload map[string]interface{}) *Task {
+	item.trigger = &Trigger{Payload: payload}
 	return item
 }
 
@@ -91,10 +120,17 @@ func taskLogWrapper(target interface{}) WrapperFunc {
 			// if s, ok := target.(entity.Scene); ok { // 记录场景正在执行的task的index
 			//	MinHeapQueue.SceneTaskIndexMap.Store(s.ID, task.index)
 			// }
-			if err := entity.NewTaskLog(target, task.ID, parentID); err != nil {
-				logger.Error("NewTaskLogErr:", err)
+			if !task.logged {
+				if err := entity.NewTaskLog(target, task.ID, parentID); err != nil {
+					logger.Error("NewTaskLogErr:", err)
+				}
+				task.logged = true
 			}
 			err := f(task)
+			// 步骤未结束或场景的执行在排队中，结束时再更新日志
+			if err == errStepPending {
+				return nil
+			}
 			if e := entity.UpdateTaskLog(task.ID, err); e != nil {
 				logger.Error(e)
 			}
@@ -103,101 +139,66 @@ func taskLogWrapper(target interface{}) WrapperFunc {
 	}
 }
 
-// IsConditionsSatisfied 场景条件是否满足 isTrigByTimer 是否由定时条件触发
-func IsConditionsSatisfied(scene entity.Scene, isTrigByTimer bool) bool {
-	if !scene.IsOn {
-		logger.Debugf("scene %d: is off\n", scene.ID)
-		return false
-	}
-	if !IsInTimePeriod(scene) { // 不在有效时间段内则不执行
-		logger.Debugf("scene %d: not in effective time period\n", scene.ID)
-		return false
-	}
-	// “任一满足”情况下，定时触发的任务直接满足条件
-	if !scene.IsMatchAllCondition() && isTrigByTimer {
-		return true
-	}
-	for _, condition := range scene.SceneConditions {
-		if condition.ConditionType == entity.ConditionTypeTiming {
-			continue
-		}
-
-		// 任一满足
-		if !scene.IsMatchAllCondition() && IsConditionSatisfied(condition) {
-			logger.Debugf("scene %d: condition:%d satisfied\n", scene.ID, condition.ID)
-			return true
-		}
-		// 全部满足（有一个不满足）
-		if scene.IsMatchAllCondition() && !IsConditionSatisfied(condition) {
-			logger.Debugf("scene %d: condition:%d not satisfied\n", scene.ID, condition.ID)
-			return false
-		}
+// rootTask 获取任务最上层的父任务，场景执行任务的子任务及嵌套的步骤返回该次执行的任务
+func rootTask(task *Task) *Task {
+	for task.Parent != nil {
+		task = task.Parent
 	}
-
-	logger.Debugf("scene.ID %d, scene.ConditionLogic %d \n", scene.ID, scene.ConditionLogic)
-	return scene.IsMatchAllCondition()
+	return task
 }
 
-// IsInTimePeriod 是否在时间段内
-func IsInTimePeriod(scene entity.Scene) bool {
-
-	weekday := time.Now().Weekday()
-	if !strings.Contains(scene.RepeatDate, strconv.Itoa(int(weekday))) {
-		logger.Debugf("scene %d: today not in repeat date\n", scene.ID)
-		return false
-	}
-
-	if scene.TimePeriodType == entity.TimePeriodTypeCustom {
-		days := int(time.Now().Sub(scene.EffectStart).Hours() / 24)
-		effectEndTime := scene.EffectEnd.AddDate(0, 0, days)
-		effectStartTime := scene.EffectStart.AddDate(0, 0, days)
-		return time.Now().Before(effectEndTime) && time.Now().After(effectStartTime)
-	}
-	return true
+// isScalarEqual 两个属性值是否相等，只比较标量，对象和数组（如 webhook 请求内容中的字段）不相等
+func isScalarEqual(val, target interface{}) bool {
+	return entity.IsScalarVal(val) && entity.IsScalarVal(target) && val == target
 }
 
-// IsConditionSatisfied 判断设备状态是否满足条件
-func IsConditionSatisfied(condition entity.SceneCondition) bool {
-	if condition.ConditionType == entity.ConditionTypeTiming {
-		return false
-	}
-
-	device, err := entity.GetDeviceByID(condition.DeviceID)
-	if err != nil {
-		logger.Errorf("get device %d err:%v\n", condition.DeviceID, err)
-		return false
-	}
-
-	var item entity.Attribute
-	if err = json.Unmarshal(condition.ConditionAttr, &item); err != nil {
-		logger.Error("Unmarshal error:", err)
-		return false
-	}
-	attribute, err := plugin.GetControlAttributeByID(device, item.InstanceID, item.Attribute.Attribute)
-	if err != nil {
-		logger.Error("GetAttribute error:", err)
-		return false
-	}
-	val := attribute.Val
-	logger.Debugf("%v %s %v\n", val, condition.Operator, item.Val)
-	switch condition.Operator {
+// isValSatisfied 判断属性值是否满足条件
+func isValSatisfied(operator entity.OperatorType, val, target interface{}) bool {
+	logger.Debugf("%v %s %v\n", val, operator, target)
+	switch operator {
 	case entity.OperatorEQ:
-		return val == item.Val
+		return isScalarEqual(val, target)
+	case entity.OperatorNE:
+		return entity.IsScalarVal(val) && entity.IsScalarVal(target) && val != target
+	case entity.OperatorIn:
+		targets, ok := target.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, t := range targets {
+			if isScalarEqual(val, t) {
+				return true
+			}
+		}
+		return false
+	case entity.OperatorBetween:
+		targets, ok := target.([]interface{})
+		if !ok || len(targets) != 2 {
+			return false
+		}
+		v, ok := val.(float64)
+		min, ok1 := targets[0].(float64)
+		max, ok2 := targets[1].(float64)
+		return ok && ok1 && ok2 && v >= min && v <= max
 	case entity.OperatorGT:
 		switch val.(type) {
 		case int:
-			return val.(int) > item.Val.(int)
+			t, ok := target.(int)
+			return ok && val.(int) > t
 		case float64:
-			return val.(float64) > item.Val.(float64)
+			t, ok := target.(float64)
+			return ok && val.(float64) > t
 		default:
 			return false
 		}
 	case entity.OperatorLT:
 		switch val.(type) {
 		case int:
-			return val.(int) < item.Val.(int)
+			t, ok := target.(int)
+			return ok && val.(int) < t
 		case float64:
-			return val.(float64) < item.Val.(float64)
+			t, ok := target.(float64)
+			return ok && val.(float64) < t
 		default:
 			return false
 		}
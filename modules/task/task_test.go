@@ -2,6 +2,10 @@ package task
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
@@ -9,7 +13,13 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/zhiting-tech/smartassistant/modules/config"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/plugin"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	errors2 "github.com/zhiting-tech/smartassistant/pkg/errors"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
+	"github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/server"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
 )
 
 func TestMain(m *testing.M) {
@@ -130,3 +140,374 @@ func TestTaskWithWrapper(t *testing.T) {
 	assert.True(t, tFuncRun, "task not run")
 	assert.True(t, tFuncWrapRun, "wrapper not run")
 }
+
+func TestQueueRemove(t *testing.T) {
+	qs := newQueueServe()
+	f := func(task *Task) error { return nil }
+	t1 := NewTask(f, time.Hour)
+	t2 := NewTask(f, 2*time.Hour)
+	qs.push(t1)
+	qs.push(t2)
+
+	qs.remove(t1)
+	assert.Equal(t, 1, qs._len())
+	// 已移除的任务再次移除不影响队列
+	qs.remove(t1)
+	assert.Equal(t, 1, qs._len())
+	assert.Equal(t, t2, qs._pop())
+}
+
+func TestIsValSatisfied(t *testing.T) {
+	assert.True(t, isValSatisfied(entity.OperatorEQ, "on", "on"))
+	assert.False(t, isValSatisfied(entity.OperatorEQ, "on", "off"))
+	assert.True(t, isValSatisfied(entity.OperatorGT, float64(30), float64(25)))
+	assert.False(t, isValSatisfied(entity.OperatorLT, float64(30), float64(25)))
+	// 类型不一致时不满足
+	assert.False(t, isValSatisfied(entity.OperatorGT, float64(30), "25"))
+
+	assert.True(t, isValSatisfied(entity.OperatorNE, "on", "off"))
+	assert.False(t, isValSatisfied(entity.OperatorNE, "on", "on"))
+	between := []interface{}{float64(20), float64(26)}
+	assert.True(t, isValSatisfied(entity.OperatorBetween, float64(20), between))
+	assert.True(t, isValSatisfied(entity.OperatorBetween, float64(26), between))
+	assert.False(t, isValSatisfied(entity.OperatorBetween, float64(27), between))
+	in := []interface{}{"cool", "heat"}
+	assert.True(t, isValSatisfied(entity.OperatorIn, "heat", in))
+	assert.False(t, isValSatisfied(entity.OperatorIn, "auto", in))
+
+	// 对象和数组不可比较，不满足条件
+	obj := map[string]interface{}{"type": "ring"}
+	arr := []interface{}{"ring"}
+	assert.False(t, isValSatisfied(entity.OperatorEQ, obj, obj))
+	assert.False(t, isValSatisfied(entity.OperatorEQ, arr, arr))
+	assert.False(t, isValSatisfied(entity.OperatorNE, obj, map[string]interface{}{}))
+	assert.False(t, isValSatisfied(entity.OperatorIn, obj, []interface{}{obj}))
+}
+
+func TestShadowPrevious(t *testing.T) {
+	shadow := entity.NewShadow()
+	attr := server.Attribute{Attribute: "power", Val: "off"}
+	shadow.UpdateReported(1, attr)
+	_, ok := shadow.GetPrevious(1, "power")
+	assert.False(t, ok)
+
+	attr.Val = "on"
+	shadow.UpdateReported(1, attr)
+	// 值未变化时保留变化前的值
+	shadow.UpdateReported(1, attr)
+	previous, ok := shadow.GetPrevious(1, "power")
+	assert.True(t, ok)
+	assert.Equal(t, "off", previous)
+}
+
+func TestQueueRemoveScene(t *testing.T) {
+	qs := newQueueServe()
+	f := func(task *Task) error { return nil }
+	trigger := NewTask(f, time.Hour).WithScene(1)
+	child := NewTask(f, time.Hour).WithParent(trigger)
+	other := NewTask(f, time.Hour).WithScene(2)
+	qs.push(trigger)
+	qs.push(child)
+	qs.push(other)
+
+	// 仅移除执行中的子任务
+	tasks := qs.removeSceneRunning(1)
+	assert.Equal(t, []*Task{child}, tasks)
+	assert.Equal(t, 2, qs._len())
+
+	tasks = qs.removeScene(1)
+	assert.Equal(t, []*Task{trigger}, tasks)
+	assert.Equal(t, 1, qs._len())
+	assert.Empty(t, qs.removeScene(1))
+
+	// 未到执行时间的任务不会被取出
+	task, next := qs._popDue(time.Now().Unix())
+	assert.Nil(t, task)
+	assert.Equal(t, other.Priority, next)
+}
+
+func TestDryRunScene(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.Local)
+	scene := entity.Scene{
+		AutoRun:        true,
+		IsOn:           true,
+		ConditionLogic: entity.MatchAllCondition,
+		RepeatDate:     "01234567",
+		SceneConditions: []entity.SceneCondition{
+			{ID: 1, ConditionType: entity.ConditionTypeDeviceStatus, DeviceID: 1, Operator: entity.OperatorEQ,
+				ConditionAttr: []byte(`{"instance_id":1,"attribute":"power","val":"on"}`), Duration: 60},
+		},
+		SceneTasks: []entity.SceneTask{
+			{Type: entity.TaskTypeDisableAutoRun, ControlSceneID: 2, DelaySeconds: 10},
+			{Type: entity.TaskTypeSmartDevice, DeviceID: 3, Attributes: []byte(`[{"instance_id":1,"attribute":"power","val":"off"}]`)},
+		},
+	}
+	shadow := entity.NewShadow()
+	shadow.SetReported(1, server.Attribute{Attribute: "power", Val: "on"}, "off", now.Add(-30*time.Second))
+	env := ConditionEnv{Now: now, Shadows: map[int]entity.Shadow{1: shadow}}
+
+	// 状态持续时间不足
+	result, err := DryRunScene(env, scene)
+	assert.Nil(t, err)
+	assert.True(t, result.InTimePeriod)
+	assert.False(t, result.WillRun)
+
+	env.Now = now.Add(30 * time.Second)
+	result, err = DryRunScene(env, scene)
+	assert.Nil(t, err)
+	assert.True(t, result.WillRun)
+	assert.Len(t, result.Actions, 2)
+	assert.Equal(t, 3, result.Actions[0].DeviceID)
+	assert.Equal(t, "off", result.Actions[0].Attributes[0].Val)
+	assert.Equal(t, 2, result.Actions[1].ControlSceneID)
+	assert.Equal(t, env.Now.Add(10*time.Second).Unix(), result.Actions[1].ExecuteAt)
+}
+
+func TestDryRunSceneSteps(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.Local)
+	condition := []byte(`{"device_id":1,"operator":"=","condition_attr":{"instance_id":1,"attribute":"power","val":"on"}}`)
+	powerOff := `{"type":1,"device_id":3,"attributes":[{"instance_id":1,"attribute":"power","val":"off"}]}`
+	scene := entity.Scene{
+		SceneTasks: []entity.SceneTask{
+			{Type: entity.TaskTypeIf, Condition: condition,
+				Then: []byte(`[` + powerOff + `]`), Else: []byte(`[{"type":2,"control_scene_id":2}]`)},
+			{Type: entity.TaskTypeWait, DelaySeconds: 5, TimeoutSeconds: 60, Condition: condition,
+				Then: []byte(`[{"type":2,"control_scene_id":4}]`), Else: []byte(`[{"type":2,"control_scene_id":5}]`)},
+			{Type: entity.TaskTypeRepeat, RepeatTimes: 3, IntervalSeconds: 10, Then: []byte(`[` + powerOff + `]`)},
+		},
+	}
+	shadow := entity.NewShadow()
+	shadow.SetReported(1, server.Attribute{Attribute: "power", Val: "on"}, "off", now)
+	env := ConditionEnv{Now: now, Shadows: map[int]entity.Shadow{1: shadow}}
+
+	result, err := DryRunScene(env, scene)
+	assert.Nil(t, err)
+	var types []entity.TaskType
+	var delays []int
+	for _, action := range result.Actions {
+		types = append(types, action.Type)
+		delays = append(delays, action.DelaySeconds)
+	}
+	// 条件满足时执行 then，等待的状态已满足时立即执行 then
+	assert.Equal(t, []entity.TaskType{entity.TaskTypeIf, entity.TaskTypeSmartDevice, entity.TaskTypeRepeat,
+		entity.TaskTypeSmartDevice, entity.TaskTypeWait, entity.TaskTypeManualRun,
+		entity.TaskTypeSmartDevice, entity.TaskTypeSmartDevice}, types)
+	assert.Equal(t, []int{0, 0, 0, 0, 5, 5, 10, 20}, delays)
+	assert.True(t, *result.Actions[0].Satisfied)
+	assert.Equal(t, 4, result.Actions[5].ControlSceneID)
+
+	// 状态不满足时执行 else，等待超时后执行 else
+	shadow.SetReported(1, server.Attribute{Attribute: "power", Val: "off"}, "on", now)
+	result, err = DryRunScene(env, scene)
+	assert.Nil(t, err)
+	assert.False(t, *result.Actions[0].Satisfied)
+	assert.Equal(t, 2, result.Actions[1].ControlSceneID)
+	last := result.Actions[len(result.Actions)-1]
+	assert.Equal(t, 5, last.ControlSceneID)
+	assert.Equal(t, 65, last.DelaySeconds)
+
+	// 重复执行的任务有延时时，下一次在上一次结束后开始
+	scene.SceneTasks = []entity.SceneTask{
+		{Type: entity.TaskTypeRepeat, RepeatTimes: 3, IntervalSeconds: 10,
+			Then: []byte(`[{"type":2,"control_scene_id":2,"delay_seconds":30}]`)},
+	}
+	result, err = DryRunScene(env, scene)
+	assert.Nil(t, err)
+	delays = nil
+	for _, action := range result.Actions {
+		delays = append(delays, action.DelaySeconds)
+	}
+	assert.Equal(t, []int{0, 30, 70, 110}, delays)
+}
+
+func TestRepeatIterations(t *testing.T) {
+	m := NewLocalManager()
+	step := entity.SceneTask{Type: entity.TaskTypeRepeat, RepeatTimes: 2, IntervalSeconds: 10,
+		Then: []byte(`[{"type":2,"control_scene_id":2,"delay_seconds":30},{"type":2,"control_scene_id":3}]`)}
+	parent := NewTask(m.wrapStepToFunc(step), 0).WithScene(-1)
+	start := time.Now()
+	parent.Run()
+
+	// 只加入第一次执行的任务
+	first := m.queue.removeScene(-1)
+	if !assert.Len(t, first, 2) {
+		return
+	}
+	for _, task := range first {
+		assert.Equal(t, parent, task.Parent)
+	}
+
+	// 第一次执行的任务都结束后才加入第二次执行的任务，间隔 interval_seconds 秒
+	first[0].iteration.done()
+	assert.Empty(t, m.queue.removeScene(-1))
+	first[1].iteration.done()
+	second := m.queue.removeScene(-1)
+	if !assert.Len(t, second, 2) {
+		return
+	}
+	assert.NotSame(t, first[0].iteration, second[0].iteration)
+	for _, task := range second {
+		assert.GreaterOrEqual(t, task.Priority, start.Add(10*time.Second).Unix())
+	}
+
+	// 执行次数达到 repeat_times 后不再加入
+	second[0].iteration.done()
+	second[1].iteration.done()
+	assert.Empty(t, m.queue.removeScene(-1))
+}
+
+func TestPostWebhook(t *testing.T) {
+	body := []byte(`{"message":"hello"}`)
+	statusCode := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, body, data)
+		assert.Equal(t, "token", r.Header.Get("Authorization"))
+		sign := SignWebhook("secret", r.Header.Get(TimestampHeader), data)
+		assert.Equal(t, "sha256="+sign, r.Header.Get(SignatureHeader))
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+
+	n := entity.Notification{URL: server.URL, Secret: "secret", Headers: map[string]string{"Authorization": "token"}}
+	_, err := postWebhook(n, body)
+	assert.Nil(t, err)
+
+	// 服务端错误可以重试，请求错误不重试
+	statusCode = http.StatusBadGateway
+	retryable, err := postWebhook(n, body)
+	assert.NotNil(t, err)
+	assert.True(t, retryable)
+	statusCode = http.StatusBadRequest
+	retryable, err = postWebhook(n, body)
+	assert.NotNil(t, err)
+	assert.False(t, retryable)
+}
+
+func TestDryRunSceneNotification(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.Local)
+	scene := entity.Scene{
+		Name: "回家",
+		SceneTasks: []entity.SceneTask{
+			{Type: entity.TaskTypeAlert, DelaySeconds: 5,
+				Notification: []byte(`{"message":"{{.Scene}} 已执行"}`)},
+		},
+	}
+	result, err := DryRunScene(ConditionEnv{Now: now}, scene)
+	assert.Nil(t, err)
+	if assert.Len(t, result.Actions, 1) {
+		assert.Equal(t, "回家 已执行", result.Actions[0].Message)
+	}
+}
+
+func TestIsPayloadSatisfied(t *testing.T) {
+	payload := map[string]interface{}{
+		"event": map[string]interface{}{"type": "ring", "count": float64(2)},
+	}
+	// 未设置过滤时任意请求都满足
+	assert.True(t, IsPayloadSatisfied(entity.SceneCondition{ConditionType: entity.ConditionTypeWebhook}, nil))
+
+	c := entity.SceneCondition{ConditionType: entity.ConditionTypeWebhook, Operator: entity.OperatorEQ,
+		ConditionAttr: []byte(`{"attribute":"event.type","val":"ring"}`)}
+	assert.True(t, IsPayloadSatisfied(c, payload))
+	assert.False(t, IsPayloadSatisfied(c, map[string]interface{}{"event": "ring"}))
+	assert.False(t, IsPayloadSatisfied(c, nil))
+
+	c.Operator = entity.OperatorGT
+	c.ConditionAttr = []byte(`{"attribute":"event.count","val":1}`)
+	assert.True(t, IsPayloadSatisfied(c, payload))
+
+	// 请求内容的字段和过滤的值都为对象时不满足，不会 panic
+	c.Operator = entity.OperatorEQ
+	c.ConditionAttr = []byte(`{"attribute":"event","val":{"type":"ring","count":2}}`)
+	assert.False(t, IsPayloadSatisfied(c, payload))
+}
+
+func TestDryRunSceneWebhook(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.Local)
+	scene := entity.Scene{
+		Name:           "门铃",
+		AutoRun:        true,
+		IsOn:           true,
+		ConditionLogic: entity.MatchAnyCondition,
+		RepeatDate:     "01234567",
+		SceneConditions: []entity.SceneCondition{
+			{ID: 1, ConditionType: entity.ConditionTypeWebhook, Operator: entity.OperatorEQ,
+				ConditionAttr: []byte(`{"attribute":"event","val":"ring"}`)},
+		},
+		SceneTasks: []entity.SceneTask{
+			{Type: entity.TaskTypeAlert, Notification: []byte(`{"message":"{{.Payload.camera}} 有人按门铃"}`)},
+		},
+	}
+	env := ConditionEnv{Now: now, Payload: map[string]interface{}{"event": "motion", "camera": "前门"}}
+
+	// 未由 webhook 触发或请求内容不满足时不执行
+	result, err := DryRunScene(env, scene)
+	assert.Nil(t, err)
+	assert.False(t, result.WillRun)
+	result, err = DryRunScene(env, scene, 1)
+	assert.Nil(t, err)
+	assert.False(t, result.WillRun)
+
+	env.Payload["event"] = "ring"
+	result, err = DryRunScene(env, scene, 1)
+	assert.Nil(t, err)
+	assert.True(t, result.WillRun)
+	if assert.Len(t, result.Actions, 1) {
+		assert.Equal(t, "前门 有人按门铃", result.Actions[0].Message)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := retryPolicy{retries: 2, interval: time.Millisecond}
+
+	// 临时错误重试至成功
+	var n int
+	err := policy.do(context.Background(), func(ctx context.Context) error {
+		n++
+		if n < 3 {
+			return grpcstatus.Error(codes.Unavailable, "unavailable")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// 非临时错误不重试
+	n = 0
+	err = policy.do(context.Background(), func(ctx context.Context) error {
+		n++
+		return errors.New("invalid attribute")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+
+	// 超时后不再重试
+	n = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	policy.interval = 50 * time.Millisecond
+	err = policy.do(ctx, func(ctx context.Context) error {
+		n++
+		return grpcstatus.Error(codes.Unavailable, "unavailable")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestDeviceTaskErr(t *testing.T) {
+	code := func(err error) int {
+		return err.(errors2.Error).Code.Status
+	}
+	ctx := context.Background()
+	assert.NoError(t, deviceTaskErr(ctx, 2, nil))
+
+	invalid := errors.New("invalid attribute")
+	assert.Equal(t, status.DeviceTaskPartFailed, code(deviceTaskErr(ctx, 2, []error{invalid})))
+	assert.Equal(t, status.DeviceTaskFailed, code(deviceTaskErr(ctx, 2, []error{invalid, invalid})))
+	assert.Equal(t, status.DeviceOffline, code(deviceTaskErr(ctx, 1, []error{plugin.NotExistErr})))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 0)
+	defer cancel()
+	assert.Equal(t, status.DeviceTaskTimeout, code(deviceTaskErr(timeoutCtx, 2, []error{timeoutCtx.Err()})))
+}
@@ -1,15 +1,96 @@
 package task
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/now"
+	"github.com/zhiting-tech/smartassistant/modules/config"
 	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
 )
 
 // IsSceneHaveTimeCondition 场景是否有定时条件
 func IsSceneHaveTimeCondition(scene entity.Scene) bool {
 	for _, c := range scene.SceneConditions {
-		if c.ConditionType == entity.ConditionTypeTiming {
+		if c.IsTimeCondition() {
 			return true
 		}
 	}
 	return false
 }
+
+// conditionExecTime 获取定时类触发条件在 day 当天的执行时间
+func conditionExecTime(scene entity.Scene, c entity.SceneCondition, day time.Time) (t time.Time, err error) {
+	switch c.ConditionType {
+	case entity.ConditionTypeTiming:
+		t = now.New(day).BeginningOfDay().Add(c.TimingAt.Sub(now.New(c.TimingAt).BeginningOfDay()))
+	case entity.ConditionTypeSolar:
+		var area entity.Area
+		if area, err = entity.GetAreaByID(scene.AreaID); err != nil {
+			return
+		}
+		t, err = c.SolarTime(day, area)
+	}
+	return
+}
+
+// conditionTaskKey 场景条件对应任务的 key
+func conditionTaskKey(sceneID, conditionID int) string {
+	return fmt.Sprintf("%d:%d", sceneID, conditionID)
+}
+
+// isMissedTaskRunnable 任务是否可以执行，已过执行时间的任务按配置的方式处理
+func isMissedTaskRunnable(conf config.Task, executeAt, at time.Time) bool {
+	if !executeAt.Before(at) {
+		return true
+	}
+	switch conf.GetMissedPolicy() {
+	case config.MissedTaskRun:
+		return true
+	case config.MissedTaskSkip:
+		return false
+	}
+	return at.Sub(executeAt) <= time.Duration(conf.GetGracePeriod())*time.Second
+}
+
+// saveQueuedTask 保存延时执行的子任务
+func saveQueuedTask(task *Task, sceneTask entity.SceneTask) error {
+	qt := entity.QueuedTask{
+		TaskID:      task.ID,
+		SceneID:     task.sceneID,
+		SceneTaskID: sceneTask.ID,
+		ExecuteAt:   time.Unix(task.Priority, 0),
+	}
+	if task.Parent != nil {
+		qt.ParentTaskID = &task.Parent.ID
+	}
+	return entity.CreateQueuedTask(&qt)
+}
+
+// queuedTaskWrapper 任务开始执行时删除保存的任务，执行中重启不会重复执行
+func queuedTaskWrapper(f TaskFunc) TaskFunc {
+	return func(task *Task) error {
+		if err := entity.DeleteQueuedTask(task.ID); err != nil {
+			logger.Error(err)
+		}
+		return f(task)
+	}
+}
+
+// logUnrunTask 记录未执行的任务的日志，未插入过日志的触发任务不记录
+func logUnrunTask(t *Task, taskErr error) {
+	// 等待中的步骤及排队中的执行已插入日志
+	if !t.logged {
+		if t.Parent == nil {
+			return
+		}
+		if err := entity.NewTaskLog(t.target, t.ID, &t.Parent.ID); err != nil {
+			logger.Error("NewTaskLogErr:", err)
+			return
+		}
+	}
+	if err := entity.UpdateTaskLog(t.ID, taskErr); err != nil {
+		logger.Error(err)
+	}
+}
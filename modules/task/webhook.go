@@ -0,0 +1,75 @@
+package task
+
+import (
+	errors2 "errors"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/modules/types/status"
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+// WebhookTrigger 收到场景的 webhook 请求时触发场景，payload 为请求内容，
+// 仅已开启的自动场景中请求内容满足的 webhook 条件会触发场景，triggered 为是否触发
+func (m *LocalManager) WebhookTrigger(sceneID int, payload map[string]interface{}) (triggered bool, err error) {
+	scene, err := entity.GetSceneInfoById(sceneID)
+	if err != nil {
+		if errors2.Is(err, gorm.ErrRecordNotFound) {
+			return false, errors.New(status.SceneNotExist)
+		}
+		return false, errors.Wrap(err, errors.InternalServerErr)
+	}
+	if !scene.AutoRun || !scene.IsOn {
+		logger.Infof("scene %d is not an enabled auto scene, ignore webhook", scene.ID)
+		return
+	}
+
+	var trigConditionIDs []int
+	for _, c := range scene.SceneConditions {
+		if c.ConditionType == entity.ConditionTypeWebhook && IsPayloadSatisfied(c, payload) {
+			trigConditionIDs = append(trigConditionIDs, c.ID)
+		}
+	}
+	if len(trigConditionIDs) == 0 {
+		return
+	}
+	t := NewTask(m.wrapSceneFunc(scene, trigConditionIDs...), 0).WithScene(scene.ID).
+		WithPayload(payload)
+	m.pushTask(t, scene)
+	return true, nil
+}
+
+// IsPayloadSatisfied webhook 请求内容是否满足条件，条件未设置过滤时任意请求都满足
+func IsPayloadSatisfied(c entity.SceneCondition, payload map[string]interface{}) bool {
+	filter, ok, err := c.WebhookFilter()
+	if err != nil {
+		logger.Errorf("condition %d get webhook filter err: %v", c.ID, err)
+		return false
+	}
+	if !ok {
+		return true
+	}
+	val, ok := lookupPayload(payload, filter.Attribute.Attribute)
+	if !ok {
+		return false
+	}
+	return isValSatisfied(c.Operator, val, filter.Val)
+}
+
+// lookupPayload 获取请求内容中的字段，多级字段以 . 分隔
+func lookupPayload(payload map[string]interface{}, path string) (val interface{}, ok bool) {
+	var cur interface{} = payload
+	for _, key := range strings.Split(path, ".") {
+		m, isMap := cur.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
@@ -14,6 +14,8 @@ const (
 	AlreadyDataSync
 	ForbiddenBindOtherSA
 	ForbiddenRemoveSADevice
+	DeviceHistoryParamIncorrect
+	EnergyParamIncorrect
 )
 
 func init() {
@@ -27,4 +29,6 @@ func init() {
 	errors.NewCode(AlreadyDataSync, "数据已同步,禁止多次同步数据")
 	errors.NewCode(ForbiddenBindOtherSA, "已有SA，不允许添加其他SA")
 	errors.NewCode(ForbiddenRemoveSADevice, "不允许删除SA设备")
+	errors.NewCode(DeviceHistoryParamIncorrect, "状态历史参数%s不正确")
+	errors.NewCode(EnergyParamIncorrect, "用电量统计参数%s不正确")
 }
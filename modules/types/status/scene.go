@@ -19,6 +19,21 @@ const (
 	DeviceOrSceneControlDeny
 	DeviceOffline
 	SceneParamIncorrectErr
+	SceneTaskCanceled
+	SceneTaskMissed
+	SceneRunSkipped
+	BlueprintFormatErr
+	BlueprintInputNotBound
+	BlueprintDeviceTypeMismatch
+	BlueprintAttrNotSupport
+	SceneRevisionNotExist
+	SceneWaitTimeout
+	NotificationSendErr
+	DeviceTaskTimeout
+	DeviceTaskPartFailed
+	DeviceTaskFailed
+	DeviceAttrReadOnly
+	DeviceAttrValIncorrect
 )
 
 func init() {
@@ -30,11 +45,26 @@ func init() {
 	errors.NewCode(SceneDeleteDeny, "您没有删除场景的权限")
 	errors.NewCode(SceneTypeForbidModify, "场景类型不允许修改")
 	errors.NewCode(ConditionMisMatchTypeAndConfigErr, "场景触发条件类型与配置不一致")
-	errors.NewCode(ConditionTimingCountErr, "定时触发条件只能添加一个")
+	errors.NewCode(ConditionTimingCountErr, "定时或 webhook 触发条件只能添加一个")
 	errors.NewCode(TaskTypeErr, "任务类型错误")
 	errors.NewCode(DeviceActionErr, "设备操作类型不存在")
 	errors.NewCode(DeviceOperationNotSetErr, "设备操作未设置")
 	errors.NewCode(DeviceOrSceneControlDeny, "没有场景或设备的控制权限")
 	errors.NewCode(DeviceOffline, "设备断连")
 	errors.NewCode(SceneParamIncorrectErr, "%s不正确")
+	errors.NewCode(SceneTaskCanceled, "场景执行已取消")
+	errors.NewCode(SceneTaskMissed, "任务已错过执行时间")
+	errors.NewCode(SceneRunSkipped, "场景正在执行，已忽略本次触发")
+	errors.NewCode(BlueprintFormatErr, "场景蓝图格式错误: %s")
+	errors.NewCode(BlueprintInputNotBound, "蓝图参数 %s 未绑定")
+	errors.NewCode(BlueprintDeviceTypeMismatch, "设备类型与蓝图参数 %s 不符")
+	errors.NewCode(BlueprintAttrNotSupport, "设备 %s 不支持属性 %s")
+	errors.NewCode(SceneRevisionNotExist, "场景版本不存在")
+	errors.NewCode(SceneWaitTimeout, "等待设备状态超时")
+	errors.NewCode(NotificationSendErr, "发送通知失败: %s")
+	errors.NewCode(DeviceTaskTimeout, "控制设备超时")
+	errors.NewCode(DeviceTaskPartFailed, "部分设备属性设置失败: %s")
+	errors.NewCode(DeviceTaskFailed, "设置设备属性失败: %s")
+	errors.NewCode(DeviceAttrReadOnly, "属性 %s 为只读属性，不能控制")
+	errors.NewCode(DeviceAttrValIncorrect, "属性 %s 的值不正确")
 }
@@ -1,8 +1,10 @@
 package websocket
 
 import (
+	"encoding/json"
 	"sync"
 
+	"github.com/google/uuid"
 	"github.com/zhiting-tech/smartassistant/pkg/logger"
 )
 
@@ -12,11 +14,36 @@ type bucket struct {
 	broadcast  chan broadcastData
 	register   chan *client
 	unregister chan *client
+
+	epoch  string // 进程启动时随机生成，重启后序号重新开始，客户端需要通过 epoch 区分
+	seq    uint64 // 最后一个事件的序号，只在 run 中修改
+	replay *replayBuffer
 }
 
+// replaySize 保存用于重连后补发的事件数
+const replaySize = 512
+
+// resyncEvent 无法补发断开期间的所有事件时推送，客户端需要重新获取设备状态
+const resyncEvent = "resync"
+
 type broadcastData struct {
-	AreaID uint64
-	Data   []byte
+	AreaID  uint64
+	UserIDs []int  // 接收消息的用户，为空时发送给家庭所有用户
+	Topic   topic  // 消息主题，只发送给订阅了该主题的客户端
+	Event   *Event // 事件，推送时按顺序编号，Data 为编号后的事件
+	Seq     uint64
+	Data    []byte
+}
+
+// isReceiver 客户端是否接收该消息
+func (d broadcastData) isReceiver(cli *client) bool {
+	if cli.areaID != d.AreaID {
+		return false
+	}
+	if len(d.UserIDs) != 0 && !containsInt(d.UserIDs, cli.userID) {
+		return false
+	}
+	return cli.isSubscribed(d.Topic)
 }
 
 func newBucket() *bucket {
@@ -24,6 +51,8 @@ func newBucket() *bucket {
 		register:   make(chan *client, 2),
 		unregister: make(chan *client, 2),
 		broadcast:  make(chan broadcastData),
+		replay:     newReplayBuffer(replaySize),
+		epoch:      uuid.New().String(),
 	}
 }
 
@@ -33,26 +62,71 @@ func (b *bucket) run() {
 		case client := <-b.register:
 			logger.Debug("register new websocket client", client.key)
 			b.put(client)
+			if client.resume {
+				b.resume(client)
+			}
 		case client := <-b.unregister:
 			logger.Debug("del websocket client", client.key)
 			b.remove(client.key)
 		case message := <-b.broadcast:
+			if message.Event != nil {
+				if err := b.numberEvent(&message); err != nil {
+					logger.Errorf("marshal websocket event err: %v", err)
+					continue
+				}
+			}
 			b.clients.Range(func(key, value interface{}) bool {
 				cli := value.(*client)
-				if cli.areaID != message.AreaID {
+				if !message.isReceiver(cli) {
 					return true
 				}
 
 				logger.Debug("broadcast clientKey", cli.key, " AreaID ", cli.areaID)
-				select {
-				case cli.send <- message.Data:
-				}
+				b.send(cli, message.Data)
 				return true
 			})
 		}
 	}
 }
 
+// numberEvent 为事件编号并保存，用于客户端重连后补发
+func (b *bucket) numberEvent(message *broadcastData) (err error) {
+	event := *message.Event
+	event.Seq = b.seq + 1
+	event.Epoch = b.epoch
+	if message.Data, err = json.Marshal(event); err != nil {
+		return
+	}
+	b.seq++
+	message.Seq = b.seq
+	b.replay.add(*message)
+	return
+}
+
+// resume 补发客户端断开期间的事件，无法全部补发或 epoch 不一致（服务重启过）时通知客户端重新获取状态
+func (b *bucket) resume(cli *client) {
+	messages, complete := b.replay.since(cli.lastSeq)
+	if !complete || cli.epoch != b.epoch || cli.lastSeq > b.seq {
+		data, _ := json.Marshal(Event{EventType: resyncEvent, Seq: b.seq, Epoch: b.epoch, Data: map[string]interface{}{}})
+		b.send(cli, data)
+		return
+	}
+	for _, message := range messages {
+		if message.isReceiver(cli) {
+			b.send(cli, message.Data)
+		}
+	}
+}
+
+// send 发送消息给客户端，客户端队列已满时断开，避免阻塞其他客户端
+func (b *bucket) send(cli *client, data []byte) {
+	if cli.enqueue(data) {
+		return
+	}
+	logger.Warnf("websocket client %s send queue is full, disconnect", cli.key)
+	go b.remove(cli.key)
+}
+
 // 断开客户端，停止
 func (b *bucket) stop() {
 	b.clients.Range(func(key, value interface{}) bool {
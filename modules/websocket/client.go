@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	errors2 "errors"
 	"github.com/sirupsen/logrus"
+	"net/http"
 	"sync"
 	"time"
 
@@ -16,17 +17,73 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	sendQueueSize  = 1024             // 客户端待发送的消息数上限，超出时断开客户端
+	writeWait      = 10 * time.Second // 发送一条消息的超时时间
+	pongWait       = 60 * time.Second // 等待客户端响应 ping 的时间，超时后断开客户端
+	pingPeriod     = pongWait * 9 / 10
+	maxMessageSize = 512 * 1024 // 客户端消息的最大字节数
+)
+
 type client struct {
 	key    string
 	areaID uint64
+	userID int
 	conn   *ws.Conn
 	send   chan []byte
 	bucket *bucket
+	req    *http.Request // 建立连接的请求
+
+	subsMu sync.Mutex
+	subs   subscriptions
+
+	resume  bool   // 是否从 lastSeq 之后恢复事件推送
+	lastSeq uint64 // 客户端重连前收到的最后一个事件的序号
+	epoch   string // 客户端重连前收到的最后一个事件的 epoch
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func (cli *client) Close() error {
-	close(cli.send)
-	return cli.conn.Close()
+func newClient(key string, conn *ws.Conn, b *bucket) *client {
+	return &client{
+		key:    key,
+		conn:   conn,
+		bucket: b,
+		send:   make(chan []byte, sendQueueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+func (cli *client) Close() (err error) {
+	cli.closeOnce.Do(func() {
+		close(cli.done)
+		err = cli.conn.Close()
+	})
+	return
+}
+
+// enqueue 将消息加入发送队列，队列已满时返回 false；客户端已断开时丢弃消息
+func (cli *client) enqueue(msg []byte) bool {
+	select {
+	case <-cli.done:
+		return true
+	default:
+	}
+	select {
+	case cli.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// write 发送消息，客户端处理太慢导致队列已满时断开客户端，客户端可以重连后恢复事件推送
+func (cli *client) write(msg []byte) {
+	if !cli.enqueue(msg) {
+		logger.Warnf("websocket client %s send queue is full, disconnect", cli.key)
+		cli.bucket.unregister <- cli
+	}
 }
 
 type ActionWrap struct {
@@ -45,7 +102,7 @@ var _callServicePool sync.Pool
 
 // 解析 WebSocket 消息，并且调用业务逻辑
 func (cli *client) handleWsMessage(data []byte, user *session.User) (err error) {
-	cs := _callServicePool.Get().(*callService)
+	cs := _callServicePool.Get().(*CallService)
 	defer _callServicePool.Put(cs)
 	cs.reset()
 	if err = json.Unmarshal(data, cs); err != nil {
@@ -61,10 +118,17 @@ func (cli *client) handleWsMessage(data []byte, user *session.User) (err error)
 	}
 
 	cs.CallUser = *user
+	cs.Request = cli.req
+	switch cs.Service { // 订阅只作用于当前连接
+	case serviceSubscribe:
+		return cli.handleCallFunc(*cs, cli.subscribe)
+	case serviceUnsubscribe:
+		return cli.handleCallFunc(*cs, cli.unsubscribe)
+	}
 	return cli.handleCallService(*cs) // 通过插件服务和设备通信
 }
 
-func (cli *client) discover(cs *callService, user *session.User) (err error) {
+func (cli *client) discover(cs *CallService, user *session.User) (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	ch := plugin.GetGlobalClient().DevicesDiscover(ctx)
@@ -77,14 +141,19 @@ func (cli *client) discover(cs *callService, user *session.User) (err error) {
 		if errors2.Is(err, gorm.ErrRecordNotFound) {
 			resp.AddResult("device", result)
 			msg, _ := json.Marshal(resp)
-			cli.send <- msg
+			cli.write(msg)
 		}
 	}
 	return
 
 }
 
-func (cli *client) handleCallService(cs callService) (err error) {
+func (cli *client) handleCallService(cs CallService) (err error) {
+	return cli.handleCallFunc(cs, callFunctions[cs.Service])
+}
+
+// handleCallFunc 调用 callFunc 处理消息并返回结果，callFunc 为空时直接返回
+func (cli *client) handleCallFunc(cs CallService, callFunc CallFunc) (err error) {
 
 	resp := callResponse{
 		ID:   cs.ID,
@@ -98,27 +167,32 @@ func (cli *client) handleCallService(cs callService) (err error) {
 			resp.Success = true
 		}
 		msg, _ := json.Marshal(resp)
-		cli.send <- msg
+		cli.write(msg)
 		logger.Debugf("cs: %v, response msg: %s", cs, string(msg))
 	}()
 
-	callFunc, ok := callFunctions[cs.Service]
-	if !ok {
+	if callFunc == nil {
 		return
 	}
 	resp.Result, err = callFunc(cs)
 	return
 }
 
-// readWS
+// readWS 读取客户端消息，客户端需要在 pongWait 内响应 ping 或发送消息，否则断开
 func (cli *client) readWS(user *session.User) {
 	defer func() { cli.bucket.unregister <- cli }()
 
+	cli.conn.SetReadLimit(maxMessageSize)
+	_ = cli.conn.SetReadDeadline(time.Now().Add(pongWait))
+	cli.conn.SetPongHandler(func(string) error {
+		return cli.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
 	for {
 		t, data, err := cli.conn.ReadMessage()
 		if err != nil {
 			return
 		}
+		_ = cli.conn.SetReadDeadline(time.Now().Add(pongWait))
 		if t == ws.CloseMessage {
 			return
 		}
@@ -135,24 +209,34 @@ func (cli *client) readWS(user *session.User) {
 	}
 }
 
-// writeWS
+// writeWS 发送队列中的消息，并定时发送 ping 检测客户端是否在线
 func (cli *client) writeWS() {
-	defer func() { cli.bucket.unregister <- cli }()
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		cli.bucket.unregister <- cli
+	}()
 
 	for {
 		select {
-		case msg, ok := <-cli.send:
-			if !ok {
-				_ = cli.conn.WriteMessage(ws.CloseMessage, []byte{})
+		case msg := <-cli.send:
+			_ = cli.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := cli.conn.WriteMessage(ws.TextMessage, msg); err != nil {
 				return
 			}
-			_ = cli.conn.WriteMessage(ws.TextMessage, msg)
+		case <-ticker.C:
+			_ = cli.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := cli.conn.WriteMessage(ws.PingMessage, nil); err != nil {
+				return
+			}
+		case <-cli.done:
+			return
 		}
 	}
 }
 
 func init() {
 	_callServicePool.New = func() interface{} {
-		return &callService{}
+		return &CallService{}
 	}
 }
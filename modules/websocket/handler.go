@@ -10,7 +10,7 @@ import (
 	"gorm.io/gorm"
 )
 
-func GetAttrs(cs callService) (result Result, err error) {
+func GetAttrs(cs CallService) (result Result, err error) {
 	result = make(Result)
 	user := cs.CallUser
 	d, err := plugin.GetUserDeviceAttributes(user.AreaID, user.UserID, cs.Domain, cs.Identity)
@@ -20,7 +20,7 @@ func GetAttrs(cs callService) (result Result, err error) {
 	result["device"] = d
 	return
 }
-func SetAttrs(cs callService) (result Result, err error) {
+func SetAttrs(cs CallService) (result Result, err error) {
 
 	result = make(Result)
 	user := cs.CallUser
@@ -46,7 +46,7 @@ func SetAttrs(cs callService) (result Result, err error) {
 }
 
 // ConnectDevice 连接设备 TODO 直接替代添加设备接口？
-func ConnectDevice(cs callService) (result Result, err error) {
+func ConnectDevice(cs CallService) (result Result, err error) {
 	result = make(Result)
 	var authParams map[string]string
 	if err = json.Unmarshal(cs.ServiceData, &authParams); err != nil {
@@ -70,7 +70,7 @@ func ConnectDevice(cs callService) (result Result, err error) {
 }
 
 // DisconnectDevice 设备断开连接（取消配对等） TODO 直接替代删除设备接口？
-func DisconnectDevice(cs callService) (result Result, err error) {
+func DisconnectDevice(cs CallService) (result Result, err error) {
 
 	result = make(Result)
 	var authParams map[string]string
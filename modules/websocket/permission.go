@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zhiting-tech/smartassistant/modules/entity"
+	"github.com/zhiting-tech/smartassistant/pkg/logger"
+)
+
+// permissionCacheTTL 家庭用户及其权限的缓存时间，避免每次推送设备状态都查询权限
+const permissionCacheTTL = 10 * time.Second
+
+type cachedPermissions struct {
+	up       entity.UserPermissions
+	expireAt time.Time
+}
+
+type cachedUsers struct {
+	userIDs  []int
+	expireAt time.Time
+}
+
+// permissionCache 缓存家庭的用户及用户的权限
+type permissionCache struct {
+	mu    sync.Mutex
+	items map[int]cachedPermissions
+	users map[uint64]cachedUsers
+}
+
+func newPermissionCache() *permissionCache {
+	return &permissionCache{
+		items: make(map[int]cachedPermissions),
+		users: make(map[uint64]cachedUsers),
+	}
+}
+
+// get 获取用户的权限，缓存过期时重新查询
+func (c *permissionCache) get(userID int) (up entity.UserPermissions, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if item, ok := c.items[userID]; ok && now.Before(item.expireAt) {
+		return item.up, nil
+	}
+	if up, err = entity.GetUserPermissions(userID); err != nil {
+		return
+	}
+	c.items[userID] = cachedPermissions{up: up, expireAt: now.Add(permissionCacheTTL)}
+	return
+}
+
+// areaUsers 获取家庭的所有用户，缓存过期时重新查询
+func (c *permissionCache) areaUsers(areaID uint64) (userIDs []int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if item, ok := c.users[areaID]; ok && now.Before(item.expireAt) {
+		return item.userIDs, nil
+	}
+	users, err := entity.GetUsers(areaID)
+	if err != nil {
+		return
+	}
+	for _, u := range users {
+		userIDs = append(userIDs, u.ID)
+	}
+	c.users[areaID] = cachedUsers{userIDs: userIDs, expireAt: now.Add(permissionCacheTTL)}
+	return
+}
+
+// isAttrPermit 用户是否可以接收设备属性的状态：需要有该属性的控制权限，
+// 只读属性（如传感器状态）有设备的控制权限即可
+func isAttrPermit(up entity.UserPermissions, d entity.Device, attr entity.Attribute) bool {
+	if up.IsDeviceAttrPermit(d.ID, attr) {
+		return true
+	}
+	return attr.ReadOnly && up.IsDeviceControlPermit(d.ID)
+}
+
+// permittedUsers 获取家庭中可以接收设备属性状态的用户，包括未连接的用户，用于重连后补发
+func (s *Server) permittedUsers(d entity.Device, attr entity.Attribute) (userIDs []int) {
+	areaUsers, err := s.permissions.areaUsers(d.AreaID)
+	if err != nil {
+		logger.Errorf("get area %d users err: %v", d.AreaID, err)
+		return
+	}
+	for _, userID := range areaUsers {
+		up, err := s.permissions.get(userID)
+		if err != nil {
+			logger.Errorf("get user %d permissions err: %v", userID, err)
+			continue
+		}
+		if isAttrPermit(up, d, attr) {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return
+}
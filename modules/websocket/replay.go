@@ -0,0 +1,45 @@
+package websocket
+
+// replayBuffer 保存最近推送的事件，客户端重连时补发断开期间的事件
+type replayBuffer struct {
+	items []broadcastData // 环形缓冲，按序号递增
+	start int             // 最早的事件的位置
+	size  int
+}
+
+func newReplayBuffer(capacity int) *replayBuffer {
+	return &replayBuffer{
+		items: make([]broadcastData, capacity),
+	}
+}
+
+// add 添加事件，缓冲已满时覆盖最早的事件
+func (r *replayBuffer) add(d broadcastData) {
+	if len(r.items) == 0 {
+		return
+	}
+	if r.size < len(r.items) {
+		r.items[(r.start+r.size)%len(r.items)] = d
+		r.size++
+		return
+	}
+	r.items[r.start] = d
+	r.start = (r.start + 1) % len(r.items)
+}
+
+// since 获取序号大于 seq 的事件，complete 为 false 表示部分事件已被覆盖，无法全部补发
+func (r *replayBuffer) since(seq uint64) (ds []broadcastData, complete bool) {
+	if r.size == 0 {
+		return nil, true
+	}
+	if seq+1 < r.items[r.start].Seq {
+		return nil, false
+	}
+	for i := 0; i < r.size; i++ {
+		d := r.items[(r.start+i)%len(r.items)]
+		if d.Seq > seq {
+			ds = append(ds, d)
+		}
+	}
+	return ds, true
+}
@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func seqs(ds []broadcastData) (s []uint64) {
+	for _, d := range ds {
+		s = append(s, d.Seq)
+	}
+	return
+}
+
+func TestReplayBuffer(t *testing.T) {
+	r := newReplayBuffer(3)
+	ds, complete := r.since(0)
+	assert.True(t, complete)
+	assert.Empty(t, ds)
+
+	for i := uint64(1); i <= 4; i++ {
+		r.add(broadcastData{Seq: i})
+	}
+	// 序号1已被覆盖
+	_, complete = r.since(0)
+	assert.False(t, complete)
+
+	ds, complete = r.since(1)
+	assert.True(t, complete)
+	assert.Equal(t, []uint64{2, 3, 4}, seqs(ds))
+
+	ds, complete = r.since(3)
+	assert.True(t, complete)
+	assert.Equal(t, []uint64{4}, seqs(ds))
+
+	ds, _ = r.since(4)
+	assert.Empty(t, ds)
+}
+
+func TestBucketResume(t *testing.T) {
+	b := newBucket()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.numberEvent(&broadcastData{AreaID: 1, Event: &Event{EventType: attributeChange}}))
+	}
+	assert.NoError(t, b.numberEvent(&broadcastData{AreaID: 2, Event: &Event{EventType: attributeChange}}))
+
+	cli := newClient("resume", nil, b)
+	cli.areaID = 1
+	cli.lastSeq = 1
+	cli.epoch = b.epoch
+	b.resume(cli)
+	assert.Len(t, cli.send, 2, "只补发序号大于 last_seq 且属于客户端家庭的事件")
+	assert.JSONEq(t, `{"event_type":"attribute_change","seq":2,"epoch":"`+b.epoch+`","data":null}`, string(<-cli.send))
+
+	// 服务重启后序号重新开始，即使 last_seq 不大于当前序号，epoch 不一致也需要客户端重新获取状态
+	for _, epoch := range []string{"", "previous"} {
+		restarted := newClient("restarted", nil, b)
+		restarted.areaID = 1
+		restarted.lastSeq = 1
+		restarted.epoch = epoch
+		b.resume(restarted)
+		if assert.Len(t, restarted.send, 1, epoch) {
+			data := string(<-restarted.send)
+			assert.Contains(t, data, resyncEvent)
+			assert.Contains(t, data, b.epoch)
+		}
+	}
+	assert.NotEqual(t, b.epoch, newBucket().epoch)
+}
+
+func TestClientEnqueue(t *testing.T) {
+	cli := newClient("enqueue", nil, nil)
+	for i := 0; i < sendQueueSize; i++ {
+		assert.True(t, cli.enqueue([]byte("msg")))
+	}
+	assert.False(t, cli.enqueue([]byte("msg")), "队列已满")
+
+	close(cli.done)
+	assert.True(t, cli.enqueue([]byte("msg")), "客户端已断开时丢弃消息")
+}
@@ -2,9 +2,9 @@ package websocket
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -22,12 +22,14 @@ const attributeChange = "attribute_change"
 
 // Server WebSocket服务端
 type Server struct {
-	bucket *bucket
+	bucket      *bucket
+	permissions *permissionCache
 }
 
 func NewWebSocketServer() *Server {
 	return &Server{
-		bucket: newBucket(),
+		bucket:      newBucket(),
+		permissions: newPermissionCache(),
 	}
 }
 
@@ -51,12 +53,15 @@ func (s *Server) AcceptWebSocket(c *gin.Context) {
 	)
 	user := session.Get(c)
 	logger.Debugf("start websocket serve \"%s\" with \"%s\"", lAddr, rAddr)
-	cli := &client{
-		key:    uuid.New().String(),
-		areaID: user.AreaID,
-		conn:   conn,
-		bucket: s.bucket,
-		send:   make(chan []byte, 4),
+	cli := newClient(uuid.New().String(), conn, s.bucket)
+	cli.areaID = user.AreaID
+	cli.userID = user.UserID
+	cli.req = c.Request
+	// 重连的客户端从收到的最后一个事件之后恢复推送
+	if lastSeq, err := strconv.ParseUint(c.Query("last_seq"), 10, 64); err == nil {
+		cli.resume = true
+		cli.lastSeq = lastSeq
+		cli.epoch = c.Query("epoch")
 	}
 
 	s.bucket.register <- cli
@@ -71,7 +76,7 @@ func (s *Server) SingleCast(cliID string, data []byte) error {
 	if cli == nil {
 		return ErrClientNotFound
 	}
-	cli.send <- data
+	cli.write(data)
 	return nil
 }
 
@@ -82,6 +87,17 @@ func (s *Server) Broadcast(areaID uint64, data []byte) {
 	}
 }
 
+// NotifyUsers 向家庭中的用户推送事件，userIDs 为空时推送给家庭所有用户
+func (s *Server) NotifyUsers(areaID uint64, userIDs []int, eventType string, data map[string]interface{}) error {
+	s.bucket.broadcast <- broadcastData{
+		AreaID:  areaID,
+		UserIDs: userIDs,
+		Topic:   topic{EventType: eventType},
+		Event:   &Event{EventType: eventType, Data: data},
+	}
+	return nil
+}
+
 func (s *Server) Run(ctx context.Context) {
 	logger.Info("starting websocket server")
 	go s.bucket.run()
@@ -90,8 +106,12 @@ func (s *Server) Run(ctx context.Context) {
 	logger.Warning("websocket server stopped")
 }
 
-// OnDeviceStateChange 设备状态改变回调，会广播给所有客户端，并且触发场景
+// OnDeviceStateChange 设备状态改变回调，推送给订阅了该设备并且有权限的客户端
 func (s *Server) OnDeviceStateChange(d entity.Device, attr entity.Attribute) error {
+	userIDs := s.permittedUsers(d, attr)
+	if len(userIDs) == 0 {
+		return nil
+	}
 	resp := Event{
 		EventType: attributeChange,
 		Data: map[string]interface{}{
@@ -100,9 +120,13 @@ func (s *Server) OnDeviceStateChange(d entity.Device, attr entity.Attribute) err
 			"attr":        attr.Attribute,
 		},
 	}
-	data, _ := json.Marshal(resp)
-	s.Broadcast(d.AreaID, data)
+	s.bucket.broadcast <- broadcastData{
+		AreaID:  d.AreaID,
+		UserIDs: userIDs,
+		Topic:   topic{EventType: attributeChange, DeviceID: d.ID, LocationID: d.LocationID},
+		Event:   &resp,
+	}
 
-	logger.Debug("broadcast state change:", string(data))
+	logger.Debugf("broadcast state change: %v", resp)
 	return nil
 }
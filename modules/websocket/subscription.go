@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"encoding/json"
+
+	"github.com/zhiting-tech/smartassistant/pkg/errors"
+)
+
+// topic 消息的主题，用于匹配客户端的订阅
+type topic struct {
+	EventType  string
+	DeviceID   int // 非设备相关的消息为0
+	LocationID int
+}
+
+// subscription 客户端的一个订阅，字段为空时不按该字段过滤；
+// 设置了设备或房间时，消息的设备在订阅的设备中或者在订阅的房间中即匹配
+type subscription struct {
+	EventTypes  []string `json:"event_types"`
+	DeviceIDs   []int    `json:"device_ids"`
+	LocationIDs []int    `json:"location_ids"`
+}
+
+// match 消息主题是否匹配订阅
+func (s subscription) match(t topic) bool {
+	if len(s.EventTypes) != 0 && !containsString(s.EventTypes, t.EventType) {
+		return false
+	}
+	if len(s.DeviceIDs) == 0 && len(s.LocationIDs) == 0 {
+		return true
+	}
+	if t.DeviceID == 0 {
+		return false
+	}
+	return containsInt(s.DeviceIDs, t.DeviceID) ||
+		(t.LocationID != 0 && containsInt(s.LocationIDs, t.LocationID))
+}
+
+// subscriptions 客户端的所有订阅
+type subscriptions struct {
+	subscribed bool // 是否订阅过，没有订阅过的客户端接收所有消息
+	nextID     int
+	items      map[int]subscription // 订阅ID->订阅
+}
+
+// add 添加订阅，返回订阅ID
+func (ss *subscriptions) add(s subscription) int {
+	if ss.items == nil {
+		ss.items = make(map[int]subscription)
+	}
+	ss.subscribed = true
+	ss.nextID++
+	ss.items[ss.nextID] = s
+	return ss.nextID
+}
+
+// remove 取消订阅，id 为0时取消所有订阅，返回订阅是否存在
+func (ss *subscriptions) remove(id int) bool {
+	if id == 0 {
+		ss.items = nil
+		return true
+	}
+	if _, ok := ss.items[id]; !ok {
+		return false
+	}
+	delete(ss.items, id)
+	return true
+}
+
+// match 消息主题是否匹配任意一个订阅
+func (ss *subscriptions) match(t topic) bool {
+	if !ss.subscribed {
+		return true
+	}
+	for _, s := range ss.items {
+		if s.match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubscribed 客户端是否订阅了该主题的消息
+func (cli *client) isSubscribed(t topic) bool {
+	cli.subsMu.Lock()
+	defer cli.subsMu.Unlock()
+	return cli.subs.match(t)
+}
+
+// subscribe 订阅消息，返回订阅ID
+func (cli *client) subscribe(cs CallService) (result Result, err error) {
+	var s subscription
+	if len(cs.ServiceData) != 0 {
+		if err = json.Unmarshal(cs.ServiceData, &s); err != nil {
+			err = errors.Wrap(err, errors.BadRequest)
+			return
+		}
+	}
+
+	cli.subsMu.Lock()
+	id := cli.subs.add(s)
+	cli.subsMu.Unlock()
+
+	result = Result{"subscription_id": id}
+	return
+}
+
+// unsubscribe 取消订阅，未指定订阅ID时取消所有订阅
+func (cli *client) unsubscribe(cs CallService) (result Result, err error) {
+	var req struct {
+		SubscriptionID int `json:"subscription_id"`
+	}
+	if len(cs.ServiceData) != 0 {
+		if err = json.Unmarshal(cs.ServiceData, &req); err != nil {
+			err = errors.Wrap(err, errors.BadRequest)
+			return
+		}
+	}
+
+	cli.subsMu.Lock()
+	ok := cli.subs.remove(req.SubscriptionID)
+	cli.subsMu.Unlock()
+
+	if !ok {
+		err = errors.New(errors.NotFound)
+	}
+	return
+}
+
+func containsInt(s []int, v int) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(s []string, v string) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
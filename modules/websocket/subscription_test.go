@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionMatch(t *testing.T) {
+	stateChange := topic{EventType: attributeChange, DeviceID: 1, LocationID: 2}
+	alert := topic{EventType: "scene_alert"}
+
+	assert.True(t, subscription{}.match(stateChange))
+	assert.True(t, subscription{EventTypes: []string{attributeChange}}.match(stateChange))
+	assert.False(t, subscription{EventTypes: []string{attributeChange}}.match(alert))
+	assert.True(t, subscription{DeviceIDs: []int{1}}.match(stateChange))
+	assert.False(t, subscription{DeviceIDs: []int{3}}.match(stateChange))
+	assert.True(t, subscription{DeviceIDs: []int{3}, LocationIDs: []int{2}}.match(stateChange))
+	assert.False(t, subscription{LocationIDs: []int{2}}.match(alert))
+}
+
+func TestSubscriptions(t *testing.T) {
+	var ss subscriptions
+	stateChange := topic{EventType: attributeChange, DeviceID: 1}
+	assert.True(t, ss.match(stateChange), "未订阅时接收所有消息")
+
+	id := ss.add(subscription{DeviceIDs: []int{2}})
+	assert.False(t, ss.match(stateChange))
+	ss.add(subscription{DeviceIDs: []int{1}})
+	assert.True(t, ss.match(stateChange))
+
+	assert.True(t, ss.remove(id))
+	assert.False(t, ss.remove(id))
+	assert.True(t, ss.remove(0))
+	assert.False(t, ss.match(stateChange), "取消所有订阅后不再接收消息")
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"github.com/sirupsen/logrus"
 	"github.com/zhiting-tech/smartassistant/modules/utils/session"
+	"net/http"
 )
 
 type MsgType string
@@ -20,11 +21,16 @@ const (
 	serviceConnect = "connect"
 	// serviceDisconnect 断开连接（取消配对）
 	serviceDisconnect = "disconnect"
+	// serviceSubscribe 订阅消息
+	serviceSubscribe = "subscribe"
+	// serviceUnsubscribe 取消订阅
+	serviceUnsubscribe = "unsubscribe"
 
 	MsgTypeResponse MsgType = "response"
 )
 
-type callService struct {
+// CallService 客户端的请求消息
+type CallService struct {
 	Domain      string
 	ID          int
 	Service     string
@@ -34,12 +40,15 @@ type callService struct {
 	Type        string // CallService
 
 	CallUser session.User
+	Request  *http.Request `json:"-"` // 建立 websocket 连接的请求，用于生成图片等资源的地址
 }
 
-func (cs *callService) reset() {
+func (cs *CallService) reset() {
 	cs.Domain = ""
 	cs.ID = 0
 	cs.Service = ""
+	cs.ServiceData = nil
+	cs.DeviceID = 0
 	cs.Type = ""
 	cs.Identity = ""
 }
@@ -61,12 +70,14 @@ func (cr *callResponse) AddResult(key string, value interface{}) {
 
 type Event struct {
 	EventType string                 `json:"event_type"`
+	Seq       uint64                 `json:"seq,omitempty"`   // 事件序号，重连时通过 last_seq 参数从该序号之后恢复推送
+	Epoch     string                 `json:"epoch,omitempty"` // 进程启动时生成的 ID，序号只在同一个 epoch 内连续
 	Data      map[string]interface{} `json:"data"`
 }
 
 type Result map[string]interface{}
 
-type CallFunc func(service callService) (Result, error)
+type CallFunc func(service CallService) (Result, error)
 
 var callFunctions = make(map[string]CallFunc)
 
@@ -0,0 +1,17 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallServiceReset(t *testing.T) {
+	var cs CallService
+	assert.NoError(t, json.Unmarshal([]byte(`{"id":1,"service":"subscribe","service_data":{"device_ids":[1]}}`), &cs))
+	cs.reset()
+	assert.NoError(t, json.Unmarshal([]byte(`{"id":2,"service":"unsubscribe"}`), &cs))
+	assert.Equal(t, 2, cs.ID)
+	assert.Empty(t, cs.ServiceData, "复用的消息不能保留上一次的参数")
+}
@@ -0,0 +1,214 @@
+// Package cron 解析标准 5 段 cron 表达式（分 时 日 月 周），计算下次执行时间
+// 支持 *、列表(,)、范围(-)、步长(/)，以及周字段的第 N 个星期几(#)，如 "0 8 * * 1#1" 表示每月第一个周一 8 点
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchDays 查找下次执行时间的最大天数，超过则认为不会再执行
+const maxSearchDays = 366 * 5
+
+type bound struct {
+	min, max int
+}
+
+var (
+	minuteBound = bound{0, 59}
+	hourBound   = bound{0, 23}
+	domBound    = bound{1, 31}
+	monthBound  = bound{1, 12}
+	dowBound    = bound{0, 7} // 0 和 7 都表示周日
+)
+
+var ErrInvalidExpr = errors.New("cron: invalid expression")
+
+// Schedule 解析后的 cron 表达式
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// nthDow 第 N 个星期几，nthDow[weekday] 的第 n 位表示当月第 n 个
+	nthDow [7]uint8
+
+	// 日和周字段都不为 * 时，两者满足其一即可（与标准 cron 一致）
+	domStar, dowStar bool
+}
+
+// Parse 解析 cron 表达式
+func Parse(spec string) (s *Schedule, err error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields, got %d", ErrInvalidExpr, len(fields))
+	}
+	s = &Schedule{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+	if s.minute, err = parseField(fields[0], minuteBound); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hourBound); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], domBound); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], monthBound); err != nil {
+		return nil, err
+	}
+	if err = s.parseDow(fields[4]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseDow 解析周字段，单独处理 # 语法
+func (s *Schedule) parseDow(field string) (err error) {
+	var plain []string
+	for _, item := range strings.Split(field, ",") {
+		i := strings.Index(item, "#")
+		if i < 0 {
+			plain = append(plain, item)
+			continue
+		}
+		var day, nth int
+		if day, err = parseInt(item[:i], dowBound); err != nil {
+			return
+		}
+		if nth, err = parseInt(item[i+1:], bound{1, 5}); err != nil {
+			return
+		}
+		s.nthDow[day%7] |= 1 << uint(nth)
+	}
+	if len(plain) == 0 {
+		return
+	}
+	if s.dow, err = parseField(strings.Join(plain, ","), dowBound); err != nil {
+		return
+	}
+	// 7 与 0 同为周日
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return
+}
+
+// parseField 解析单个字段，返回允许值的位图
+func parseField(field string, b bound) (bits uint64, err error) {
+	for _, item := range strings.Split(field, ",") {
+		var itemBits uint64
+		if itemBits, err = parseItem(item, b); err != nil {
+			return
+		}
+		bits |= itemBits
+	}
+	return
+}
+
+func parseItem(item string, b bound) (bits uint64, err error) {
+	var (
+		rangePart = item
+		step      = 1
+		start     = b.min
+		end       = b.max
+	)
+	if i := strings.Index(item, "/"); i >= 0 {
+		rangePart = item[:i]
+		if step, err = parseInt(item[i+1:], bound{1, b.max}); err != nil {
+			return
+		}
+	}
+
+	switch {
+	case rangePart == "*" || rangePart == "?":
+	case strings.Contains(rangePart, "-"):
+		parts := strings.SplitN(rangePart, "-", 2)
+		if start, err = parseInt(parts[0], b); err != nil {
+			return
+		}
+		if end, err = parseInt(parts[1], b); err != nil {
+			return
+		}
+		if start > end {
+			err = fmt.Errorf("%w: range %s", ErrInvalidExpr, rangePart)
+			return
+		}
+	default:
+		if start, err = parseInt(rangePart, b); err != nil {
+			return
+		}
+		// 形如 5/10 表示从 5 开始每 10 个单位
+		if step == 1 {
+			end = start
+		}
+	}
+
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+	return
+}
+
+func parseInt(s string, b bound) (v int, err error) {
+	if v, err = strconv.Atoi(s); err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidExpr, s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("%w: %d out of range [%d, %d]", ErrInvalidExpr, v, b.min, b.max)
+	}
+	return
+}
+
+// Next 返回 t 之后（不包括 t）的下次执行时间，找不到时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	for i := 0; i < maxSearchDays; i++ {
+		d := day.AddDate(0, 0, i)
+		if !s.matchDay(d) {
+			continue
+		}
+		for h := 0; h <= hourBound.max; h++ {
+			if s.hour&(1<<uint(h)) == 0 {
+				continue
+			}
+			for m := 0; m <= minuteBound.max; m++ {
+				if s.minute&(1<<uint(m)) == 0 {
+					continue
+				}
+				next := time.Date(d.Year(), d.Month(), d.Day(), h, m, 0, 0, d.Location())
+				if !next.Before(t) {
+					return next
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay 日期是否满足日、月、周字段
+func (s *Schedule) matchDay(d time.Time) bool {
+	if s.month&(1<<uint(d.Month())) == 0 {
+		return false
+	}
+	domMatch := s.dom&(1<<uint(d.Day())) != 0
+	dowMatch := s.matchDow(d)
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func (s *Schedule) matchDow(d time.Time) bool {
+	weekday := int(d.Weekday())
+	if s.dow&(1<<uint(weekday)) != 0 {
+		return true
+	}
+	nth := (d.Day()-1)/7 + 1
+	return s.nthDow[weekday]&(1<<uint(nth)) != 0
+}
@@ -0,0 +1,63 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErr(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * 1#6",
+		"a * * * *",
+	} {
+		_, err := Parse(spec)
+		assert.ErrorIs(t, err, ErrInvalidExpr, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	loc := time.Local
+	// 2021-06-21 为周一
+	base := time.Date(2021, 6, 21, 7, 50, 30, 0, loc)
+
+	tests := []struct {
+		spec string
+		from time.Time
+		next time.Time
+	}{
+		{"*/15 8-18 * * *", base, time.Date(2021, 6, 21, 8, 0, 0, 0, loc)},
+		{"*/15 8-18 * * *", time.Date(2021, 6, 21, 8, 0, 0, 0, loc), time.Date(2021, 6, 21, 8, 15, 0, 0, loc)},
+		{"*/15 8-18 * * *", time.Date(2021, 6, 21, 18, 45, 0, 0, loc), time.Date(2021, 6, 22, 8, 0, 0, 0, loc)},
+		{"0 8 * * 1#1", base, time.Date(2021, 7, 5, 8, 0, 0, 0, loc)},
+		{"30 6 * * 1-5", time.Date(2021, 6, 25, 7, 0, 0, 0, loc), time.Date(2021, 6, 28, 6, 30, 0, 0, loc)},
+		{"0 0 1 * *", base, time.Date(2021, 7, 1, 0, 0, 0, 0, loc)},
+		{"0 12 29 2 *", base, time.Date(2024, 2, 29, 12, 0, 0, 0, loc)},
+		{"0 9 * * 0,6", base, time.Date(2021, 6, 26, 9, 0, 0, 0, loc)},
+		{"0 9 * * 7", base, time.Date(2021, 6, 27, 9, 0, 0, 0, loc)},
+		// 日和周同时指定时满足其一即可
+		{"0 9 25 * 3", base, time.Date(2021, 6, 23, 9, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		assert.NoError(t, err, tt.spec)
+		assert.Equal(t, tt.next, s.Next(tt.from), tt.spec)
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 31 2 *")
+	assert.NoError(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero())
+}
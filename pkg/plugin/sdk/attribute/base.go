@@ -2,6 +2,7 @@ package attribute
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/sirupsen/logrus"
 )
@@ -24,11 +25,22 @@ type IntType interface {
 	SetInt(int)
 }
 
+type FloatType interface {
+	GetFloat() float64
+	SetFloat(float64)
+}
+
 type StringType interface {
 	GetString() string
 	SetString(string)
 }
 
+type EnumType interface {
+	GetEnums() []int
+	GetEnum() int
+	SetEnum(int)
+}
+
 type BoolType interface {
 	GetBool() bool
 	SetBool(bool)
@@ -95,6 +107,19 @@ func (i *Int) GetInt() int {
 	return i.v
 }
 
+type Float struct {
+	Base
+	v float64
+}
+
+func (f *Float) SetFloat(v float64) {
+	f.v = v
+}
+
+func (f *Float) GetFloat() float64 {
+	return f.v
+}
+
 type Bool struct {
 	Base
 	v bool
@@ -124,9 +149,19 @@ func (e *Enum) SetEnums(enums ...int) {
 	if e.enums == nil {
 		e.enums = make(map[int]struct{})
 	}
-	for i := range enums {
-		e.enums[i] = struct{}{}
+	for _, enum := range enums {
+		e.enums[enum] = struct{}{}
+	}
+}
+
+// GetEnums 获取所有有效的枚举值
+func (e *Enum) GetEnums() []int {
+	enums := make([]int, 0, len(e.enums))
+	for enum := range e.enums {
+		enums = append(enums, enum)
 	}
+	sort.Ints(enums)
+	return enums
 }
 
 func (e *Enum) GetEnum() int {
@@ -164,6 +199,10 @@ func TypeOf(iface interface{}) string {
 	switch iface.(type) {
 	case IntType:
 		return "int"
+	case FloatType:
+		return "float"
+	case EnumType:
+		return "enum"
 	case BoolType:
 		return "bool"
 	case StringType:
@@ -176,6 +215,10 @@ func ValueOf(iface interface{}) interface{} {
 	switch v := iface.(type) {
 	case IntType:
 		return v.GetInt()
+	case FloatType:
+		return v.GetFloat()
+	case EnumType:
+		return v.GetEnum()
 	case BoolType:
 		return v.GetBool()
 	case StringType:
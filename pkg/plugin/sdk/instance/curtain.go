@@ -4,9 +4,9 @@ import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
 
 // Curtain 窗帘
 type Curtain struct {
-	CurrentPosition *Position `tag:"required"` // 当前位置 0-100 TODO 不可写字段
-	TargetPosition  *Position `tag:"required"` // 目标位置 0-100
-	State           *State    `tag:"required"` // 0关1开2暂停
+	CurrentPosition *Position `tag:"required;readonly"` // 当前位置 0-100
+	TargetPosition  *Position `tag:"required"`          // 目标位置 0-100
+	State           *State    `tag:"required"`          // 0关1开2暂停
 	Style           *Style    // 0左右1左开2右开3上下
 
 	// TODO 考虑窗帘和窗帘控制器分开定义
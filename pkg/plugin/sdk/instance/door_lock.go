@@ -0,0 +1,34 @@
+package instance
+
+import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
+
+// DoorLock 门锁
+type DoorLock struct {
+	LockState *LockState `tag:"required"` // 0未上锁1已上锁
+	Jammed    *Jammed    `tag:"readonly"` // 锁舌是否卡住
+	Battery   *Battery   `tag:"readonly"`
+}
+
+func (l DoorLock) InstanceName() string {
+	return "door_lock"
+}
+
+// LockState 上锁状态
+type LockState struct {
+	attribute.Enum
+}
+
+func NewLockState() *LockState {
+	s := LockState{}
+	s.SetEnums(0, 1) // 未上锁/已上锁
+	return &s
+}
+
+// Jammed 锁舌卡住
+type Jammed struct {
+	attribute.Bool
+}
+
+func NewJammed() *Jammed {
+	return &Jammed{}
+}
@@ -0,0 +1,51 @@
+package instance
+
+import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
+
+// EnergyMeter 电量计量，可以与插座、开关等实例组合
+type EnergyMeter struct {
+	Energy      *Energy      `tag:"required;readonly"` // 累计用电量，单位 kWh
+	ActivePower *ActivePower `tag:"readonly"`          // 当前功率，单位 W
+	Voltage     *Voltage     `tag:"readonly"`          // 电压，单位 V
+	Current     *Current     `tag:"readonly"`          // 电流，单位 A
+}
+
+func (e EnergyMeter) InstanceName() string {
+	return "energy_meter"
+}
+
+// Energy 累计用电量，设备重置计数后可以从0重新开始
+type Energy struct {
+	attribute.Float
+}
+
+func NewEnergy() *Energy {
+	return &Energy{}
+}
+
+// ActivePower 功率
+type ActivePower struct {
+	attribute.Float
+}
+
+func NewActivePower() *ActivePower {
+	return &ActivePower{}
+}
+
+// Voltage 电压
+type Voltage struct {
+	attribute.Float
+}
+
+func NewVoltage() *Voltage {
+	return &Voltage{}
+}
+
+// Current 电流
+type Current struct {
+	attribute.Float
+}
+
+func NewCurrent() *Current {
+	return &Current{}
+}
@@ -0,0 +1,34 @@
+package instance
+
+import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
+
+// Fan 风扇
+type Fan struct {
+	Power       *attribute.Power `tag:"required"`
+	Speed       *Speed           // 风速
+	Oscillation *Oscillation     // 摇头
+}
+
+func (f Fan) InstanceName() string {
+	return "fan"
+}
+
+// Speed 风速百分比，范围 1-100
+type Speed struct {
+	attribute.Int
+}
+
+func NewSpeed() *Speed {
+	s := Speed{}
+	s.SetRange(1, 100)
+	return &s
+}
+
+// Oscillation 是否摇头
+type Oscillation struct {
+	attribute.Bool
+}
+
+func NewOscillation() *Oscillation {
+	return &Oscillation{}
+}
@@ -0,0 +1,56 @@
+package instance
+
+import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
+
+// MediaPlayer 媒体播放器，如音箱、电视
+type MediaPlayer struct {
+	Power     *attribute.Power `tag:"required"`
+	PlayState *PlayState       // 播放状态
+	Volume    *Volume          // 音量
+	Muted     *Muted           // 静音
+	Source    *Source          // 输入源
+}
+
+func (m MediaPlayer) InstanceName() string {
+	return "media_player"
+}
+
+// PlayState 播放状态
+type PlayState struct {
+	attribute.Enum
+}
+
+func NewPlayState() *PlayState {
+	s := PlayState{}
+	s.SetEnums(0, 1, 2) // 停止/播放/暂停
+	return &s
+}
+
+// Volume 音量，范围 0-100
+type Volume struct {
+	attribute.Int
+}
+
+func NewVolume() *Volume {
+	v := Volume{}
+	v.SetRange(0, 100)
+	return &v
+}
+
+// Muted 是否静音
+type Muted struct {
+	attribute.Bool
+}
+
+func NewMuted() *Muted {
+	return &Muted{}
+}
+
+// Source 输入源，如 HDMI1、蓝牙
+type Source struct {
+	attribute.String
+}
+
+func NewSource() *Source {
+	return &Source{}
+}
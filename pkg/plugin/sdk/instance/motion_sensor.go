@@ -4,8 +4,8 @@ import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
 
 // MotionSensor 人体传感器
 type MotionSensor struct {
-	Detected *Detected
-	Battery *Battery
+	Detected *Detected `tag:"readonly"`
+	Battery *Battery `tag:"readonly"`
 }
 
 func (w MotionSensor) InstanceName() string {
@@ -27,5 +27,7 @@ type Battery struct {
 
 // NewBattery 电量
 func NewBattery() *Battery {
-	return &Battery{}
+	b := Battery{}
+	b.SetRange(0, 100)
+	return &b
 }
@@ -5,7 +5,7 @@ import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
 // SecuritySystem 安全系统
 type SecuritySystem struct {
 	TargetState *TargetState
-	CurrentState *CurrentState
+	CurrentState *CurrentState `tag:"readonly"`
 }
 
 func (w SecuritySystem) InstanceName() string {
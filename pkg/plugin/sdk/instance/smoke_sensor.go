@@ -0,0 +1,24 @@
+package instance
+
+import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
+
+// SmokeSensor 烟雾传感器
+type SmokeSensor struct {
+	SmokeDetected *SmokeDetected `tag:"required;readonly"`
+	Battery       *Battery       `tag:"readonly"`
+}
+
+func (s SmokeSensor) InstanceName() string {
+	return "smoke_sensor"
+}
+
+// SmokeDetected 0:表示未检测到烟雾 1:表示检测到烟雾
+type SmokeDetected struct {
+	attribute.Int
+}
+
+func NewSmokeDetected() *SmokeDetected {
+	d := SmokeDetected{}
+	d.SetRange(0, 1)
+	return &d
+}
@@ -4,9 +4,9 @@ import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
 
 // TempHumiditySensor 温湿度传感器
 type TempHumiditySensor struct {
-	Temperature *Temperature
-	Humidity *Humidity
-	Battery *Battery
+	Temperature *Temperature `tag:"readonly"`
+	Humidity *Humidity `tag:"readonly"`
+	Battery *Battery `tag:"readonly"`
 }
 
 func (w TempHumiditySensor) InstanceName() string {
@@ -28,5 +28,7 @@ type Humidity struct {
 }
 
 func NewHumidity() *Humidity {
-	return &Humidity{}
+	h := Humidity{}
+	h.SetRange(0, 100)
+	return &h
 }
\ No newline at end of file
@@ -0,0 +1,37 @@
+package instance
+
+import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
+
+// Thermostat 温控器，如空调、地暖
+type Thermostat struct {
+	TargetTemperature  *TargetTemperature `tag:"required"` // 目标温度
+	CurrentTemperature *Temperature       `tag:"readonly"` // 当前温度
+	HvacMode           *HvacMode          `tag:"required"` // 运行模式
+	CurrentHumidity    *Humidity          `tag:"readonly"` // 当前湿度
+}
+
+func (t Thermostat) InstanceName() string {
+	return "thermostat"
+}
+
+// TargetTemperature 目标温度，默认范围 16-30
+type TargetTemperature struct {
+	attribute.Int
+}
+
+func NewTargetTemperature() *TargetTemperature {
+	t := TargetTemperature{}
+	t.SetRange(16, 30)
+	return &t
+}
+
+// HvacMode 运行模式
+type HvacMode struct {
+	attribute.Enum
+}
+
+func NewHvacMode() *HvacMode {
+	m := HvacMode{}
+	m.SetEnums(0, 1, 2, 3, 4, 5) // 关闭/制热/制冷/自动/除湿/送风
+	return &m
+}
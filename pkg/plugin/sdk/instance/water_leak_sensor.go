@@ -4,8 +4,8 @@ import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
 
 // WaterLeakSensor 水浸传感器
 type WaterLeakSensor struct {
-	LeakDetected *LeakDetected
-	Battery *Battery
+	LeakDetected *LeakDetected `tag:"readonly"`
+	Battery *Battery `tag:"readonly"`
 }
 
 func (w WaterLeakSensor) InstanceName() string {
@@ -4,8 +4,8 @@ import "github.com/zhiting-tech/smartassistant/pkg/plugin/sdk/attribute"
 
 // WindowDoorSensor 门窗传感器
 type WindowDoorSensor struct {
-	WindowDoorClose *WindowDoorClose
-	Battery *Battery
+	WindowDoorClose *WindowDoorClose `tag:"readonly"`
+	Battery *Battery `tag:"readonly"`
 }
 
 func (w WindowDoorSensor) InstanceName() string {
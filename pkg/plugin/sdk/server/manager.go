@@ -176,15 +176,8 @@ func (p *Manager) Notify(identity string, instanceID int, attr *utils.Attribute)
 			return nil
 		}
 		n := Notify{Identity: identity, InstanceID: instanceID}
-		n.Attribute = Attribute{
-			ID:        attr.ID,
-			Attribute: attr.Name,
-			Val:       val,
-			ValType:   attr.Type,
-		}
-		if num, ok := attr.Model.(attribute.IntType); ok {
-			n.Attribute.Min, n.Attribute.Max = num.GetRange()
-		}
+		n.Attribute = newAttribute(attr)
+		n.Attribute.Val = val
 		select {
 		case p.notifyChan <- n:
 		default:
@@ -240,16 +233,8 @@ func (p *Manager) getInstances(device Device) (instances []Instance) {
 				logrus.Debug("attr is nil or not active")
 				continue
 			}
-			a := Attribute{
-				ID:        attr.ID,
-				Attribute: attr.Name,
-				Val:       attribute.ValueOf(attr.Model),
-				ValType:   attr.Type,
-			}
-			if num, ok := attr.Model.(attribute.IntType); ok {
-				a.Min, a.Max = num.GetRange()
-			}
-
+			a := newAttribute(attr)
+			a.Val = attribute.ValueOf(attr.Model)
 			attrs = append(attrs, a)
 		}
 
@@ -272,6 +257,9 @@ func (p *Manager) SetAttribute(identity string, instanceID int, attr string, val
 	d := utils.Parse(device)
 	a := d.GetAttribute(instanceID, attr)
 	if a != nil {
+		if a.ReadOnly {
+			return errors.New("attribute is read only")
+		}
 		if setter, ok := a.Model.(attribute.Setter); ok {
 			return setter.Set(val)
 		}
@@ -279,3 +267,20 @@ func (p *Manager) SetAttribute(identity string, instanceID int, attr string, val
 	}
 	return errors.New("instance not found")
 }
+
+// newAttribute 生成属性的类型、范围等信息
+func newAttribute(attr *utils.Attribute) Attribute {
+	a := Attribute{
+		ID:        attr.ID,
+		Attribute: attr.Name,
+		ValType:   attr.Type,
+		ReadOnly:  attr.ReadOnly,
+	}
+	switch v := attr.Model.(type) {
+	case attribute.IntType:
+		a.Min, a.Max = v.GetRange()
+	case attribute.EnumType:
+		a.Enums = v.GetEnums()
+	}
+	return a
+}
@@ -98,6 +98,8 @@ type Attribute struct {
 	ValType   string      `json:"val_type"`
 	Min       *int        `json:"min,omitempty"`
 	Max       *int        `json:"max,omitempty"`
+	Enums     []int       `json:"enums,omitempty"`     // 枚举类型的有效值
+	ReadOnly  bool        `json:"read_only,omitempty"` // 只读属性不能设置
 }
 
 type Instance struct {
@@ -28,6 +28,7 @@ type Attribute struct {
 	Type      string
 	Tag       string
 	Require   bool
+	ReadOnly  bool // 只读属性，只能由设备上报，不能设置
 	Active    bool
 }
 
@@ -41,6 +42,8 @@ func (a *Attribute) parseTag() {
 			case "name":
 			case "required":
 				a.Require = true
+			case "readonly":
+				a.ReadOnly = true
 			}
 		}
 	}
@@ -159,3 +159,38 @@ func BenchmarkParseParallel(b *testing.B) {
 	})
 
 }
+
+func TestParseEnergyMeter(t *testing.T) {
+	meter := instance.EnergyMeter{Energy: instance.NewEnergy(), ActivePower: instance.NewActivePower()}
+	meter.Energy.SetFloat(12.5)
+
+	ins := ParseInstance(meter)
+	assert.Equal(t, "energy_meter", ins.Type)
+	energy := ins.GetAttribute("energy")
+	if assert.NotNil(t, energy) {
+		assert.Equal(t, "float", energy.Type)
+		assert.True(t, energy.Require)
+		assert.Equal(t, 12.5, attribute.ValueOf(energy.Model))
+	}
+	assert.True(t, ins.GetAttribute("active_power").Active)
+	assert.False(t, ins.GetAttribute("voltage").Active)
+}
+
+func TestParseThermostat(t *testing.T) {
+	thermostat := instance.Thermostat{
+		TargetTemperature:  instance.NewTargetTemperature(),
+		CurrentTemperature: instance.NewTemperature(),
+		HvacMode:           instance.NewHvacMode(),
+	}
+
+	ins := ParseInstance(thermostat)
+	assert.Equal(t, "thermostat", ins.Type)
+	mode := ins.GetAttribute("hvac_mode")
+	if assert.NotNil(t, mode) {
+		assert.Equal(t, "enum", mode.Type)
+		assert.False(t, mode.ReadOnly)
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5}, mode.Model.(attribute.EnumType).GetEnums())
+	}
+	assert.True(t, ins.GetAttribute("current_temperature").ReadOnly)
+	assert.False(t, ins.GetAttribute("target_temperature").ReadOnly)
+}
@@ -0,0 +1,116 @@
+// Package solar 离线计算日出、日落及晨昏蒙影时间
+// 算法参考 Almanac for Computers (1990)，精度约为 1~2 分钟，满足场景定时需求
+package solar
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Zenith 太阳天顶角（度）
+type Zenith float64
+
+const (
+	ZenithOfficial     Zenith = 90.8333 // 日出日落
+	ZenithCivil        Zenith = 96      // 民用晨昏蒙影
+	ZenithNautical     Zenith = 102     // 航海晨昏蒙影
+	ZenithAstronomical Zenith = 108     // 天文晨昏蒙影
+)
+
+var (
+	// ErrNeverRise 当天太阳不会升到该天顶角（极夜）
+	ErrNeverRise = errors.New("solar: sun never rises to the zenith on this date")
+	// ErrNeverSet 当天太阳不会落到该天顶角（极昼）
+	ErrNeverSet = errors.New("solar: sun never sets to the zenith on this date")
+)
+
+const degree = math.Pi / 180
+
+// Rise 计算 date 所在日期（按 date 的时区）太阳升到天顶角 z 的时间
+func Rise(date time.Time, lat, lng float64, z Zenith) (time.Time, error) {
+	return calc(date, lat, lng, z, true)
+}
+
+// Set 计算 date 所在日期（按 date 的时区）太阳落到天顶角 z 的时间
+func Set(date time.Time, lat, lng float64, z Zenith) (time.Time, error) {
+	return calc(date, lat, lng, z, false)
+}
+
+func calc(date time.Time, lat, lng float64, z Zenith, rising bool) (time.Time, error) {
+	lngHour := lng / 15
+	n := float64(date.YearDay())
+
+	var t float64
+	if rising {
+		t = n + (6-lngHour)/24
+	} else {
+		t = n + (18-lngHour)/24
+	}
+
+	// 太阳平近点角
+	m := 0.9856*t - 3.289
+	// 太阳真黄经
+	l := normalize(m+1.916*sin(m)+0.020*sin(2*m)+282.634, 360)
+
+	// 太阳赤经，并调整到与黄经相同的象限
+	ra := normalize(math.Atan(0.91764*math.Tan(l*degree))/degree, 360)
+	ra += math.Floor(l/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	// 太阳赤纬
+	sinDec := 0.39782 * sin(l)
+	cosDec := math.Cos(math.Asin(sinDec))
+
+	// 太阳时角
+	cosH := (cos(float64(z)) - sinDec*sin(lat)) / (cosDec * cos(lat))
+	if cosH > 1 {
+		return time.Time{}, ErrNeverRise
+	}
+	if cosH < -1 {
+		return time.Time{}, ErrNeverSet
+	}
+	var h float64
+	if rising {
+		h = 360 - math.Acos(cosH)/degree
+	} else {
+		h = math.Acos(cosH) / degree
+	}
+	h /= 15
+
+	// 当地平太阳时转换为 UTC
+	localT := h + ra - 0.06571*t - 6.622
+	ut := normalize(localT-lngHour, 24)
+
+	y, mon, d := date.Date()
+	result := time.Date(y, mon, d, 0, 0, 0, 0, time.UTC).
+		Add(time.Duration(ut * float64(time.Hour))).
+		In(date.Location())
+
+	// UTC 与本地时区跨日时，修正到 date 的同一天
+	ry, rm, rd := result.Date()
+	resultDay := time.Date(ry, rm, rd, 0, 0, 0, 0, time.UTC)
+	day := time.Date(y, mon, d, 0, 0, 0, 0, time.UTC)
+	if resultDay.Before(day) {
+		result = result.AddDate(0, 0, 1)
+	} else if resultDay.After(day) {
+		result = result.AddDate(0, 0, -1)
+	}
+	return result.Truncate(time.Second), nil
+}
+
+func sin(d float64) float64 {
+	return math.Sin(d * degree)
+}
+
+func cos(d float64) float64 {
+	return math.Cos(d * degree)
+}
+
+func normalize(v, max float64) float64 {
+	v = math.Mod(v, max)
+	if v < 0 {
+		v += max
+	}
+	return v
+}
@@ -0,0 +1,57 @@
+package solar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRiseSet(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	bst := time.FixedZone("BST", 3600)
+
+	tests := []struct {
+		name     string
+		date     time.Time
+		lat, lng float64
+		rise     time.Time
+		set      time.Time
+	}{
+		{
+			name: "shenzhen summer solstice",
+			date: time.Date(2021, 6, 21, 12, 0, 0, 0, cst),
+			lat:  22.54, lng: 114.06,
+			rise: time.Date(2021, 6, 21, 5, 39, 0, 0, cst),
+			set:  time.Date(2021, 6, 21, 19, 11, 0, 0, cst),
+		},
+		{
+			name: "london summer solstice",
+			date: time.Date(2021, 6, 21, 0, 0, 0, 0, bst),
+			lat:  51.5074, lng: -0.1278,
+			rise: time.Date(2021, 6, 21, 4, 43, 0, 0, bst),
+			set:  time.Date(2021, 6, 21, 21, 21, 0, 0, bst),
+		},
+	}
+
+	for _, tt := range tests {
+		rise, err := Rise(tt.date, tt.lat, tt.lng, ZenithOfficial)
+		assert.NoError(t, err, tt.name)
+		assert.WithinDuration(t, tt.rise, rise, 3*time.Minute, tt.name)
+
+		set, err := Set(tt.date, tt.lat, tt.lng, ZenithOfficial)
+		assert.NoError(t, err, tt.name)
+		assert.WithinDuration(t, tt.set, set, 3*time.Minute, tt.name)
+
+		dusk, err := Set(tt.date, tt.lat, tt.lng, ZenithCivil)
+		assert.NoError(t, err, tt.name)
+		assert.True(t, dusk.After(set), tt.name)
+	}
+}
+
+func TestPolarDay(t *testing.T) {
+	// 特罗姆瑟夏至极昼
+	date := time.Date(2021, 6, 21, 12, 0, 0, 0, time.UTC)
+	_, err := Set(date, 69.65, 18.96, ZenithOfficial)
+	assert.Equal(t, ErrNeverSet, err)
+}